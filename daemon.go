@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/diff"
+	"github.com/mxk/awsscan/scan/redact"
+	"github.com/pkg/errors"
+)
+
+// daemon scans the account every cmd.Interval and sends changes between
+// consecutive scans to cmd.Events until interrupted. Errors after the first
+// successful scan are reported on stderr without stopping the daemon. If the
+// events cannot be sent, the next scan is compared against the last scan
+// whose changes were delivered, so no changes are lost.
+func (cmd *scanCmd) daemon(cfg *aws.Config, op scan.Opts, keyGen keyGenFunc,
+	red *redact.Redactor) error {
+	sink, err := diff.NewSink(cmd.Events)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	var prev, raw []*scan.Map
+	for n := 0; ; n++ {
+		if op.Prev = nil; cmd.Incremental > 0 && n%cmd.Incremental != 0 {
+			op.Prev = raw
+		}
+		start := time.Now()
+		cur, maps, err := cmd.daemonScan(cfg, op, keyGen, red)
+		if err == nil && prev != nil {
+			err = sink.Send(diff.Diff(prev, maps, start))
+		}
+		if err != nil {
+			if prev == nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if maps != nil {
+			raw = cur
+			if err == nil {
+				// Undelivered changes are reported after the next scan
+				prev = maps
+			}
+		}
+		select {
+		case <-time.After(time.Until(start.Add(cmd.Interval))):
+		case <-sig:
+			return nil
+		}
+	}
+}
+
+// daemonScan performs one scan and returns the original results, if needed for
+// incremental scans, and compacted results. If cmd.Out is set, the compacted
+// results are also written there, replacing the previous scan.
+func (cmd *scanCmd) daemonScan(cfg *aws.Config, op scan.Opts, keyGen keyGenFunc,
+	red *redact.Redactor) (raw, maps []*scan.Map, err error) {
+	maps, err = scan.Account(cfg, op)
+	if err == nil {
+		err = errors.Wrap(op.Tracer.Err(), "failed to write trace")
+	}
+	if err == nil {
+		err = cmd.writeMetrics(op.Metrics)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	warnTimeouts(maps)
+	if cmd.Incremental > 0 {
+		raw, maps = maps, scan.Clone(maps)
+	}
+	if red != nil {
+		red.Maps(maps)
+	}
+	makeValues(maps)
+	maps = scan.Compact(maps)
+	if cmd.Out != "" {
+		err = cmd.writeJSON(makeHier(maps, keyGen, cmd.Stats))
+	}
+	return raw, maps, err
+}
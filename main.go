@@ -5,16 +5,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/endpoints"
 	"github.com/aws/aws-sdk-go-v2/aws/external"
+	tf "github.com/hashicorp/terraform/terraform"
 	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/check"
+	"github.com/mxk/awsscan/scan/cost"
+	"github.com/mxk/awsscan/scan/iameval"
+	"github.com/mxk/awsscan/scan/reach"
+	"github.com/mxk/awsscan/scan/redact"
+	"github.com/mxk/awsscan/scan/tfgen"
 	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/arn"
 	"github.com/mxk/go-cloud/aws/region"
 	"github.com/mxk/go-terraform/tfx"
 	"github.com/pkg/errors"
@@ -27,28 +41,65 @@ import (
 )
 
 type scanCmd struct {
-	CA        bool   `flag:"Make CloudAssert-compatible API calls"`
-	Hier      string `flag:"Depth or <format> of output hierarchy"`
-	Min       bool   `flag:"Minify JSON output"`
-	NoRefresh bool   `flag:"Do not refresh Terraform state output"`
-	Out       string `flag:"Output <file>"`
-	Raw       bool   `flag:"Do not compact output"`
-	Regions   string `flag:"Comma-separated <list> of regions (default all)"`
-	Roots     bool   `flag:"Make only root API calls"`
-	Services  string `flag:"Comma-separated <list> of services (default all)"`
-	Stats     bool   `flag:"Report call statistics in output"`
-	TFState   bool   `flag:"Generate Terraform state output"`
-	Workers   int    `flag:"IPoAC carrier <count>"`
+	CA          bool          `flag:"Make CloudAssert-compatible API calls"`
+	CallTimeout time.Duration `flag:"call-timeout,Abort calls that take longer than <duration>"`
+	Check       string        `flag:"Evaluate comma-separated <list> of rule sets"`
+	CIS         bool          `flag:"Evaluate CIS AWS Foundations Benchmark controls"`
+	CredReport  bool          `flag:"Generate IAM credential report for -cis if needed"`
+	Cost        string        `flag:"Estimate monthly costs using comma-separated price list <files>"`
+	Events      string        `flag:"Send -interval change events to <sink> (see help)"`
+	Format      string        `flag:"Write -check report in <format> (json, sarif, or junit)"`
+	Hier        string        `flag:"Depth or <format> of output hierarchy"`
+	IAMEval     string        `flag:"Evaluate scanned IAM policies for <query> (see help)"`
+	Incremental int           `flag:"Make a full -interval scan every <n> scans and reuse unchanged calls in between"`
+	Interval    time.Duration `flag:"Rescan every <interval> and report changes (see help)"`
+	Limit       string        `flag:"Limit calls per dependent API using comma-separated <spec> (see help)"`
+	LimitItems  string        `flag:"limit-items,Limit inputs per source output of each dependent API using <spec> (see help)"`
+	Load        string        `flag:"Analyze a saved -raw scan <file> instead of scanning (see help)"`
+	LogFile     string        `flag:"log-file,Write structured scan logs to <file> (default stderr)"`
+	LogLevel    string        `flag:"log-level,Log scan activity at <level> (debug, info, warn, error)"`
+	Metrics     string        `flag:"Write OpenMetrics text to <file> after the scan"`
+	MetricsAt   string        `flag:"Serve OpenMetrics over HTTP on <addr> during the scan"`
+	Min         bool          `flag:"Minify JSON output"`
+	NameAcct    bool          `flag:"Prefix Terraform resource names with account ID"`
+	NameTag     string        `flag:"Name Terraform resources using <tag> values"`
+	NoRefresh   bool          `flag:"Do not refresh Terraform state output"`
+	Out         string        `flag:"Output <file>"`
+	Prev        string        `flag:"Reuse unchanged calls from a previous -raw scan <file> (see help)"`
+	Progress    bool          `flag:"Report scan progress on stderr"`
+	Raw         bool          `flag:"Do not compact output"`
+	Reach       string        `flag:"Analyze network reachability for <query> (see help)"`
+	Redact      string        `flag:"Redact sensitive values using comma-separated <spec> (see help)"`
+	RedactKey   string        `flag:"redact-key,Read -redact hash key from <file>"`
+	Regions     string        `flag:"Comma-separated <list> of regions (default all)"`
+	Roots       bool          `flag:"Make only root API calls"`
+	ScanTimeout time.Duration `flag:"scan-timeout,Stop the scan after <duration> with partial results"`
+	Sample      bool          `flag:"Select limited calls by input hash instead of in order"`
+	Serve       string        `flag:"Serve the scan HTTP API on <addr> (see help)"`
+	ServeMax    int           `flag:"serve-max,Run at most <n> concurrent -serve scans"`
+	Services    string        `flag:"Comma-separated <list> of services (default all)"`
+	Stats       bool          `flag:"Report call statistics in output"`
+	Suppress    string        `flag:"Suppress -check findings listed in JSON <file>"`
+	TagPolicy   string        `flag:"Evaluate tag compliance using JSON policy <file>"`
+	TFConfig    string        `flag:"Generate Terraform configuration in <dir>"`
+	TFImport    string        `flag:"Generate Terraform import commands in <format> (sh or tf)"`
+	TFState     bool          `flag:"Generate Terraform state output"`
+	TFStateV4   bool          `flag:"Generate Terraform state output in format version 4"`
+	Timing      string        `flag:"timing-report,Write scan timing analysis to <file>"`
+	Trace       string        `flag:"Write scan trace spans to <file>"`
+	Workers     int           `flag:"IPoAC carrier <count>"`
 }
 
 func main() {
 	cli.Main = cli.Info{
-		Usage:   "[options]",
+		Usage:   "[options] [serve <addr> | check <file> | daemon] [options]",
+		MaxArgs: -1,
 		Summary: "Describe all resources in an AWS account",
 		New: func() cli.Cmd {
 			return &scanCmd{
-				Hier:    "{account}/{region}/{service}.{api},{id}",
-				Workers: 64,
+				Hier:     "{account}/{region}/{service}.{api},{id}",
+				ServeMax: 2,
+				Workers:  64,
 			}
 		},
 	}
@@ -104,16 +155,475 @@ func (*scanCmd) Help(w *cli.Writer) {
 
 	Service names may be negated by using "no-" prefix. For example,
 	'-services no-ec2,no-s3' will scan all supported services except ec2 and s3.
+
+	Use -tfconfig to generate Terraform configuration for all resources in the
+	refreshed state. One file is created in the specified directory for each
+	service and region, and provider configuration is written to providers.tf.
+	IDs and ARNs of other managed resources are replaced with references. Add
+	-tfstate to also write the matching state to stdout (or -out file).
+
+	Use -tfimport to generate commands for importing all resources into an
+	existing Terraform configuration. The "sh" format is a shell script of
+	'terraform import' commands, and the "tf" format contains import blocks
+	supported by Terraform 1.5 and later. Resource addresses use the same names
+	as -tfstate output.
+
+	Terraform resources are named "<region>_<id>", with invalid identifier
+	characters replaced by underscores. Use -nametag to prefer the value of the
+	specified tag (e.g. "Name") over the resource ID, and -nameacct to prefix
+	all names with the account ID. Names that collide are disambiguated with a
+	hash of the resource ID, so they remain stable between scans.
+
+	Terraform state is normally written in format version 3 used by Terraform
+	0.11. Use -tfstatev4 to write format version 4, which can be used by current
+	Terraform releases without a manual upgrade.
+
+	Use -check to evaluate security rules against scan results instead of
+	writing them. The report lists the status of each rule and any findings
+	with their severity, resource ARN, and the ID of the call that provided the
+	evidence. The scan exits with status code 3 if there are any findings. Use
+	'-check help' to see all rule sets and rules (-raw enables JSON output).
+
+	The "access" rule set reports principals outside of the scanned accounts,
+	and anonymous ("*") principals, that are granted access by IAM role trust
+	policies or by S3, KMS, Lambda, SQS, SNS, and CloudWatch Logs resource
+	policies. Scan all accounts in an organization together to avoid reporting
+	access between them.
+
+	The "unused" rule set reports resources that are likely unused, such as
+	unattached EBS volumes and network interfaces, unassociated Elastic IPs,
+	security groups and launch configurations that are not referenced, target
+	groups without healthy targets, IAM access keys that were never used, and
+	log groups without a retention period.
+
+	Use -suppress to exclude known findings from the report. The file contains
+	a JSON array of objects with "rule" and "resource" patterns, which may use
+	'*' and '?' wildcards, and an optional "reason". Suppressed findings are
+	listed separately and do not affect rule status or exit status:
+
+	  [{"rule": "ec2-unused-sg", "resource": "arn:aws:ec2:*:*:security-group/sg-1", "reason": "..."}]
+
+	Use -tagpolicy to report resources that are missing required tags or have
+	tag values that are not allowed. The file contains a JSON array of objects
+	with a "resource" type pattern and a map of required "tags" to lists of
+	allowed value patterns (an empty list allows any value). Resource types
+	have the form "<service>:<type>" (e.g. "ec2:instance", "s3:bucket",
+	"rds:db"), and all patterns may use '*' and '?' wildcards. A resource must
+	satisfy every policy that matches its type:
+
+	  [{"resource": "*", "tags": {"Owner": [], "Environment": ["prod", "dev"]}}]
+
+	Use -cost to add a rough monthly cost estimate to the scan output under the
+	"#cost" key. Costs are grouped by account, region, and service, and are
+	calculated from on-demand prices in one or more AWS Price List offer files
+	(e.g. AmazonEC2, AmazonRDS, AWSELB, and AmazonDynamoDB), which may be
+	reduced to the relevant products. No pricing API calls are made. Products
+	are matched by their "regionCode" attribute. Running EC2 instances, EBS
+	volumes, NAT gateways, load balancers, RDS instances and storage, and
+	DynamoDB provisioned capacity are included, assuming 730 hours per month.
+	Resources without a matching price are listed as unpriced. Data transfer
+	and other usage-based charges are not included.
+
+	Use -redact to replace sensitive values, such as EC2 user data, Lambda
+	environment variables, and CloudFormation stack parameters, in JSON and
+	Terraform state and configuration output. The spec is a comma-separated
+	list of "mask" (default), which replaces values with "REDACTED", "hash",
+	which replaces values with their HMAC-SHA256 so that changes remain
+	detectable, and JSON rule files that extend the built-in rules. Hash mode
+	requires a secret key, which is read from the -redact-key file. Use the
+	same key for all scans that are compared, and keep it separate from the
+	output, since anyone with the key can test guesses of redacted values.
+
+	API output rules specify "service" and "api" patterns and a dot-separated
+	"path" of field names, where '*' matches all map keys or list elements.
+	Terraform rules specify a "resource" type pattern and a "path" pattern
+	matched against state attribute keys. Each rule may override the "mode":
+
+	  [{"service": "rds", "api": "DescribeDBInstances", "path": "DBInstances.*.MasterUsername"},
+	   {"resource": "aws_db_instance", "path": "password", "mode": "hash"}]
+
+	Use -cis to evaluate CIS AWS Foundations Benchmark v1.2.0 controls. This
+	limits the scan to the API calls needed by the "cis" rule set, which is
+	added to any sets given by -check. Each control is reported as passing,
+	failing, or not applicable if the scan found no evidence to evaluate it.
+	Credential report controls use the existing IAM credential report and are
+	not applicable if it is missing or expired. Use -credreport to generate a
+	new report if needed. This is the only option that makes a write API call.
+
+	Use -format to write the -check report in SARIF 2.1.0 ("sarif") or JUnit
+	XML ("junit") format for CI systems. SARIF results are located at resource
+	ARNs. JUnit test suites correspond to rules, with one test case per service
+	that produced findings. Both formats also include the "errors" rule set,
+	which reports API errors that would otherwise only affect the exit status,
+	so -format may be used without -check.
+
+	Use -load to run -check, -cis, -iameval, or -reach against a scan saved
+	with -raw and the same -hier instead of scanning the account, so no AWS
+	credentials or API calls are needed. "check <file>" is the same as
+	"-load <file>" and evaluates the "security" rule set unless another
+	analysis is requested (e.g. awsscan check scan.json -format sarif). Scans
+	saved without -raw are compacted and cannot be loaded.
+
+	Use -progress to report scan progress on stderr. When stderr is a terminal,
+	a single status line is updated every second with the number of calls
+	issued, ready, running, and completed, error and throttle counts, the
+	current call rate, and the number of service/region contexts remaining.
+	Otherwise, the same information is written as a JSON object every 10
+	seconds. Send SIGUSR1 (or SIGINFO on BSD and macOS) to include a breakdown
+	of active contexts, which shows what a slow scan is waiting on.
+
+	Use -metrics to write scan metrics in OpenMetrics text format to a file once
+	the scan is done, or -metricsat to serve them at http://<addr>/metrics while
+	the scan is running (e.g. -metricsat localhost:9100). Metrics include API
+	calls by service, region, API, and result status, request and retry
+	counts, throttled requests, request latency and worker queue time
+	histograms, and scan duration. These are collected independently of
+	-stats and do not change the scan output.
+
+	Use -log-level to write structured logs of scan activity as JSON lines to
+	stderr, or to the file specified by -log-file. The "debug" level includes
+	link scheduling decisions, the start and finish of each call with its ID
+	and page count, API errors before and after service-specific error
+	handling, and Terraform resources added during post-processing. The "info"
+	level (default with -log-file) reports scan start and finish, and "warn"
+	reports calls that failed with errors that were not ignored.
+
+	Use -timing-report to write an analysis of call timing to a file in JSON
+	format. The report includes the critical path through the API dependency
+	graph (the chain of calls that determined the scan duration, with the time
+	each call waited after its dependencies were satisfied), per-service wall
+	and execution times, worker utilization over time, the slowest calls, the
+	most paginated APIs, and a suggested -workers value. A call becomes ready
+	only when all calls to the APIs it depends on have finished, so a single
+	slow call can delay an entire service.
+
+	Use -trace to write OpenTelemetry-style trace spans to a file as JSON lines.
+	Each scan is one trace with a span for every account/region/service
+	context, API call, and HTTP request attempt (page or retry). Spans include
+	the API name, call ID, page count, and error code. A call span is a child
+	of the call that produced its input (additional sources are listed as
+	links), so the span tree mirrors the call dependencies in the scan output.
+
+	Use -interval to run continuously, rescanning the account at the specified
+	interval (e.g. -interval 1h) until interrupted, and -events to report
+	changes between consecutive scans. The "daemon" command does the same,
+	with events written to stdout unless -events is given (e.g. awsscan
+	daemon -interval 1h). Each change event is a JSON line with the "kind" of
+	change ("created", "modified", or "deleted"), the account, region,
+	service, API, and call ID, the call inputs, and the "before" and "after"
+	call outputs and errors. Calls are matched by their stable IDs.
+	Resources listed by root calls, such as EC2 instances, are matched by
+	their IDs and reported as separate events, with "resource" set to the
+	list name and ID (e.g. "Reservations:r-1/Instances:i-1"). The first scan
+	only establishes a baseline. If events cannot be delivered, they are
+	included in the events for the next scan. The sink may be a file name, to
+	which events are appended ("-" for stdout), "unix:<path>" for a Unix
+	socket, which receives a new connection for each scan, or an http:// or
+	https:// webhook URL, which receives a POST request with all events from
+	one scan. If -out is specified, it is overwritten with the latest scan
+	results. Use -redact hash to detect changes in sensitive values without
+	reporting them, and -metricsat to monitor the daemon.
+
+	Use -incremental with -interval to avoid repeating calls whose results
+	are not expected to have changed. After a full scan, each of the next n-1
+	scans reruns root calls and any call whose inputs were derived from output
+	pages that differ from the previous scan. Other calls that were made by the
+	previous scan, such as per-resource calls for unchanged resource lists, are
+	copied from it. Calls that previously failed with errors that were not
+	ignored are always retried. Calls whose results change over time with the
+	same inputs (cloudtrail GetTrailStatus, elbv2 DescribeTargetHealth, and iam
+	GetAccessKeyLastUsed and GetCredentialReport) are never copied. Other
+	changes that are not reflected in the source outputs, such as an edited
+	bucket policy, are only detected by the next full scan. With -stats, copied
+	calls are counted as "Reused".
+
+	Use -prev to make the same kind of incremental scan once, using a previous
+	scan saved with -raw and the same -hier. The previous scan should not be
+	redacted, since copied calls keep their saved outputs.
+
+	Use "serve <addr>" or -serve to run an HTTP API for starting scans and
+	browsing their results (e.g. awsscan serve localhost:8080). Scans run in
+	the background and are kept in memory until deleted. At most -serve-max
+	scans (default 2) run at the same time, and further requests to start a
+	scan fail with status 429 until one finishes. Options such as -workers,
+	-redact, -log-level, and -metrics apply to all scans. Metrics accumulate
+	over all scans, the -metrics file is rewritten after each scan finishes,
+	and /metrics is also served when -metrics or -metricsat is given.
+
+	The API has no authentication. Anyone who can connect to <addr> can start
+	scans with the host's AWS credentials and read their state and results,
+	so use a loopback address such as localhost:8080 unless access to the
+	port is restricted by other means. Endpoints:
+
+	  POST   /scans                     Start a scan (returns 202 and scan status)
+	  GET    /scans                     List all scans
+	  GET    /scans/<id>                Get scan state and progress
+	  DELETE /scans/<id>                Delete a finished scan
+	  GET    /scans/<id>/results        Get scan results (see below)
+	  GET    /scans/<id>/calls?id=<cid> Get one call with its ancestors and
+	                                    descendants (<cid> must be URL-encoded)
+
+	The POST body is a JSON object with optional "regions" and "services"
+	lists, "workers" count, and "roots", "ca", "cis", "credReport", "stats",
+	and "raw" booleans, which have the same meaning as the corresponding
+	options:
+
+	  {"regions": ["us-east-1"], "services": ["ec2", "s3"], "stats": true}
+
+	The results endpoint accepts a "format" query parameter. The default
+	"json" format is the output hierarchy and accepts "hier", "stats", and
+	"min" parameters (e.g. ?hier=2&min=1). "tfstate" and "tfstate4" return
+	Terraform state, and "tfimport" returns import commands in the "import"
+	format (sh or tf), all without refresh. "check" evaluates comma-separated
+	"rules" sets and returns the report in the "report" format (json, sarif,
+	or junit), e.g. ?format=check&rules=security&report=sarif. The calls
+	endpoint returns the call, its "key" ("<account>/<region>/<service>.<api>"),
+	and lists of calls that provided its inputs ("ancestors") and that used its
+	outputs ("descendants"), following "src" links transitively.
+
+	Use -call-timeout to abort calls that take too long, such as requests to
+	unresponsive regional endpoints, and -scan-timeout to limit the duration of
+	the entire scan. The call timeout applies to all pages and retries of one
+	call. Outputs received before a timeout are kept, and dependent calls are
+	made using those outputs. Once the scan timeout expires, running calls are
+	aborted, and calls that were not yet made fail immediately. Calls that
+	timed out have a "Timeout" error code, and a summary of them is written to
+	stderr.
+
+	Use -limit to cap the number of calls made for each dependent API, which
+	limits the fan-out of per-resource calls in large accounts. The spec is a
+	comma-separated list of a default limit and "<service>.<api>=<n>" entries,
+	where the API may use '*' and '?' wildcards. A limit of 0 means no limit.
+	Exact API names take precedence over patterns:
+
+	  -limit 100,iam.*=10,logs.ListTagsLogGroup=0
+
+	Use -limit-items with the same spec syntax to cap the number of inputs
+	that each source output page provides to a dependent API, such as the
+	GetPolicyVersion calls for each page of ListPolicies results.
+
+	Root calls are never limited. By default, the first calls or inputs are
+	kept. Use -sample to instead keep those with the smallest hashes of their
+	region, service, API, and inputs, so that the same resources are selected
+	by every scan regardless of their order in the source outputs. The number
+	of calls that were not made for each API is reported under the
+	"#truncated" key of the JSON output:
+
+	  "#truncated": {"<account>/<region>/<service>.<api>": <skipped-calls>}
+
+	Use -iameval to evaluate the identity policies of scanned IAM users and
+	roles offline. The query "<principal>,<action>,<resource>" reports whether
+	each matching principal may perform the action on the resource, and which
+	policy statements determined the decision. The principal may be an ARN,
+	"user/<name>", "role/<name>", a name, or "*" for all principals. The query
+	"all" lists the permissions of every principal. Only inline and customer
+	managed policies are evaluated; attached AWS managed policies are listed as
+	unresolved. Permission boundaries, SCPs, and resource-based policies are
+	not considered. Only condition keys that describe the principal are known,
+	so the decision is "conditional" if it depends on statements with other
+	keys (e.g. aws:SourceIp or aws:MultiFactorAuthPresent) or unsupported
+	condition operators. Those statements are listed as the matches. The scan
+	is limited to IAM unless -services is specified.
+
+	Use -reach to analyze network reachability of scanned VPC resources
+	offline. The query "internet" reports the ports of each network interface
+	with a public IP address that are reachable from the internet. The query
+	"<src>,<dst>" reports the ports of <dst> that are reachable from <src>,
+	where each endpoint is a network interface ID, instance ID, or private IP
+	address. Each path lists the route table entries, network ACL entries, and
+	security group rules that allow the traffic, including return traffic on
+	ephemeral ports. Rules for all protocols are evaluated for TCP, UDP, and
+	ICMP. Transit gateways, VPN connections, and VPC endpoints are not
+	considered. The scan is limited to EC2 unless -services is specified.
 	`)
 }
 
 func (cmd *scanCmd) Main(args []string) error {
 	// Parse and validate command-line options
+	if err := cmd.parseArgs(args); err != nil {
+		return err
+	}
 	keyGen, err := parseHier(cmd.Hier)
 	if err != nil {
 		return err
 	}
-	op := scan.Opts{Mode: cmd.mode(), Workers: cmd.Workers}
+	if cmd.TFConfig != "" && cmd.NoRefresh {
+		return errors.New("-tfconfig requires Terraform state refresh")
+	}
+	switch cmd.TFImport {
+	case "", tfgen.ImportScript, tfgen.ImportBlocks:
+	default:
+		return errors.Errorf("invalid -tfimport format %q", cmd.TFImport)
+	}
+	var sets []string
+	switch cmd.Format {
+	case "", "json":
+	case "sarif", "junit":
+		sets = append(sets, check.Errors)
+	default:
+		return errors.Errorf("invalid -format %q", cmd.Format)
+	}
+	if cmd.Check == "help" {
+		return cmd.writeRules()
+	} else if cmd.Check != "" {
+		sets = append(sets, strings.Split(cmd.Check, ",")...)
+	}
+	if cmd.CIS {
+		sets = append(sets, "cis")
+	} else if cmd.CredReport {
+		return errors.New("-credreport requires -cis")
+	}
+	var rules []*check.Rule
+	if len(sets) > 0 {
+		if rules, err = check.Rules(sets...); err != nil {
+			return err
+		}
+	}
+	if cmd.TagPolicy != "" {
+		list, err := check.LoadTagPolicy(cmd.TagPolicy)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, check.TagPolicyRule(list))
+	}
+	var suppress []*check.Suppression
+	if cmd.Suppress != "" {
+		if rules == nil {
+			return errors.New("-suppress requires rule evaluation")
+		}
+		if suppress, err = check.LoadSuppressions(cmd.Suppress); err != nil {
+			return err
+		}
+	}
+	var query []string
+	if cmd.IAMEval != "" {
+		if rules != nil {
+			return errors.New("-iameval cannot be combined with rule evaluation")
+		}
+		if query = strings.SplitN(cmd.IAMEval, ",", 3); len(query) != 3 &&
+			cmd.IAMEval != "all" {
+			return errors.Errorf("invalid -iameval query %q", cmd.IAMEval)
+		}
+		if cmd.Services == "" {
+			cmd.Services = "iam"
+		}
+	}
+	var reachQuery []string
+	if cmd.Reach != "" {
+		if rules != nil || query != nil {
+			return errors.New("-reach cannot be combined with other analysis")
+		}
+		if reachQuery = strings.Split(cmd.Reach, ","); len(reachQuery) != 2 &&
+			cmd.Reach != "internet" {
+			return errors.Errorf("invalid -reach query %q", cmd.Reach)
+		}
+		if cmd.Services == "" {
+			cmd.Services = "ec2"
+		}
+	}
+	var prices *cost.Prices
+	if cmd.Cost != "" {
+		if rules != nil || query != nil || reachQuery != nil || cmd.TFImport != "" ||
+			cmd.TFConfig != "" || cmd.TFState || cmd.TFStateV4 {
+			return errors.New("-cost requires JSON scan output")
+		}
+		if prices, err = cost.LoadPrices(strings.Split(cmd.Cost, ",")...); err != nil {
+			return err
+		}
+	}
+	var red *redact.Redactor
+	if cmd.Redact != "" {
+		red = &redact.Redactor{Mode: redact.Mask, Rules: redact.Defaults}
+		for _, spec := range strings.Split(cmd.Redact, ",") {
+			switch m := redact.Mode(spec); m {
+			case redact.Mask, redact.Hash:
+				red.Mode = m
+			default:
+				rules, err := redact.LoadRules(spec)
+				if err != nil {
+					return err
+				}
+				red.Rules = append(red.Rules, rules...)
+			}
+		}
+		if cmd.RedactKey != "" {
+			b, err := ioutil.ReadFile(cmd.RedactKey)
+			if err != nil {
+				return errors.Wrap(err, "failed to read redaction key")
+			}
+			if red.Key = bytes.TrimSpace(b); len(red.Key) == 0 {
+				return errors.New("empty redaction key")
+			}
+		}
+		if err = red.Validate(); err != nil {
+			return errors.Wrap(err, "-redact")
+		}
+	} else if cmd.RedactKey != "" {
+		return errors.New("-redact-key requires -redact")
+	}
+	if cmd.Incremental != 0 && cmd.Interval <= 0 {
+		return errors.New("-incremental requires -interval")
+	}
+	if cmd.Interval > 0 || cmd.Events != "" {
+		if cmd.Interval <= 0 || cmd.Events == "" {
+			return errors.New("-interval and -events must be used together")
+		}
+		if cmd.Incremental < 0 {
+			return errors.New("invalid -incremental scan count")
+		}
+		if rules != nil || query != nil || reachQuery != nil || prices != nil ||
+			cmd.Raw || cmd.Timing != "" || cmd.TFImport != "" ||
+			cmd.TFConfig != "" || cmd.TFState || cmd.TFStateV4 {
+			return errors.New("-interval requires JSON scan output")
+		}
+	}
+	if cmd.Serve != "" {
+		if rules != nil || query != nil || reachQuery != nil || prices != nil ||
+			cmd.Interval > 0 || cmd.Progress || cmd.Timing != "" ||
+			cmd.TFImport != "" || cmd.TFConfig != "" || cmd.TFState || cmd.TFStateV4 {
+			return errors.New("-serve cannot be combined with other analysis or output")
+		}
+		if cmd.ServeMax <= 0 {
+			return errors.New("invalid -serve-max scan count")
+		}
+	}
+	op := scan.Opts{
+		Mode:        cmd.mode(),
+		Workers:     cmd.Workers,
+		CallTimeout: cmd.CallTimeout,
+		ScanTimeout: cmd.ScanTimeout,
+		Sample:      cmd.Sample,
+	}
+	if cmd.Limit != "" {
+		if op.MaxCalls, op.Limits, err = parseLimit("-limit", cmd.Limit); err != nil {
+			return err
+		}
+	}
+	if cmd.LimitItems != "" {
+		op.MaxItems, op.ItemLimits, err = parseLimit("-limit-items", cmd.LimitItems)
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Sample && cmd.Limit == "" && cmd.LimitItems == "" {
+		return errors.New("-sample requires -limit or -limit-items")
+	}
+	if cmd.Prev != "" {
+		if cmd.Interval > 0 || cmd.Serve != "" {
+			return errors.New("-prev cannot be used with -interval or -serve")
+		}
+		if op.Prev, err = loadScan(cmd.Prev, cmd.Hier); err != nil {
+			return err
+		}
+	}
+	if cmd.Load != "" {
+		if rules == nil && query == nil && reachQuery == nil {
+			return errors.New("-load requires -check, -cis, -iameval, or -reach")
+		}
+		if cmd.Prev != "" {
+			return errors.New("-load cannot be used with -prev")
+		}
+	}
 
 	// Configure regions and services
 	if cmd.Regions != "" {
@@ -129,18 +639,129 @@ func (cmd *scanCmd) Main(args []string) error {
 		op.Services = getServices(cmd.Services)
 	}
 
+	// Analyze a saved scan without making any API calls
+	if cmd.Load != "" {
+		maps, err := loadScan(cmd.Load, cmd.Hier)
+		if err != nil {
+			return err
+		}
+		return cmd.analyze(maps, rules, suppress, query, reachQuery)
+	}
+
 	// Execute scan
 	cfg, err := external.LoadDefaultAWSConfig()
 	if err != nil {
 		return errors.Wrap(err, "failed to load AWS config")
 	}
+	if cmd.Progress {
+		var stop func()
+		op.Progress, stop = newProgress()
+		defer stop()
+	}
+	if cmd.Metrics != "" || cmd.MetricsAt != "" {
+		op.Metrics = scan.NewMetrics()
+	}
+	if cmd.LogLevel != "" || cmd.LogFile != "" {
+		lvl := scan.LogInfo
+		if cmd.LogLevel != "" {
+			if lvl, err = scan.ParseLogLevel(cmd.LogLevel); err != nil {
+				return err
+			}
+		}
+		w := io.Writer(os.Stderr)
+		if cmd.LogFile != "" {
+			f, err := os.Create(cmd.LogFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		op.Logger = scan.NewJSONLogger(w, lvl)
+	}
+	if cmd.Trace != "" {
+		f, err := os.Create(cmd.Trace)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close()
+		op.Tracer = scan.NewTracer(f)
+	}
+	if cmd.MetricsAt != "" {
+		ln, err := net.Listen("tcp", cmd.MetricsAt)
+		if err != nil {
+			return errors.Wrap(err, "failed to start metrics listener")
+		}
+		defer ln.Close()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", op.Metrics)
+		go http.Serve(ln, mux)
+	}
+	if cmd.Serve != "" {
+		return cmd.serve(&cfg, op, red)
+	}
+	if cmd.Interval > 0 {
+		return cmd.daemon(&cfg, op, keyGen, red)
+	}
 	maps, err := scan.Account(&cfg, op)
+	if err == nil {
+		err = errors.Wrap(op.Tracer.Err(), "failed to write trace")
+	}
 	if err != nil {
 		return err
 	}
+	if cmd.Timing != "" {
+		if err = cmd.writeJSONFile(cmd.Timing, scan.Timing(maps, op.Workers)); err != nil {
+			return err
+		}
+		if !cmd.Stats {
+			scan.Walk(maps, func(_ *scan.Map, _ string, c *scan.Call) error {
+				c.Stats = nil
+				return nil
+			})
+		}
+	}
+	if err = cmd.writeMetrics(op.Metrics); err != nil {
+		return err
+	}
+	warnTimeouts(maps)
+
+	// Evaluate IAM policies, network reachability, or rules against
+	// uncompacted results
+	if rules != nil || query != nil || reachQuery != nil {
+		return cmd.analyze(maps, rules, suppress, query, reachQuery)
+	}
+
+	// Redact sensitive values before any output is generated
+	if red != nil {
+		red.Maps(maps)
+	}
+
+	// Write Terraform import commands from unrefreshed state
+	if cmd.TFImport != "" {
+		s, err := scan.NewTFState(maps)
+		if err != nil {
+			return err
+		}
+		if cmd.NameTag != "" && !cmd.NoRefresh {
+			if s, err = tfx.Context().Refresh(s); err != nil {
+				return err
+			}
+		}
+		cmd.naming(maps).Rename(s)
+		b, err := tfgen.Imports(s, cmd.TFImport)
+		if err != nil {
+			return err
+		}
+		return cli.WriteFile(cmd.Out, func(w io.Writer) error {
+			_, err := w.Write(b)
+			return err
+		})
+	}
 
 	// Write Terraform state only if no other JSON-related flags are set
-	if cmd.TFState && !cmd.Min && !cmd.Raw && !cmd.Stats {
+	tfState := cmd.TFState || cmd.TFStateV4
+	if (tfState || cmd.TFConfig != "") && !cmd.Min && !cmd.Raw && !cmd.Stats {
 		s, err := scan.NewTFState(maps)
 		if err != nil {
 			return err
@@ -149,16 +770,45 @@ func (cmd *scanCmd) Main(args []string) error {
 			if s, err = tfx.Context().Refresh(s); err != nil {
 				return err
 			}
+		}
+		if cmd.naming(maps).Rename(s); !cmd.NoRefresh {
 			tfx.Deps.Infer(s)
 		}
+		if red != nil {
+			red.State(s)
+		}
+		if cmd.TFConfig != "" {
+			if err = cmd.writeTFConfig(maps, s); err != nil || !tfState {
+				return err
+			}
+		}
+		if cmd.TFStateV4 {
+			b, err := tfgen.StateV4(s)
+			if err != nil {
+				return err
+			}
+			return cli.WriteFile(cmd.Out, func(w io.Writer) error {
+				_, err := w.Write(b)
+				return err
+			})
+		}
 		return tfx.WriteStateFile(cmd.Out, s)
 	}
 
+	// Estimate costs using uncompacted results
+	var est *cost.Estimate
+	if prices != nil {
+		est = prices.Estimate(maps)
+	}
+
 	// Format and write JSON output
 	if makeValues(maps); !cmd.Raw {
 		maps = scan.Compact(maps)
 	}
 	h := makeHier(maps, keyGen, cmd.Stats)
+	if est != nil {
+		h["#cost"] = est
+	}
 	if err = cmd.writeJSON(h); err == nil && !cmd.Raw {
 		if err = apiErr(maps); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
@@ -168,24 +818,109 @@ func (cmd *scanCmd) Main(args []string) error {
 	return err
 }
 
+// parseArgs handles positional commands, which may be followed by more options
+// (e.g. awsscan daemon -interval 1h).
+func (cmd *scanCmd) parseArgs(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	usage := errors.New("usage: awsscan [options] " +
+		"[serve <addr> | check <file> | daemon] [options]")
+	name, args := args[0], args[1:]
+	var arg string
+	switch name {
+	case "serve", "check":
+		if len(args) == 0 {
+			return usage
+		}
+		arg, args = args[0], args[1:]
+	case "daemon":
+	default:
+		return usage
+	}
+	fs := cli.NewFlagSet(cmd)
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrap(err, name)
+	} else if fs.NArg() > 0 {
+		return usage
+	}
+	switch name {
+	case "serve":
+		if cmd.Serve != "" {
+			return usage
+		}
+		cmd.Serve = arg
+	case "check":
+		if cmd.Load != "" {
+			return usage
+		}
+		cmd.Load = arg
+		if cmd.Check == "" && !cmd.CIS && cmd.IAMEval == "" && cmd.Reach == "" {
+			cmd.Check = "security"
+		}
+	case "daemon":
+		if cmd.Interval <= 0 {
+			return errors.New("daemon requires -interval")
+		}
+		if cmd.Events == "" {
+			cmd.Events = "-"
+		}
+	}
+	return nil
+}
+
+// analyze writes the results of an -iameval or -reach query, or evaluates
+// rules and writes the report. Maps must not be compacted.
+func (cmd *scanCmd) analyze(maps []*scan.Map, rules []*check.Rule,
+	suppress []*check.Suppression, query, reachQuery []string) error {
+	if query != nil {
+		return cmd.writeIAMEval(maps, query)
+	}
+	if reachQuery != nil {
+		return cmd.writeReach(maps, reachQuery)
+	}
+	r := check.Run(maps, rules)
+	r.Suppress(suppress)
+	err := cmd.writeReport(r)
+	if err == nil && len(r.Findings()) > 0 {
+		cli.Exit(3)
+	}
+	return err
+}
+
 // mode converts command line options into scan.Mode.
 func (cmd *scanCmd) mode() (m scan.Mode) {
 	if cmd.CA {
 		m |= scan.CloudAssert
 	}
+	if cmd.CIS {
+		m |= scan.CIS
+	}
+	if cmd.CredReport {
+		m |= scan.CredReport
+	}
 	if cmd.Roots {
 		m |= scan.RootsOnly
 	}
-	if cmd.Stats {
+	if cmd.Stats || cmd.Timing != "" {
 		m |= scan.KeepStats
 	}
-	if cmd.TFState {
+	if cmd.TFState || cmd.TFStateV4 || cmd.TFConfig != "" || cmd.TFImport != "" {
 		tfx.SetLogFilter(os.Stderr, "", true)
 		m |= scan.TFState
 	}
 	return
 }
 
+// naming returns the Terraform resource naming strategy.
+func (cmd *scanCmd) naming(maps []*scan.Map) scan.Naming {
+	n := scan.Naming{Tag: cmd.NameTag}
+	if cmd.NameAcct && len(maps) > 0 {
+		n.Account = maps[0].Account
+	}
+	return n
+}
+
 // writeRegions writes regions within each partition to cmd.Out.
 func (cmd *scanCmd) writeRegions() error {
 	parts := endpoints.DefaultPartitions()
@@ -292,9 +1027,114 @@ func (cmd *scanCmd) writeServices() error {
 	})
 }
 
+// writeRules writes all rule sets and their rules to cmd.Out.
+func (cmd *scanCmd) writeRules() error {
+	all := make(map[string][]*check.Rule)
+	for _, set := range check.Sets() {
+		all[set], _ = check.Rules(set)
+	}
+	if cmd.Raw {
+		return cmd.writeJSON(all)
+	}
+	var b bytes.Buffer
+	for _, set := range check.Sets() {
+		width := 0
+		for _, r := range all[set] {
+			if len(r.ID) > width {
+				width = len(r.ID)
+			}
+		}
+		b.WriteString(set)
+		b.WriteString(":\n")
+		for _, r := range all[set] {
+			fmt.Fprintf(&b, "- %-*s [%s] %s\n", width, r.ID, r.Severity, r.Title)
+		}
+		b.WriteByte('\n')
+	}
+	return cli.WriteFile(cmd.Out, func(w io.Writer) error {
+		_, err := b.WriteTo(w)
+		return err
+	})
+}
+
+// writeIAMEval writes the results of an -iameval query to cmd.Out.
+func (cmd *scanCmd) writeIAMEval(maps []*scan.Map, query []string) error {
+	all, err := iameval.Principals(maps)
+	if err != nil {
+		return err
+	}
+	if len(query) == 1 {
+		type perms struct {
+			Principal   arn.ARN               `json:"principal"`
+			Permissions []*iameval.Permission `json:"permissions"`
+			Unresolved  []arn.ARN             `json:"unresolved,omitempty"`
+		}
+		out := make([]*perms, 0, len(all))
+		for _, p := range all {
+			out = append(out, &perms{p.ARN, p.Permissions(), p.Unresolved})
+		}
+		return cmd.writeJSON(out)
+	}
+	ps := iameval.Find(all, query[0])
+	if len(ps) == 0 {
+		return errors.Errorf("principal %q not found", query[0])
+	}
+	out := make([]*iameval.Result, 0, len(ps))
+	for _, p := range ps {
+		out = append(out, p.Eval(query[1], query[2]))
+	}
+	return cmd.writeJSON(out)
+}
+
+// writeReach writes the results of a -reach query to cmd.Out.
+func (cmd *scanCmd) writeReach(maps []*scan.Map, query []string) error {
+	m := reach.New(maps)
+	var all []*reach.Path
+	if len(query) == 1 {
+		all = m.Internet()
+	} else {
+		for _, q := range query {
+			if !m.Exists(q) {
+				return errors.Errorf("network interface %q not found", q)
+			}
+		}
+		all = m.Reach(query[0], query[1])
+	}
+	if all == nil {
+		all = []*reach.Path{}
+	}
+	return cmd.writeJSON(all)
+}
+
+// writeReport writes rule evaluation report r to cmd.Out in cmd.Format.
+func (cmd *scanCmd) writeReport(r *check.Report) error {
+	var b []byte
+	var err error
+	switch cmd.Format {
+	case "sarif":
+		b, err = r.SARIF()
+	case "junit":
+		b, err = r.JUnit()
+	default:
+		return cmd.writeJSON(r)
+	}
+	if err != nil {
+		return err
+	}
+	return cli.WriteFile(cmd.Out, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
 // writeJSON writes the JSON encoding of v to cmd.Out.
 func (cmd *scanCmd) writeJSON(v interface{}) error {
-	return cli.WriteFile(cmd.Out, func(w io.Writer) error {
+	return cmd.writeJSONFile(cmd.Out, v)
+}
+
+// writeJSONFile writes the JSON encoding of v to the named file.
+func (cmd *scanCmd) writeJSONFile(name string, v interface{}) error {
+	return cli.WriteFile(name, func(w io.Writer) error {
 		enc := json.NewEncoder(w)
 		if enc.SetEscapeHTML(false); !cmd.Min {
 			enc.SetIndent("", "\t")
@@ -303,11 +1143,60 @@ func (cmd *scanCmd) writeJSON(v interface{}) error {
 	})
 }
 
+// writeMetrics writes m to cmd.Metrics file, if set.
+func (cmd *scanCmd) writeMetrics(m *scan.Metrics) error {
+	if cmd.Metrics == "" {
+		return nil
+	}
+	return cli.WriteFile(cmd.Metrics, func(w io.Writer) error {
+		_, err := m.WriteTo(w)
+		return err
+	})
+}
+
+// writeTFConfig writes Terraform configuration for all resources in s to the
+// cmd.TFConfig directory.
+func (cmd *scanCmd) writeTFConfig(maps []*scan.Map, s *tf.State) error {
+	files, err := tfgen.Config(maps, s)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(cmd.TFConfig, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	for name, b := range files {
+		err = ioutil.WriteFile(filepath.Join(cmd.TFConfig, name), b, 0644)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 // keyGenFunc returns hierarchy keys for the given call.
 type keyGenFunc func(m *scan.Map, api string, c *scan.Call) []string
 
 // parseHier returns the hierarchy key generator function for the given spec.
 func parseHier(spec string) (keyGenFunc, error) {
+	spec, err := expandHier(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func(m *scan.Map, api string, c *scan.Call) []string {
+		keys := strings.NewReplacer(
+			"{account}", m.Account,
+			"{region}", m.Region,
+			"{service}", m.Service,
+			"{api}", api,
+			"{id}", c.ID,
+		).Replace(spec)
+		return strings.Split(keys, ",")
+	}, nil
+}
+
+// expandHier converts a hierarchy depth into the equivalent spec and validates
+// other specs.
+func expandHier(spec string) (string, error) {
 	if depth, err := strconv.Atoi(spec); err == nil {
 		keys := []string{"{account}", "{region}", "{service}", "{api}", "{id}"}
 		if depth <= 0 {
@@ -320,18 +1209,115 @@ func parseHier(spec string) (keyGenFunc, error) {
 			spec = strings.Join(append(keys[:1], keys[i:]...), ",")
 		}
 	} else if !strings.Contains(spec, "{id}") {
-		return nil, errors.New(`hierarchy spec must contain "{id}"`)
+		return "", errors.New(`hierarchy spec must contain "{id}"`)
 	}
-	return func(m *scan.Map, api string, c *scan.Call) []string {
-		keys := strings.NewReplacer(
-			"{account}", m.Account,
-			"{region}", m.Region,
-			"{service}", m.Service,
-			"{api}", api,
-			"{id}", c.ID,
-		).Replace(spec)
-		return strings.Split(keys, ",")
-	}, nil
+	return spec, nil
+}
+
+// loadScan loads uncompacted scan results from the named file, which must use
+// hierarchy spec.
+func loadScan(file, spec string) ([]*scan.Map, error) {
+	spec, err := expandHier(spec)
+	if err != nil {
+		return nil, err
+	}
+	pat := regexp.QuoteMeta(spec)
+	for _, k := range []string{"account", "region", "service", "api"} {
+		p := regexp.QuoteMeta("{" + k + "}")
+		if !strings.Contains(pat, p) {
+			return nil, errors.Errorf("saved scan requires {%s} in hierarchy spec", k)
+		}
+		pat = strings.Replace(pat, p, "(?P<"+k+">[^/,.]+)", 1)
+	}
+	pat = strings.Replace(pat, regexp.QuoteMeta("{id}"), "(?P<id>.+)", 1)
+	re, err := regexp.Compile("^" + pat + "$")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read saved scan")
+	}
+	idx := make(map[string]*scan.Map)
+	var maps []*scan.Map
+	var walk func(keys []string, b []byte) error
+	walk = func(keys []string, b []byte) error {
+		if len(keys) == strings.Count(spec, ",")+1 {
+			m := re.FindStringSubmatch(strings.Join(keys, ","))
+			if m == nil {
+				return errors.Errorf("invalid saved scan key %q",
+					strings.Join(keys, ","))
+			}
+			v := make(map[string]string, len(m))
+			for i, name := range re.SubexpNames() {
+				v[name] = m[i]
+			}
+			c, err := scan.DecodeCall(v["service"], v["api"], b)
+			if err != nil {
+				return err
+			}
+			c.ID = v["id"]
+			ars := v["account"] + "/" + v["region"] + "/" + v["service"]
+			sm := idx[ars]
+			if sm == nil {
+				sm = &scan.Map{
+					Ctx: arn.Ctx{
+						Partition: region.Partition(v["region"]),
+						Region:    v["region"],
+						Account:   v["account"],
+					},
+					Service: v["service"],
+					Calls:   make(map[string][]*scan.Call),
+				}
+				idx[ars] = sm
+				maps = append(maps, sm)
+			}
+			sm.Calls[v["api"]] = append(sm.Calls[v["api"]], c)
+			return nil
+		}
+		var h map[string]json.RawMessage
+		if err := json.Unmarshal(b, &h); err != nil {
+			return errors.Wrap(err, "invalid saved scan")
+		}
+		for k, b := range h {
+			if strings.HasPrefix(k, "#") {
+				continue // Stats, truncation, and cost
+			}
+			if err := walk(append(keys[:len(keys):len(keys)], k), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = walk(nil, b)
+	return maps, err
+}
+
+// parseLimit returns the default limit and API-specific limits from the
+// spec.
+func parseLimit(flag, spec string) (max int, apis map[string]int, err error) {
+	for _, lim := range strings.Split(spec, ",") {
+		api, n := "", lim
+		if i := strings.IndexByte(lim, '='); i >= 0 {
+			api, n = lim[:i], lim[i+1:]
+			if !strings.Contains(api, ".") {
+				return 0, nil, errors.Errorf("invalid %s API %q", flag, api)
+			}
+		}
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			return 0, nil, errors.Errorf("invalid %s %q", flag, lim)
+		}
+		if api == "" {
+			max = v
+		} else {
+			if apis == nil {
+				apis = make(map[string]int)
+			}
+			apis[api] = v
+		}
+	}
+	return
 }
 
 // getServices extracts service names from the spec.
@@ -478,9 +1464,38 @@ func makeHier(maps []*scan.Map, keyGen keyGenFunc, stats bool) hier {
 		addStats(root)
 		root[key].(*scan.Stats).RoundTimes()
 	}
+	for _, m := range maps {
+		for api, n := range m.Truncated {
+			t, _ := root["#truncated"].(map[string]int)
+			if t == nil {
+				t = make(map[string]int)
+				root["#truncated"] = t
+			}
+			t[m.Account+"/"+m.Region+"/"+m.Service+"."+api] = n
+		}
+	}
 	return root
 }
 
+// warnTimeouts writes a summary of calls that timed out to stderr.
+func warnTimeouts(maps []*scan.Map) {
+	n := scan.TimedOut(maps)
+	if len(n) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(n))
+	total := 0
+	for k, v := range n {
+		keys = append(keys, k)
+		total += v
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(os.Stderr, "Warning: %d call(s) timed out, results are incomplete:\n", total)
+	for _, k := range keys {
+		fmt.Fprintf(os.Stderr, "  %s: %d\n", k, n[k])
+	}
+}
+
 // apiErr returns the first API error in m.
 func apiErr(maps []*scan.Map) error {
 	return scan.Walk(maps, func(m *scan.Map, api string, c *scan.Call) error {
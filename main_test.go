@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScan(t *testing.T) {
+	const bob = "arn:aws:iam::123:user/bob"
+	users := []iam.User{{Arn: aws.String(bob), UserName: aws.String("bob")}}
+	dir, err := ioutil.TempDir("", "awsscan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	maps := []*scan.Map{{
+		Ctx:     arn.Ctx{Partition: "aws", Region: "aws-global", Account: "123"},
+		Service: "iam",
+		Calls: map[string][]*scan.Call{
+			"ListUsers": {{
+				ID:  "a/b+c=",
+				In:  &iam.ListUsersInput{},
+				Out: []interface{}{&iam.ListUsersOutput{Users: users}},
+			}},
+			"ListUserPolicies": {{
+				ID:  "d",
+				Src: map[string]int{"a/b+c=": 0},
+				In:  &iam.ListUserPoliciesInput{UserName: aws.String("bob")},
+				Err: &scan.Err{Status: 404, Code: "NoSuchEntity", Ignore: true},
+			}},
+		},
+	}}
+	makeValues(maps)
+	save := func(spec string) string {
+		keyGen, err := parseHier(spec)
+		require.NoError(t, err)
+		b, err := json.Marshal(makeHier(maps, keyGen, false))
+		require.NoError(t, err)
+		file := filepath.Join(dir, "prev.json")
+		require.NoError(t, ioutil.WriteFile(file, b, 0666))
+		return file
+	}
+	for _, spec := range []string{"{account}/{region}/{service}.{api},{id}", "0", "4"} {
+		prev, err := loadScan(save(spec), spec)
+		require.NoError(t, err, "%s", spec)
+		require.Len(t, prev, 1)
+		m := prev[0]
+		assert.Equal(t, "aws", m.Partition)
+		assert.Equal(t, "123", m.Account)
+		assert.Equal(t, "aws-global", m.Region)
+		assert.Equal(t, "iam", m.Service)
+		lu := m.Calls["ListUsers"]
+		require.Len(t, lu, 1)
+		assert.Equal(t, "a/b+c=", lu[0].ID)
+		assert.Equal(t, &iam.ListUsersInput{}, lu[0].In)
+		assert.Equal(t, []interface{}{&iam.ListUsersOutput{
+			Users: []iam.User{{Arn: aws.String(bob), UserName: aws.String("bob")}},
+		}}, lu[0].Out)
+		lup := m.Calls["ListUserPolicies"]
+		require.Len(t, lup, 1)
+		assert.Equal(t, map[string]int{"a/b+c=": 0}, lup[0].Src)
+		assert.Equal(t, &scan.Err{Status: 404, Code: "NoSuchEntity", Ignore: true}, lup[0].Err)
+	}
+	_, err = loadScan(save("{account}/{service}.{api},{id}"), "{account}/{service}.{api},{id}")
+	assert.Error(t, err)
+
+	// Offline analysis of a saved scan
+	cmd := &scanCmd{
+		Hier:    "{account}/{region}/{service}.{api},{id}",
+		IAMEval: "all",
+		Load:    save("{account}/{region}/{service}.{api},{id}"),
+		Out:     filepath.Join(dir, "out.json"),
+	}
+	require.NoError(t, cmd.Main(nil))
+	b, err := ioutil.ReadFile(cmd.Out)
+	require.NoError(t, err)
+	var out []struct{ Principal string }
+	require.NoError(t, json.Unmarshal(b, &out))
+	require.Len(t, out, 1)
+	assert.Equal(t, bob, out[0].Principal)
+	cmd = &scanCmd{Load: cmd.Load}
+	assert.Error(t, cmd.Main(nil), "-load without analysis")
+}
+
+func TestParseArgs(t *testing.T) {
+	var cmd scanCmd
+	require.NoError(t, cmd.parseArgs([]string{"serve", "localhost:8080", "-workers", "8"}))
+	assert.Equal(t, scanCmd{Serve: "localhost:8080", Workers: 8}, cmd)
+
+	cmd = scanCmd{}
+	require.NoError(t, cmd.parseArgs([]string{"check", "scan.json", "-format", "sarif"}))
+	assert.Equal(t, scanCmd{Check: "security", Format: "sarif", Load: "scan.json"}, cmd)
+
+	cmd = scanCmd{Reach: "internet"}
+	require.NoError(t, cmd.parseArgs([]string{"check", "scan.json"}))
+	assert.Equal(t, scanCmd{Load: "scan.json", Reach: "internet"}, cmd)
+
+	cmd = scanCmd{}
+	require.NoError(t, cmd.parseArgs([]string{"daemon", "-interval", "1h"}))
+	assert.Equal(t, scanCmd{Events: "-", Interval: time.Hour}, cmd)
+
+	cmd = scanCmd{Events: "x.json"}
+	require.NoError(t, cmd.parseArgs([]string{"daemon", "-interval", "1m"}))
+	assert.Equal(t, scanCmd{Events: "x.json", Interval: time.Minute}, cmd)
+
+	for _, args := range [][]string{
+		{"serve"},
+		{"serve", "a", "b"},
+		{"serve", "a", "-serve", "b"},
+		{"check", "a", "-load", "b"},
+		{"check", "a", "-x"},
+		{"daemon"},
+		{"daemon", "x"},
+		{"scan", "a"},
+	} {
+		cmd = scanCmd{}
+		assert.Error(t, cmd.parseArgs(args), "%q", args)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mxk/awsscan/scan"
+)
+
+// detailSignals request a per-service progress breakdown. They are set by
+// platform-specific files.
+var detailSignals []os.Signal
+
+// progressWriter writes scan progress reports as a single updating line when w
+// is a terminal, or as JSON lines otherwise.
+type progressWriter struct {
+	w   io.Writer
+	tty bool
+	enc *json.Encoder
+}
+
+// newProgress returns scan progress configuration that writes reports to
+// stderr. The returned function must be called to stop signal delivery once
+// the scan is done.
+func newProgress() (*scan.Progress, func()) {
+	pw := &progressWriter{w: os.Stderr}
+	interval := 10 * time.Second
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		pw.tty, interval = true, time.Second
+	} else {
+		pw.enc = json.NewEncoder(os.Stderr)
+	}
+	p := &scan.Progress{Interval: interval, Report: pw.report}
+	if len(detailSignals) == 0 {
+		return p, func() {}
+	}
+	sig := make(chan os.Signal, 1)
+	detail := make(chan struct{}, 1)
+	signal.Notify(sig, detailSignals...)
+	go func() {
+		for range sig {
+			select {
+			case detail <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	p.Detail = detail
+	return p, func() {
+		signal.Stop(sig)
+		close(sig)
+	}
+}
+
+// report writes one progress report.
+func (pw *progressWriter) report(st *scan.Status) {
+	if !pw.tty {
+		pw.enc.Encode(st)
+		return
+	}
+	// Clear the current line before writing the new status
+	fmt.Fprint(pw.w, "\r\x1b[K")
+	if len(st.Services) > 0 {
+		fmt.Fprintf(pw.w, "%-24s %-18s %7s %7s %7s\n",
+			"SERVICE", "REGION", "TOTAL", "READY", "RUNNING")
+		for _, cs := range st.Services {
+			fmt.Fprintf(pw.w, "%-24s %-18s %7d %7d %7d\n",
+				cs.Service, cs.Region, cs.Total, cs.Ready, cs.Running)
+		}
+	}
+	fmt.Fprintf(pw.w, "[%s] %d/%d calls done, %d ready, %d running, "+
+		"%d errors, %d throttles, %.1f calls/s, %d contexts left",
+		time.Duration(st.Elapsed*float64(time.Second)).Round(time.Second),
+		st.Done, st.Total, st.Ready, st.Running, st.Errors, st.Throttles,
+		st.Rate, st.Contexts)
+	if st.Final {
+		fmt.Fprintln(pw.w)
+	}
+}
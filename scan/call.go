@@ -2,8 +2,10 @@ package scan
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"hash"
 	"math"
 	"reflect"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/pkg/errors"
 )
 
 // Call is one specific instance of an API call.
@@ -22,8 +25,13 @@ type Call struct {
 	Out   []interface{}  `json:"out,omitempty"`    // API *Output struct
 	Err   *Err           `json:"err,omitempty"`    // Decoded error
 
-	bat *batch
-	req *aws.Request
+	bat       *batch
+	req       *aws.Request
+	ready     time.Time // Time when the call became ready for execution
+	throttles int       // Number of throttled requests
+	span      *Span     // Trace span
+	reuse     bool      // Inputs were derived from unchanged outputs
+	same      []bool    // Output pages that match the previous scan
 }
 
 // id generates a base64-encoded SHA-512/256 call ID. The hashed string is:
@@ -59,19 +67,187 @@ func (c *Call) exec() {
 
 	// TODO: Let scanner deal with throttling, don't block workers
 
+	// Apply scan and call timeouts
+	sc := c.bat.ctx.sc
+	if sc == nil {
+		sc = context.Background()
+	}
+	if sc.Err() != nil {
+		c.Err = newTimeoutErr("scan timed out before call was made", nil)
+		return
+	}
+	cc := sc
+	if tmo := c.bat.ctx.ctmo; tmo > 0 {
+		var cancel context.CancelFunc
+		cc, cancel = context.WithTimeout(sc, tmo)
+		defer cancel()
+	}
+
 	// Pager also works for non-paginated APIs
+	m := c.bat.ctx.metrics
+	var start time.Time
+	var requests, retries, page int
 	p := aws.Pager{NewRequest: func() (*aws.Request, error) {
 		c.req = c.bat.lnk.req.Call(in)[0].Field(0).Interface().(*aws.Request)
+		c.req.SetContext(cc)
 		c.bat.ctx.iface.UpdateRequest(c.req)
+		c.bat.ctx.tracer.traceAttempts(c, c.req, page)
+		page++
+		c.req.Handlers.Retry.PushBack(func(r *aws.Request) {
+			if r.IsErrorThrottle() {
+				c.throttles++
+			}
+		})
 		c.Stats.request()
+		start = time.Now()
 		return c.req, nil
 	}}
-	for p.Next() {
+	response := func() {
 		c.Stats.response(c.req)
+		m.request(c, time.Since(start))
+		requests += 1 + c.req.RetryCount
+		retries += c.req.RetryCount
+	}
+	for p.Next() {
+		response()
 		c.Out = append(c.Out, p.CurrentPage())
 	}
 	if c.Err = decodeErr(p.Err()); c.Err != nil {
-		c.Stats.response(c.req)
+		response()
+	}
+	if c.Err != nil && cc.Err() != nil {
+		msg := "call timed out after " + c.bat.ctx.ctmo.String()
+		if sc.Err() != nil {
+			msg = "scan timed out"
+		}
+		c.Err = newTimeoutErr(msg, c.Err)
+	}
+	m.exec(c, requests, retries)
+}
+
+// reusePrev copies the result of the same call from the previous scan if the
+// call inputs were derived from unchanged outputs and the API is not volatile.
+// It returns false if the call must be executed. Previous errors are only
+// reused if they were ignored.
+func (c *Call) reusePrev() bool {
+	if !c.reuse || c.bat.lnk.volatile {
+		return false
+	}
+	p := c.bat.ctx.prev[c.ID]
+	if p == nil || p.Err != nil && !p.Err.Ignore {
+		return false
+	}
+	c.Out = p.Out
+	if p.Err != nil {
+		err := *p.Err
+		c.Err = &err
+	}
+	c.same = make([]bool, len(c.Out))
+	for i := range c.same {
+		c.same[i] = true
+	}
+	c.Stats.reused()
+	return true
+}
+
+// comparePrev determines which output pages of an executed call are the same
+// as those of the previous scan.
+func (c *Call) comparePrev() {
+	p := c.bat.ctx.prev[c.ID]
+	if p == nil {
+		return
+	}
+	c.same = make([]bool, len(c.Out))
+	for i := range c.same {
+		if i < len(p.Out) {
+			a, err1 := json.Marshal(c.Out[i])
+			b, err2 := json.Marshal(p.Out[i])
+			c.same[i] = err1 == nil && err2 == nil && bytes.Equal(a, b)
+		}
+	}
+}
+
+// DecodeCall decodes the JSON encoding of an uncompacted call to the specified
+// service API, restoring SDK Input/Output struct types, so that a saved scan
+// can be used as Opts.Prev. Empty slices and maps are decoded as nil to match
+// new call results. The call ID is not encoded and must be set by the caller.
+func DecodeCall(service, api string, b []byte) (*Call, error) {
+	svc := svcRegistry.get()[service]
+	if svc == nil || svc.api[api] == nil {
+		return nil, errors.Errorf("unknown API %s:%s", service, api)
+	}
+	req := svc.api[api][0].req.Type() // func(*Client, *AbcInput) AbcRequest
+	in := req.In(1).Elem()
+	out := getMethod(req.Out(0), "Send").Type.Out(0).Elem()
+	var v struct {
+		Src map[string]int    `json:"src"`
+		In  json.RawMessage   `json:"in"`
+		Out []json.RawMessage `json:"out"`
+		Err *Err              `json:"err"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s:%s call", service, api)
+	}
+	decode := func(t reflect.Type, b json.RawMessage) (interface{}, error) {
+		p := reflect.New(t)
+		if err := json.Unmarshal(b, p.Interface()); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s:%s call", service, api)
+		}
+		clearEmpty(p)
+		return p.Interface(), nil
+	}
+	c := &Call{Src: v.Src, Err: v.Err}
+	var err error
+	if c.In, err = decode(in, v.In); err != nil {
+		return nil, err
+	}
+	if len(v.Out) > 0 {
+		c.Out = make([]interface{}, len(v.Out))
+		for i, b := range v.Out {
+			if c.Out[i], err = decode(out, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// clearEmpty replaces empty slices and maps reachable from v with nil.
+func clearEmpty(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			clearEmpty(v.Elem())
+		}
+	case reflect.Map:
+		if v.Len() == 0 {
+			if v.CanSet() && !v.IsNil() {
+				v.Set(reflect.Zero(v.Type()))
+			}
+			return
+		}
+		tmp := reflect.New(v.Type().Elem()).Elem()
+		for _, k := range v.MapKeys() {
+			tmp.Set(v.MapIndex(k))
+			clearEmpty(tmp)
+			v.SetMapIndex(k, tmp)
+		}
+	case reflect.Slice:
+		if v.Len() == 0 {
+			if v.CanSet() && !v.IsNil() {
+				v.Set(reflect.Zero(v.Type()))
+			}
+			return
+		}
+		for i := v.Len() - 1; i >= 0; i-- {
+			clearEmpty(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := v.NumField() - 1; i >= 0; i-- {
+			if f := v.Field(i); f.CanSet() {
+				clearEmpty(f)
+			}
+		}
 	}
 }
 
@@ -88,6 +264,15 @@ type Err struct {
 	err error // Original error
 }
 
+// ErrCodeTimeout is the Err.Code of calls that were aborted by a call or scan
+// timeout. Any outputs received before the timeout are kept.
+const ErrCodeTimeout = "Timeout"
+
+// newTimeoutErr returns a new timeout error with an optional cause.
+func newTimeoutErr(msg string, cause *Err) *Err {
+	return &Err{Code: ErrCodeTimeout, Message: msg, Cause: cause, err: errors.New(msg)}
+}
+
 // decodeErr converts a non-nil err into a new Err instance.
 func decodeErr(err error) *Err {
 	if err == nil {
@@ -109,9 +294,24 @@ func decodeErr(err error) *Err {
 	return &Err{Message: err.Error(), err: err}
 }
 
-// String implements fmt.Stringer interface.
+// String implements fmt.Stringer interface. Errors decoded from JSON or copied
+// from a saved scan do not have the original error, so their text is built
+// from the exported fields in the same format as awserr.
 func (e *Err) String() string {
-	return e.err.Error()
+	if e.err != nil {
+		return e.err.Error()
+	}
+	s := e.Message
+	if e.Code != "" {
+		s = e.Code + ": " + s
+	}
+	if e.Status != 0 || e.RequestID != "" {
+		s += fmt.Sprintf("\n\tstatus code: %d, request id: %s", e.Status, e.RequestID)
+	}
+	if e.Cause != nil {
+		s += "\ncaused by: " + e.Cause.String()
+	}
+	return s
 }
 
 // Stats contains performance information for one or more calls. All times are
@@ -121,6 +321,7 @@ type Stats struct {
 	Requests int // Total number of requests
 	Retries  int // Number of retried requests
 	Errors   int // Number of terminal, non-ignored errors
+	Reused   int // Number of calls copied from a previous scan
 
 	QueueTime    float64 // Time spent waiting for a worker
 	ExecTime     float64 // Execution time (to worker and back)
@@ -140,6 +341,7 @@ func (s *Stats) Combine(t *Stats) {
 	s.Requests += t.Requests
 	s.Retries += t.Retries
 	s.Errors += t.Errors
+	s.Reused += t.Reused
 	s.QueueTime += t.QueueTime
 	s.ExecTime += t.ExecTime
 	if t.MaxRoundTrip > s.MaxRoundTrip {
@@ -181,6 +383,13 @@ func (s *Stats) exec() {
 	}
 }
 
+// reused records a call copied from a previous scan.
+func (s *Stats) reused() {
+	if s != nil {
+		s.Reused++
+	}
+}
+
 // request starts the round trip timer.
 func (s *Stats) request() {
 	if s != nil {
@@ -62,6 +62,14 @@ func TestErr(t *testing.T) {
 	}
 	assert.Equal(t, &want, decodeErr(req))
 	assert.Equal(t, "short and stout", want.Cause.String())
+
+	// Decoded errors do not have the original error
+	b, err2 := json.Marshal(&want)
+	require.NoError(t, err2)
+	var dec Err
+	require.NoError(t, json.Unmarshal(b, &dec))
+	assert.Equal(t, req.Error(), dec.String())
+	assert.Equal(t, "Timeout: call timed out", (&Err{Code: "Timeout", Message: "call timed out"}).String())
 }
 
 func TestStats(t *testing.T) {
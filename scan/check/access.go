@@ -0,0 +1,220 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// Resource policies and role trust policies that grant access to principals
+// outside of the scanned accounts.
+var _ = Register("access",
+	&Rule{
+		ID:       "external-principal",
+		Title:    "Resource and trust policies do not grant access to external accounts",
+		Severity: Medium,
+		Eval:     externalPrincipal,
+	},
+	&Rule{
+		ID:       "public-principal",
+		Title:    "Resource and trust policies do not grant access to all principals",
+		Severity: High,
+		Eval:     publicPrincipal,
+	},
+)
+
+func externalPrincipal(ctx *Ctx) {
+	accts := scannedAccounts(ctx)
+	eachResourcePolicy(ctx, func(res arn.ARN, doc *policy.Doc) {
+		for i, s := range doc.Statement {
+			if s.Effect != policy.Allow {
+				continue
+			}
+			for _, p := range externalPrincipals(s, accts) {
+				ctx.Fail(res, "%s granted access by statement %s%s",
+					p, sid(s, i), conditional(s))
+			}
+		}
+	})
+}
+
+func publicPrincipal(ctx *Ctx) {
+	eachResourcePolicy(ctx, func(res arn.ARN, doc *policy.Doc) {
+		for i, s := range doc.Statement {
+			if s.Effect != policy.Allow {
+				continue
+			}
+			if s.Principal.Any() {
+				ctx.Fail(res, "all principals granted access by statement %s%s",
+					sid(s, i), conditional(s))
+			} else if len(s.NotPrincipal) > 0 {
+				ctx.Fail(res, "all principals except NotPrincipal granted access by statement %s%s",
+					sid(s, i), conditional(s))
+			}
+		}
+	})
+}
+
+// eachResourcePolicy calls fn for every resource or trust policy in the scan
+// results. Invalid policies are reported as findings.
+func eachResourcePolicy(ctx *Ctx, fn func(res arn.ARN, doc *policy.Doc)) {
+	parse := func(res arn.ARN, doc *string) {
+		if doc == nil || res == "" {
+			return
+		}
+		d, err := policy.Parse(*doc)
+		if err != nil {
+			ctx.Fail(res, "invalid policy: %v", err)
+			return
+		}
+		fn(res, d)
+	}
+	ctx.Each(func(out *iam.ListRolesOutput) {
+		if out != nil {
+			for _, r := range out.Roles {
+				parse(arn.Value(r.Arn), r.AssumeRolePolicyDocument)
+			}
+		}
+	})
+	ctx.Each(func(out *s3.GetBucketPolicyOutput) {
+		if out != nil {
+			parse(bucketARN(ctx), out.Policy)
+		}
+	})
+	ctx.Each(func(out *kms.GetKeyPolicyOutput) {
+		if out != nil {
+			id := aws.StringValue(ctx.Call().In.(*kms.GetKeyPolicyInput).KeyId)
+			parse(ctx.Map().New("kms", "key/", id), out.Policy)
+		}
+	})
+	ctx.Each(func(out *lambda.GetPolicyOutput) {
+		if out != nil {
+			parse(functionARN(ctx), out.Policy)
+		}
+	})
+	ctx.Each(func(out *sqs.GetQueueAttributesOutput) {
+		if out != nil {
+			parse(arn.ARN(out.Attributes["QueueArn"]), attr(out.Attributes, "Policy"))
+		}
+	})
+	ctx.Each(func(out *sns.GetTopicAttributesOutput) {
+		if out != nil {
+			parse(arn.ARN(out.Attributes["TopicArn"]), attr(out.Attributes, "Policy"))
+		}
+	})
+	ctx.Each(func(out *cloudwatchlogs.DescribeDestinationsOutput) {
+		if out != nil {
+			for _, d := range out.Destinations {
+				parse(arn.Value(d.Arn), d.AccessPolicy)
+			}
+		}
+	})
+	ctx.Each(func(out *cloudwatchlogs.DescribeResourcePoliciesOutput) {
+		if out != nil {
+			for _, p := range out.ResourcePolicies {
+				// Resource policies do not have ARNs
+				res := ctx.Map().New("logs", "resource-policy:", aws.StringValue(p.PolicyName))
+				parse(res, p.PolicyDocument)
+			}
+		}
+	})
+}
+
+// functionARN returns the ARN of the Lambda function or alias accessed by the
+// current call.
+func functionARN(ctx *Ctx) arn.ARN {
+	in := ctx.Call().In.(*lambda.GetPolicyInput)
+	name := aws.StringValue(in.FunctionName)
+	r := arn.ARN(name)
+	if !strings.HasPrefix(name, "arn:") {
+		r = ctx.Map().New("lambda", "function:", name)
+	}
+	if q := aws.StringValue(in.Qualifier); q != "" {
+		r += arn.ARN(":" + q)
+	}
+	return r
+}
+
+// attr returns a pointer to the value of a non-empty attribute or nil.
+func attr(attrs map[string]string, name string) *string {
+	if v := attrs[name]; v != "" {
+		return &v
+	}
+	return nil
+}
+
+// scannedAccounts returns the set of all accounts in the scan results.
+func scannedAccounts(ctx *Ctx) map[string]bool {
+	accts := make(map[string]bool)
+	for _, m := range ctx.Maps {
+		accts[m.Account] = true
+	}
+	return accts
+}
+
+// accountID matches 12-digit AWS account IDs.
+var accountID = regexp.MustCompile(`^\d{12}$`)
+
+// externalPrincipals returns descriptions of all principals in s that are not
+// part of the scanned accounts in sorted order. Service principals and the
+// anonymous principal are not included.
+func externalPrincipals(s *policy.Statement, accts map[string]bool) []string {
+	var out []string
+	for _, p := range s.Principal["AWS"] {
+		switch {
+		case p == "*":
+		case accountID.MatchString(p):
+			if !accts[p] {
+				out = append(out, "account "+p)
+			}
+		case strings.HasPrefix(p, "arn:"):
+			if a := arn.ARN(p).Account(); !accts[a] {
+				out = append(out, p)
+			}
+		default:
+			// Unique ID of a deleted principal or an unknown format
+			out = append(out, "unknown principal "+p)
+		}
+	}
+	for _, p := range s.Principal["Federated"] {
+		if strings.HasPrefix(p, "arn:") {
+			if a := arn.ARN(p).Account(); !accts[a] {
+				out = append(out, p)
+			}
+		} else if p != "cognito-identity.amazonaws.com" {
+			out = append(out, "federated "+p)
+		}
+	}
+	for _, p := range s.Principal["CanonicalUser"] {
+		out = append(out, "canonical user "+p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// conditional returns a message suffix for statements that have conditions.
+func conditional(s *policy.Statement) string {
+	if len(s.Condition) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(s.Condition))
+	for op, kv := range s.Condition {
+		for k := range kv {
+			keys = append(keys, fmt.Sprintf("%s %s", op, k))
+		}
+	}
+	sort.Strings(keys)
+	return " with conditions (" + strings.Join(keys, ", ") + ")"
+}
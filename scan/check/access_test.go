@@ -0,0 +1,143 @@
+package check
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccess(t *testing.T) {
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "111111111111"}
+	newMap := func(svc string, calls map[string][]*scan.Call) *scan.Map {
+		return &scan.Map{Ctx: ac, Service: svc, Calls: calls}
+	}
+	out := func(v ...interface{}) []interface{} { return v }
+	trust := url.QueryEscape(`{"Statement":[{
+		"Effect": "Allow",
+		"Principal": {"AWS": ["arn:aws:iam::222222222222:root", "arn:aws:iam::333333333333:role/x"]},
+		"Action": "sts:AssumeRole",
+		"Condition": {"StringEquals": {"sts:ExternalId": "secret"}}
+	}, {
+		"Effect": "Allow",
+		"Principal": {"Service": "ec2.amazonaws.com", "Federated": "accounts.google.com"},
+		"Action": "sts:AssumeRoleWithWebIdentity"
+	}]}`)
+	maps := []*scan.Map{
+		newMap("iam", map[string][]*scan.Call{
+			"ListRoles": {{
+				ID: "roles",
+				Out: out(&iam.ListRolesOutput{Roles: []iam.Role{{
+					Arn:                      aws.String("arn:aws:iam::111111111111:role/cross"),
+					AssumeRolePolicyDocument: aws.String(trust),
+				}}}),
+			}},
+		}),
+		newMap("kms", map[string][]*scan.Call{
+			"GetKeyPolicy": {{
+				ID: "key",
+				In: &kms.GetKeyPolicyInput{KeyId: aws.String("k")},
+				Out: out(&kms.GetKeyPolicyOutput{Policy: aws.String(`{"Statement":[{
+					"Sid": "Owner",
+					"Effect": "Allow",
+					"Principal": {"AWS": "111111111111"},
+					"Action": "kms:*",
+					"Resource": "*"
+				}, {
+					"Sid": "Deny",
+					"Effect": "Deny",
+					"Principal": "*",
+					"Action": "kms:*"
+				}]}`)}),
+			}},
+		}),
+		newMap("lambda", map[string][]*scan.Call{
+			"GetPolicy": {{
+				ID: "fn",
+				In: &lambda.GetPolicyInput{FunctionName: aws.String("fn"), Qualifier: aws.String("live")},
+				Out: out(&lambda.GetPolicyOutput{Policy: aws.String(`{"Statement":{
+					"Sid": "S3",
+					"Effect": "Allow",
+					"Principal": {"Service": "s3.amazonaws.com"},
+					"Action": "lambda:InvokeFunction",
+					"Condition": {"ArnLike": {"AWS:SourceArn": "arn:aws:s3:::b"}}
+				}}`)}),
+			}},
+		}),
+		newMap("sqs", map[string][]*scan.Call{
+			"GetQueueAttributes": {{
+				ID: "queue",
+				Out: out(&sqs.GetQueueAttributesOutput{Attributes: map[string]string{
+					"QueueArn": "arn:aws:sqs:us-east-1:111111111111:q",
+					"Policy": `{"Statement":[{
+						"Sid": "Public",
+						"Effect": "Allow",
+						"Principal": {"AWS": "*"},
+						"Action": "sqs:SendMessage"
+					}]}`,
+				}}),
+			}},
+		}),
+		newMap("cloudwatchlogs", map[string][]*scan.Call{
+			"DescribeDestinations": {{
+				ID: "dest",
+				Out: out(&cloudwatchlogs.DescribeDestinationsOutput{
+					Destinations: []cloudwatchlogs.Destination{{
+						Arn:          aws.String("arn:aws:logs:us-east-1:111111111111:destination:d"),
+						AccessPolicy: aws.String(`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"444444444444"},"Action":"logs:PutSubscriptionFilter"}]}`),
+					}},
+				}),
+			}},
+		}),
+	}
+	rules, err := Rules("access")
+	require.NoError(t, err)
+	r := Run(maps, rules)
+	require.Len(t, r.Results, 2)
+
+	type finding struct{ res, msg, evidence string }
+	get := func(res *Result) (all []finding) {
+		for _, f := range res.Findings {
+			all = append(all, finding{string(f.Resource), f.Message, f.Evidence})
+		}
+		return
+	}
+	assert.Equal(t, []finding{{
+		"arn:aws:iam::111111111111:role/cross",
+		"arn:aws:iam::222222222222:root granted access by statement #0 with conditions (StringEquals sts:ExternalId)",
+		"roles",
+	}, {
+		"arn:aws:iam::111111111111:role/cross",
+		"arn:aws:iam::333333333333:role/x granted access by statement #0 with conditions (StringEquals sts:ExternalId)",
+		"roles",
+	}, {
+		"arn:aws:iam::111111111111:role/cross",
+		"federated accounts.google.com granted access by statement #1",
+		"roles",
+	}, {
+		"arn:aws:logs:us-east-1:111111111111:destination:d",
+		"account 444444444444 granted access by statement #0",
+		"dest",
+	}}, get(r.Results[0]))
+	assert.Equal(t, []finding{{
+		"arn:aws:sqs:us-east-1:111111111111:q",
+		`all principals granted access by statement "Public"`,
+		"queue",
+	}}, get(r.Results[1]))
+	assert.Equal(t, []string{"dest", "fn", "key", "queue", "roles"}, r.Results[0].Evidence)
+	assert.Equal(t, arn.ARN("arn:aws:lambda:us-east-1:111111111111:function:fn:live"), func() arn.ARN {
+		var res arn.ARN
+		ctx := &Ctx{Maps: maps, res: new(Result), seen: make(map[string]bool)}
+		ctx.Each(func(*lambda.GetPolicyOutput) { res = functionARN(ctx) })
+		return res
+	}())
+}
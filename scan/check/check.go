@@ -0,0 +1,298 @@
+// Package check evaluates security rules against scan results.
+package check
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/pkg/errors"
+)
+
+// Severity is the importance of a rule finding.
+type Severity int
+
+const (
+	Info Severity = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var severityNames = [...]string{"info", "low", "medium", "high", "critical"}
+
+// String implements fmt.Stringer.
+func (s Severity) String() string {
+	if 0 <= s && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(b []byte) error {
+	for i, name := range severityNames {
+		if string(b) == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return errors.Errorf("invalid severity %q", b)
+}
+
+// Rule is a single check evaluated against scan results.
+type Rule struct {
+	ID       string         `json:"id"`       // Unique rule ID
+	Title    string         `json:"title"`    // Short description of the expected state
+	Severity Severity       `json:"severity"` // Severity of rule findings
+	Eval     func(ctx *Ctx) `json:"-"`        // Evaluation function
+}
+
+// Status is the outcome of rule evaluation.
+type Status string
+
+const (
+	Pass          Status = "pass" // Evidence found, no findings
+	Fail          Status = "fail" // One or more findings
+	NotApplicable Status = "n/a"  // No evidence found
+)
+
+// Finding is one rule violation.
+type Finding struct {
+	Rule     string   `json:"rule"`             // Rule ID
+	Severity Severity `json:"severity"`         // Rule severity
+	Resource arn.ARN  `json:"resource"`         // Non-compliant resource
+	Source   string   `json:"source"`           // "<account>/<region>/<service>.<api>"
+	Evidence string   `json:"evidence"`         // ID of the call that produced the finding
+	Message  string   `json:"message"`          // Finding details
+	Reason   string   `json:"reason,omitempty"` // Suppression reason
+}
+
+// Result contains the outcome of evaluating one rule.
+type Result struct {
+	Rule       string     `json:"rule"`
+	Title      string     `json:"title"`
+	Severity   Severity   `json:"severity"`
+	Status     Status     `json:"status"`
+	Findings   []*Finding `json:"findings,omitempty"`
+	Suppressed []*Finding `json:"suppressed,omitempty"`
+	Evidence   []string   `json:"evidence,omitempty"` // IDs of all examined calls
+}
+
+// setStatus sets result status based on findings and evidence.
+func (res *Result) setStatus() {
+	switch {
+	case len(res.Findings) > 0:
+		res.Status = Fail
+	case len(res.Evidence) > 0 || len(res.Suppressed) > 0:
+		res.Status = Pass
+	default:
+		res.Status = NotApplicable
+	}
+}
+
+// Report contains the results of evaluating one or more rules.
+type Report struct {
+	Results []*Result `json:"results"`
+}
+
+// Findings returns all findings in r.
+func (r *Report) Findings() []*Finding {
+	var all []*Finding
+	for _, res := range r.Results {
+		all = append(all, res.Findings...)
+	}
+	return all
+}
+
+// Run evaluates rules against maps, which must not be compacted.
+func Run(maps []*scan.Map, rules []*Rule) *Report {
+	r := &Report{Results: make([]*Result, 0, len(rules))}
+	for _, rule := range rules {
+		res := &Result{Rule: rule.ID, Title: rule.Title, Severity: rule.Severity}
+		ctx := &Ctx{Maps: maps, rule: rule, res: res, seen: make(map[string]bool)}
+		rule.Eval(ctx)
+		sort.Slice(res.Findings, func(i, j int) bool {
+			a, b := res.Findings[i], res.Findings[j]
+			if a.Resource != b.Resource {
+				return a.Resource < b.Resource
+			}
+			return a.Message < b.Message
+		})
+		sort.Strings(res.Evidence)
+		res.setStatus()
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// Ctx is the evaluation context of one rule.
+type Ctx struct {
+	Maps []*scan.Map
+
+	rule *Rule
+	res  *Result
+	seen map[string]bool
+	m    *scan.Map
+	api  string
+	c    *scan.Call
+}
+
+// Map returns the map being examined by Each or All.
+func (ctx *Ctx) Map() *scan.Map { return ctx.m }
+
+// Call returns the call being examined by Each or All.
+func (ctx *Ctx) Call() *scan.Call { return ctx.c }
+
+// Each calls fn, which must be of type "func(*<svc>.<API>Output)", for every
+// output of the matching API calls in all maps. Calls that produced no outputs
+// (e.g. due to an error) are passed to fn as a nil output. The current map and
+// call are available via ctx.Map() and ctx.Call(). Calls that produced outputs
+// or expected errors are recorded as rule evidence.
+func (ctx *Ctx) Each(fn interface{}) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 ||
+		t.In(0).Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("check: invalid Each func type: %v", t))
+	}
+	out := t.In(0).Elem()
+	svc := path.Base(out.PkgPath())
+	api := strings.TrimSuffix(out.Name(), "Output")
+	if api == out.Name() {
+		panic(fmt.Sprintf("check: invalid output type: %v", out))
+	}
+	nilOut := reflect.Zero(t.In(0))
+	arg := make([]reflect.Value, 1)
+	for _, m := range ctx.Maps {
+		if m.Service != svc {
+			continue
+		}
+		for _, c := range m.Calls[api] {
+			ctx.visit(m, api, c)
+			if len(c.Out) == 0 {
+				arg[0] = nilOut
+				v.Call(arg)
+			}
+			for _, o := range c.Out {
+				arg[0] = reflect.ValueOf(o)
+				v.Call(arg)
+			}
+		}
+	}
+	ctx.m, ctx.api, ctx.c = nil, "", nil
+}
+
+// All calls fn for every call in all maps. The current map and call are
+// available via ctx.Map() and ctx.Call(). Evidence is recorded as in Each.
+func (ctx *Ctx) All(fn func()) {
+	scan.Walk(ctx.Maps, func(m *scan.Map, api string, c *scan.Call) error {
+		ctx.visit(m, api, c)
+		fn()
+		return nil
+	})
+	ctx.m, ctx.api, ctx.c = nil, "", nil
+}
+
+// visit makes c the current call and records it as evidence if it produced
+// outputs or an expected error.
+func (ctx *Ctx) visit(m *scan.Map, api string, c *scan.Call) {
+	ctx.m, ctx.api, ctx.c = m, api, c
+	valid := len(c.Out) > 0 || c.Err == nil || c.Err.Ignore
+	if valid && !ctx.seen[c.ID] {
+		ctx.seen[c.ID] = true
+		ctx.res.Evidence = append(ctx.res.Evidence, c.ID)
+	}
+}
+
+// Ref identifies one call examined by Each or All.
+type Ref struct {
+	m   *scan.Map
+	api string
+	c   *scan.Call
+}
+
+// Ref returns a reference to the call being examined by Each or All, which can be used
+// as evidence for findings reported after Each returns.
+func (ctx *Ctx) Ref() Ref { return Ref{ctx.m, ctx.api, ctx.c} }
+
+// Fail records a finding for resource using the current call as evidence.
+func (ctx *Ctx) Fail(resource arn.ARN, format string, a ...interface{}) {
+	ctx.FailAt(ctx.Ref(), resource, format, a...)
+}
+
+// FailAt records a finding for resource using the referenced call as evidence.
+func (ctx *Ctx) FailAt(r Ref, resource arn.ARN, format string, a ...interface{}) {
+	f := &Finding{
+		Rule:     ctx.rule.ID,
+		Severity: ctx.rule.Severity,
+		Resource: resource,
+		Message:  fmt.Sprintf(format, a...),
+	}
+	if r.c != nil {
+		f.Source = fmt.Sprintf("%s/%s/%s.%s",
+			r.m.Account, r.m.Region, r.m.Service, r.api)
+		f.Evidence = r.c.ID
+	}
+	ctx.res.Findings = append(ctx.res.Findings, f)
+}
+
+// sets contains all registered rule sets.
+var sets = make(map[string][]*Rule)
+
+// Register adds rules to the named rule set. It should only be called from
+// package init functions.
+func Register(set string, rules ...*Rule) struct{} {
+	for _, r := range rules {
+		if r.ID == "" || r.Eval == nil {
+			panic("check: incomplete rule definition")
+		}
+		for _, other := range sets[set] {
+			if other.ID == r.ID {
+				panic("check: duplicate rule " + set + "/" + r.ID)
+			}
+		}
+		sets[set] = append(sets[set], r)
+	}
+	return struct{}{}
+}
+
+// Sets returns the names of all registered rule sets in sorted order.
+func Sets() []string {
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rules returns all rules in the named sets. Rules that belong to multiple sets
+// are returned once.
+func Rules(names ...string) ([]*Rule, error) {
+	var rules []*Rule
+	seen := make(map[*Rule]bool)
+	for _, name := range names {
+		set, ok := sets[name]
+		if !ok {
+			return nil, errors.Errorf("invalid rule set %q", name)
+		}
+		for _, r := range set {
+			if !seen[r] {
+				seen[r] = true
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules, nil
+}
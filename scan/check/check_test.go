@@ -0,0 +1,236 @@
+package check
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeverity(t *testing.T) {
+	b, err := json.Marshal(High)
+	require.NoError(t, err)
+	assert.Equal(t, `"high"`, string(b))
+	var s Severity
+	require.NoError(t, json.Unmarshal([]byte(`"critical"`), &s))
+	assert.Equal(t, Critical, s)
+	assert.Error(t, json.Unmarshal([]byte(`"bad"`), &s))
+	assert.Equal(t, "Severity(9)", Severity(9).String())
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Contains(t, Sets(), "security")
+	rules, err := Rules("security", "security")
+	require.NoError(t, err)
+	assert.Len(t, rules, len(sets["security"]))
+	_, err = Rules("invalid")
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	newMap := func(svc string, calls map[string][]*scan.Call) *scan.Map {
+		m := &scan.Map{Ctx: ac, Service: svc, Calls: calls}
+		if svc == "iam" {
+			m.Region = "aws-global"
+		}
+		return m
+	}
+	out := func(v ...interface{}) []interface{} { return v }
+	key := func(id string, mgr kms.KeyManagerType, st kms.KeyState) *scan.Call {
+		return &scan.Call{Out: out(&kms.DescribeKeyOutput{KeyMetadata: &kms.KeyMetadata{
+			KeyId:      aws.String(id),
+			KeyManager: mgr,
+			KeyState:   st,
+		}})}
+	}
+	rotation := func(id string, enabled bool) *scan.Call {
+		return &scan.Call{
+			ID:  id,
+			In:  &kms.GetKeyRotationStatusInput{KeyId: aws.String(id)},
+			Out: out(&kms.GetKeyRotationStatusOutput{KeyRotationEnabled: aws.Bool(enabled)}),
+		}
+	}
+	maps := []*scan.Map{
+		newMap("ec2", map[string][]*scan.Call{
+			"DescribeSecurityGroups": {{
+				ID: "sg",
+				Out: out(&ec2.DescribeSecurityGroupsOutput{
+					SecurityGroups: []ec2.SecurityGroup{{
+						GroupId: aws.String("sg-1"),
+						IpPermissions: []ec2.IpPermission{{
+							IpProtocol: aws.String("tcp"),
+							FromPort:   aws.Int64(22),
+							ToPort:     aws.Int64(22),
+							IpRanges:   []ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+						}, {
+							IpProtocol: aws.String("-1"),
+							Ipv6Ranges: []ec2.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+						}},
+					}, {
+						GroupId: aws.String("sg-2"),
+						IpPermissions: []ec2.IpPermission{{
+							IpProtocol: aws.String("tcp"),
+							FromPort:   aws.Int64(0),
+							ToPort:     aws.Int64(65535),
+							IpRanges:   []ec2.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+						}},
+					}},
+				}),
+			}},
+		}),
+		newMap("s3", map[string][]*scan.Call{
+			"GetBucketPolicy": {{
+				ID: "pol",
+				In: &s3.GetBucketPolicyInput{Bucket: aws.String("pub")},
+				Out: out(&s3.GetBucketPolicyOutput{Policy: aws.String(`{
+					"Statement": [{
+						"Sid": "Public",
+						"Effect": "Allow",
+						"Principal": "*",
+						"Action": "s3:GetObject",
+						"Resource": "arn:aws:s3:::pub/*"
+					}]
+				}`)}),
+			}, {
+				ID:  "nopol",
+				In:  &s3.GetBucketPolicyInput{Bucket: aws.String("priv")},
+				Err: &scan.Err{Status: http.StatusNotFound, Ignore: true},
+			}},
+			"GetBucketAcl": {{
+				ID: "acl",
+				In: &s3.GetBucketAclInput{Bucket: aws.String("pub")},
+				Out: out(&s3.GetBucketAclOutput{
+					Grants: []s3.Grant{{
+						Grantee: &s3.Grantee{
+							Type: s3.TypeGroup,
+							URI:  aws.String("http://acs.amazonaws.com/groups/global/AllUsers"),
+						},
+						Permission: s3.PermissionRead,
+					}, {
+						Grantee:    &s3.Grantee{Type: s3.TypeCanonicalUser},
+						Permission: s3.PermissionFullControl,
+					}},
+				}),
+			}},
+		}),
+		newMap("kms", map[string][]*scan.Call{
+			"DescribeKey": {
+				key("key1", kms.KeyManagerTypeCustomer, kms.KeyStateEnabled),
+				key("key2", kms.KeyManagerTypeCustomer, kms.KeyStateEnabled),
+				key("key3", kms.KeyManagerTypeCustomer, kms.KeyStatePendingDeletion),
+				key("key4", kms.KeyManagerTypeAws, kms.KeyStateEnabled),
+			},
+			"GetKeyRotationStatus": {
+				rotation("key1", false),
+				rotation("key2", true),
+				rotation("key3", false),
+				rotation("key4", false),
+				rotation("key5", false),
+			},
+		}),
+		newMap("iam", map[string][]*scan.Call{
+			"GetAccountPasswordPolicy": {{
+				ID:  "pp",
+				In:  &iam.GetAccountPasswordPolicyInput{},
+				Err: &scan.Err{Status: http.StatusNotFound, Ignore: true},
+			}},
+		}),
+	}
+	rules, err := Rules("security")
+	require.NoError(t, err)
+	r := Run(maps, rules)
+
+	status := make(map[string]Status)
+	for _, res := range r.Results {
+		status[res.Rule] = res.Status
+	}
+	assert.Equal(t, map[string]Status{
+		"ec2-sg-open-ingress": Fail,
+		"s3-public-policy":    Fail,
+		"s3-public-acl":       Fail,
+		"kms-key-rotation":    Fail,
+		"iam-password-policy": Fail,
+		"cloudtrail-logging":  NotApplicable,
+	}, status)
+
+	want := []*Finding{{
+		Rule:     "ec2-sg-open-ingress",
+		Severity: High,
+		Resource: "arn:aws:ec2:us-east-1:123456789012:security-group/sg-1",
+		Source:   "123456789012/us-east-1/ec2.DescribeSecurityGroups",
+		Evidence: "sg",
+		Message:  "all traffic open to ::/0",
+	}, {
+		Rule:     "ec2-sg-open-ingress",
+		Severity: High,
+		Resource: "arn:aws:ec2:us-east-1:123456789012:security-group/sg-1",
+		Source:   "123456789012/us-east-1/ec2.DescribeSecurityGroups",
+		Evidence: "sg",
+		Message:  "tcp port 22 open to 0.0.0.0/0",
+	}, {
+		Rule:     "s3-public-policy",
+		Severity: High,
+		Resource: "arn:aws:s3:::pub",
+		Source:   "123456789012/us-east-1/s3.GetBucketPolicy",
+		Evidence: "pol",
+		Message:  `statement "Public" allows public access`,
+	}, {
+		Rule:     "s3-public-acl",
+		Severity: High,
+		Resource: "arn:aws:s3:::pub",
+		Source:   "123456789012/us-east-1/s3.GetBucketAcl",
+		Evidence: "acl",
+		Message:  "READ granted to AllUsers",
+	}, {
+		Rule:     "kms-key-rotation",
+		Severity: Medium,
+		Resource: "arn:aws:kms:us-east-1:123456789012:key/key1",
+		Source:   "123456789012/us-east-1/kms.GetKeyRotationStatus",
+		Evidence: "key1",
+		Message:  "key rotation disabled",
+	}, {
+		Rule:     "kms-key-rotation",
+		Severity: Medium,
+		Resource: "arn:aws:kms:us-east-1:123456789012:key/key5",
+		Source:   "123456789012/us-east-1/kms.GetKeyRotationStatus",
+		Evidence: "key5",
+		Message:  "key rotation disabled (key manager and state unknown)",
+	}, {
+		Rule:     "iam-password-policy",
+		Severity: Medium,
+		Resource: "arn:aws:iam::123456789012:root",
+		Source:   "123456789012/aws-global/iam.GetAccountPasswordPolicy",
+		Evidence: "pp",
+		Message:  "account password policy not set",
+	}}
+	assert.Equal(t, want, r.Findings())
+	assert.Equal(t, []string{"nopol", "pol"}, r.Results[1].Evidence)
+
+	maps = []*scan.Map{newMap("cloudtrail", map[string][]*scan.Call{
+		"GetTrailStatus": {{
+			ID:  "trail",
+			In:  &cloudtrail.GetTrailStatusInput{Name: aws.String("arn:aws:cloudtrail:us-east-1:123456789012:trail/t")},
+			Out: out(&cloudtrail.GetTrailStatusOutput{IsLogging: aws.Bool(true)}),
+		}},
+	})}
+	r = Run(maps, rules)
+	assert.Empty(t, r.Findings())
+	assert.Equal(t, Pass, r.Results[5].Status)
+}
+
+func TestEachPanic(t *testing.T) {
+	ctx := &Ctx{res: new(Result), seen: make(map[string]bool)}
+	assert.Panics(t, func() { ctx.Each(func(*Ctx) {}) })
+	assert.Panics(t, func() { ctx.Each(func(int) {}) })
+}
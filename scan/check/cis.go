@@ -0,0 +1,729 @@
+package check
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// CIS AWS Foundations Benchmark v1.2.0 controls that can be evaluated using
+// scan results. Use scan.CIS mode to make only the required API calls.
+var _ = Register("cis",
+	cis("1.2", "MFA is enabled for all IAM users that have a console password", High, cisUserMFA),
+	cis("1.3", "Credentials unused for 90 days or greater are disabled", Medium, cisUnusedCreds),
+	cis("1.4", "Access keys are rotated every 90 days or less", Medium, cisKeyRotation),
+	cis("1.5", "IAM password policy requires at least one uppercase letter", Medium,
+		cisPasswordPolicy("require uppercase letters", func(p *iam.PasswordPolicy) bool {
+			return aws.BoolValue(p.RequireUppercaseCharacters)
+		})),
+	cis("1.6", "IAM password policy requires at least one lowercase letter", Medium,
+		cisPasswordPolicy("require lowercase letters", func(p *iam.PasswordPolicy) bool {
+			return aws.BoolValue(p.RequireLowercaseCharacters)
+		})),
+	cis("1.7", "IAM password policy requires at least one symbol", Medium,
+		cisPasswordPolicy("require symbols", func(p *iam.PasswordPolicy) bool {
+			return aws.BoolValue(p.RequireSymbols)
+		})),
+	cis("1.8", "IAM password policy requires at least one number", Medium,
+		cisPasswordPolicy("require numbers", func(p *iam.PasswordPolicy) bool {
+			return aws.BoolValue(p.RequireNumbers)
+		})),
+	cis("1.9", "IAM password policy requires minimum length of 14 or greater", Medium,
+		cisPasswordPolicy("require 14 or more characters", func(p *iam.PasswordPolicy) bool {
+			return aws.Int64Value(p.MinimumPasswordLength) >= 14
+		})),
+	cis("1.10", "IAM password policy prevents password reuse", Medium,
+		cisPasswordPolicy("prevent reuse of the last 24 passwords", func(p *iam.PasswordPolicy) bool {
+			return aws.Int64Value(p.PasswordReusePrevention) >= 24
+		})),
+	cis("1.11", "IAM password policy expires passwords within 90 days or less", Medium,
+		cisPasswordPolicy("expire passwords within 90 days", func(p *iam.PasswordPolicy) bool {
+			n := aws.Int64Value(p.MaxPasswordAge)
+			return 0 < n && n <= 90
+		})),
+	cis("1.12", "No root account access key exists", High, cisRootKeys),
+	cis("1.13", "MFA is enabled for the root account", High, cisRootMFA),
+	cis("1.14", "Hardware MFA is enabled for the root account", High, cisRootHardwareMFA),
+	cis("1.16", "IAM policies are attached only to groups or roles", Low, cisUserPolicies),
+	cis("1.22", "IAM policies that allow full administrative privileges are not created", High, cisAdminPolicies),
+	cis("2.1", "CloudTrail is enabled in all regions", High, cisMultiRegionTrail),
+	cis("2.2", "CloudTrail log file validation is enabled", Medium, cisTrailValidation),
+	cis("2.3", "S3 bucket used to store CloudTrail logs is not publicly accessible", Critical, cisTrailBucketPublic),
+	cis("2.4", "CloudTrail trails are integrated with CloudWatch Logs", Medium, cisTrailCloudWatch),
+	cis("2.6", "S3 bucket access logging is enabled on the CloudTrail S3 bucket", Medium, cisTrailBucketLogging),
+	cis("2.7", "CloudTrail logs are encrypted at rest using KMS CMKs", Medium, cisTrailKMS),
+	cis("2.8", "Rotation for customer created CMKs is enabled", Medium, kmsKeyRotation),
+	cis("2.9", "VPC flow logging is enabled in all VPCs", Medium, cisFlowLogs),
+	cis("3.1", "A log metric filter and alarm exist for unauthorized API calls", Low,
+		cisAlarm(`$.errorCode=*UnauthorizedOperation`, `$.errorCode=AccessDenied*`)),
+	cis("3.2", "A log metric filter and alarm exist for console sign-in without MFA", Low,
+		cisAlarm(`$.eventName=ConsoleLogin`, `$.additionalEventData.MFAUsed!=Yes`)),
+	cis("3.3", "A log metric filter and alarm exist for usage of the root account", Low,
+		cisAlarm(`$.userIdentity.type=Root`, `$.userIdentity.invokedByNOTEXISTS`,
+			`$.eventType!=AwsServiceEvent`)),
+	cis("3.4", "A log metric filter and alarm exist for IAM policy changes", Low,
+		cisAlarm(eventNames("DeleteGroupPolicy", "DeleteRolePolicy",
+			"DeleteUserPolicy", "PutGroupPolicy", "PutRolePolicy", "PutUserPolicy",
+			"CreatePolicy", "DeletePolicy", "CreatePolicyVersion",
+			"DeletePolicyVersion", "AttachRolePolicy", "DetachRolePolicy",
+			"AttachUserPolicy", "DetachUserPolicy", "AttachGroupPolicy",
+			"DetachGroupPolicy")...)),
+	cis("3.5", "A log metric filter and alarm exist for CloudTrail configuration changes", Low,
+		cisAlarm(eventNames("CreateTrail", "UpdateTrail", "DeleteTrail",
+			"StartLogging", "StopLogging")...)),
+	cis("3.6", "A log metric filter and alarm exist for console authentication failures", Low,
+		cisAlarm(`$.eventName=ConsoleLogin`, `$.errorMessage=Failedauthentication`)),
+	cis("3.7", "A log metric filter and alarm exist for disabling or scheduled deletion of CMKs", Low,
+		cisAlarm(append(eventNames("DisableKey", "ScheduleKeyDeletion"),
+			`$.eventSource=kms.amazonaws.com`)...)),
+	cis("3.8", "A log metric filter and alarm exist for S3 bucket policy changes", Low,
+		cisAlarm(append(eventNames("PutBucketAcl", "PutBucketPolicy",
+			"PutBucketCors", "PutBucketLifecycle", "PutBucketReplication",
+			"DeleteBucketPolicy", "DeleteBucketCors", "DeleteBucketLifecycle",
+			"DeleteBucketReplication"), `$.eventSource=s3.amazonaws.com`)...)),
+	cis("3.9", "A log metric filter and alarm exist for AWS Config configuration changes", Low,
+		cisAlarm(append(eventNames("StopConfigurationRecorder",
+			"DeleteDeliveryChannel", "PutDeliveryChannel",
+			"PutConfigurationRecorder"), `$.eventSource=config.amazonaws.com`)...)),
+	cis("3.10", "A log metric filter and alarm exist for security group changes", Low,
+		cisAlarm(eventNames("AuthorizeSecurityGroupIngress",
+			"AuthorizeSecurityGroupEgress", "RevokeSecurityGroupIngress",
+			"RevokeSecurityGroupEgress", "CreateSecurityGroup",
+			"DeleteSecurityGroup")...)),
+	cis("3.11", "A log metric filter and alarm exist for changes to NACLs", Low,
+		cisAlarm(eventNames("CreateNetworkAcl", "CreateNetworkAclEntry",
+			"DeleteNetworkAcl", "DeleteNetworkAclEntry", "ReplaceNetworkAclEntry",
+			"ReplaceNetworkAclAssociation")...)),
+	cis("3.12", "A log metric filter and alarm exist for changes to network gateways", Low,
+		cisAlarm(eventNames("CreateCustomerGateway", "DeleteCustomerGateway",
+			"AttachInternetGateway", "CreateInternetGateway",
+			"DeleteInternetGateway", "DetachInternetGateway")...)),
+	cis("3.13", "A log metric filter and alarm exist for route table changes", Low,
+		cisAlarm(eventNames("CreateRoute", "CreateRouteTable", "ReplaceRoute",
+			"ReplaceRouteTableAssociation", "DeleteRouteTable", "DeleteRoute",
+			"DisassociateRouteTable")...)),
+	cis("3.14", "A log metric filter and alarm exist for VPC changes", Low,
+		cisAlarm(eventNames("CreateVpc", "DeleteVpc", "ModifyVpcAttribute",
+			"AcceptVpcPeeringConnection", "CreateVpcPeeringConnection",
+			"DeleteVpcPeeringConnection", "RejectVpcPeeringConnection",
+			"AttachClassicLinkVpc", "DetachClassicLinkVpc",
+			"DisableVpcClassicLink", "EnableVpcClassicLink")...)),
+	cis("4.1", "No security groups allow ingress from 0.0.0.0/0 to port 22", High, cisOpenPort(22)),
+	cis("4.2", "No security groups allow ingress from 0.0.0.0/0 to port 3389", High, cisOpenPort(3389)),
+	cis("4.3", "The default security group of every VPC restricts all traffic", Medium, cisDefaultSG),
+)
+
+// maxAge is the maximum age of credentials for CIS controls.
+const maxAge = 90 * 24 * time.Hour
+
+// cis returns a new CIS benchmark rule.
+func cis(id, title string, sev Severity, eval func(ctx *Ctx)) *Rule {
+	return &Rule{ID: "cis-" + id, Title: title, Severity: sev, Eval: eval}
+}
+
+func cisUserMFA(ctx *Ctx) {
+	eachUser(ctx, func(u credUser, _ time.Time) {
+		if u["password_enabled"] == "true" && u["mfa_active"] != "true" {
+			ctx.Fail(arn.ARN(u["arn"]), "console password enabled without MFA")
+		}
+	})
+}
+
+func cisUnusedCreds(ctx *Ctx) {
+	eachUser(ctx, func(u credUser, now time.Time) {
+		if u["password_enabled"] == "true" {
+			last, ok := u.time("password_last_used")
+			if !ok {
+				last, _ = u.time("user_creation_time")
+			}
+			if d := now.Sub(last); d > maxAge {
+				ctx.Fail(arn.ARN(u["arn"]), "password unused for %d days", days(d))
+			}
+		}
+		for _, k := range []string{"1", "2"} {
+			key := "access_key_" + k
+			if u[key+"_active"] != "true" {
+				continue
+			}
+			last, ok := u.time(key + "_last_used_date")
+			if !ok {
+				last, _ = u.time(key + "_last_rotated")
+			}
+			if d := now.Sub(last); d > maxAge {
+				ctx.Fail(arn.ARN(u["arn"]), "access key %s unused for %d days", k, days(d))
+			}
+		}
+	})
+}
+
+func cisKeyRotation(ctx *Ctx) {
+	eachUser(ctx, func(u credUser, now time.Time) {
+		for _, k := range []string{"1", "2"} {
+			key := "access_key_" + k
+			if u[key+"_active"] != "true" {
+				continue
+			}
+			if t, ok := u.time(key + "_last_rotated"); ok && now.Sub(t) > maxAge {
+				ctx.Fail(arn.ARN(u["arn"]), "access key %s not rotated for %d days",
+					k, days(now.Sub(t)))
+			}
+		}
+	})
+}
+
+func cisPasswordPolicy(req string, ok func(p *iam.PasswordPolicy) bool) func(ctx *Ctx) {
+	return func(ctx *Ctx) {
+		ctx.Each(func(out *iam.GetAccountPasswordPolicyOutput) {
+			if out == nil {
+				if c := ctx.Call(); c.Err != nil && c.Err.Ignore {
+					ctx.Fail(rootARN(ctx.Map()), "account password policy not set")
+				}
+			} else if out.PasswordPolicy == nil || !ok(out.PasswordPolicy) {
+				ctx.Fail(rootARN(ctx.Map()), "password policy does not %s", req)
+			}
+		})
+	}
+}
+
+func cisRootKeys(ctx *Ctx) {
+	eachCredUser(ctx, func(u credUser, _ time.Time) {
+		if u["user"] != rootUser {
+			return
+		}
+		for _, k := range []string{"1", "2"} {
+			if u["access_key_"+k+"_active"] == "true" {
+				ctx.Fail(rootARN(ctx.Map()), "root access key %s is active", k)
+			}
+		}
+	})
+}
+
+func cisRootMFA(ctx *Ctx) {
+	ctx.Each(func(out *iam.GetAccountSummaryOutput) {
+		if out != nil && out.SummaryMap["AccountMFAEnabled"] != 1 {
+			ctx.Fail(rootARN(ctx.Map()), "root account MFA not enabled")
+		}
+	})
+}
+
+func cisRootHardwareMFA(ctx *Ctx) {
+	ctx.Each(func(out *iam.GetAccountSummaryOutput) {
+		if out != nil && out.SummaryMap["AccountMFAEnabled"] != 1 {
+			ctx.Fail(rootARN(ctx.Map()), "root account MFA not enabled")
+		}
+	})
+	ctx.Each(func(out *iam.ListVirtualMFADevicesOutput) {
+		if out == nil {
+			return
+		}
+		for _, d := range out.VirtualMFADevices {
+			if strings.HasSuffix(aws.StringValue(d.SerialNumber), ":mfa/root-account-mfa-device") {
+				ctx.Fail(rootARN(ctx.Map()), "root account uses virtual MFA device")
+			}
+		}
+	})
+}
+
+func cisUserPolicies(ctx *Ctx) {
+	userARN := func(name *string) arn.ARN {
+		m := ctx.Map()
+		ac := arn.Ctx{Partition: m.Partition, Account: m.Account}
+		return ac.New("iam", "user/", aws.StringValue(name))
+	}
+	ctx.Each(func(out *iam.ListAttachedUserPoliciesOutput) {
+		if out == nil {
+			return
+		}
+		user := ctx.Call().In.(*iam.ListAttachedUserPoliciesInput).UserName
+		for _, p := range out.AttachedPolicies {
+			ctx.Fail(userARN(user), "policy %s attached to user",
+				aws.StringValue(p.PolicyName))
+		}
+	})
+	ctx.Each(func(out *iam.ListUserPoliciesOutput) {
+		if out == nil {
+			return
+		}
+		user := ctx.Call().In.(*iam.ListUserPoliciesInput).UserName
+		for _, name := range out.PolicyNames {
+			ctx.Fail(userARN(user), "inline policy %s embedded in user", name)
+		}
+	})
+}
+
+func cisAdminPolicies(ctx *Ctx) {
+	ctx.Each(func(out *iam.GetPolicyVersionOutput) {
+		if out == nil || out.PolicyVersion == nil {
+			return
+		}
+		in := ctx.Call().In.(*iam.GetPolicyVersionInput)
+		res := arn.ARN(aws.StringValue(in.PolicyArn))
+		doc, err := policy.Parse(aws.StringValue(out.PolicyVersion.Document))
+		if err != nil {
+			ctx.Fail(res, "invalid policy document: %v", err)
+			return
+		}
+		for i, s := range doc.Statement {
+			if s.Effect == policy.Allow && s.Action.Contains("*") &&
+				s.Resource.Contains("*") && len(s.Condition) == 0 {
+				ctx.Fail(res, "statement %s allows \"*:*\"", sid(s, i))
+			}
+		}
+	})
+}
+
+func cisMultiRegionTrail(ctx *Ctx) {
+	for _, a := range getTrails(ctx) {
+		ok := false
+		for _, t := range a.trails {
+			if ok = aws.BoolValue(t.IsMultiRegionTrail) && t.logging() &&
+				t.managementEvents(); ok {
+				break
+			}
+		}
+		if !ok {
+			ctx.FailAt(a.ref, a.root, "no multi-region trail is logging all management events")
+		}
+	}
+}
+
+func cisTrailValidation(ctx *Ctx) {
+	for _, a := range getTrails(ctx) {
+		for _, t := range a.trails {
+			if !aws.BoolValue(t.LogFileValidationEnabled) {
+				ctx.FailAt(t.ref, t.arn(), "log file validation disabled")
+			}
+		}
+	}
+}
+
+func cisTrailBucketPublic(ctx *Ctx) {
+	buckets := trailBuckets(ctx)
+	ctx.Each(func(out *s3.GetBucketPolicyOutput) {
+		if out != nil && buckets[trailBucketKey(ctx)] {
+			bucketPolicy(ctx, out)
+		}
+	})
+	ctx.Each(func(out *s3.GetBucketAclOutput) {
+		if out != nil && buckets[trailBucketKey(ctx)] {
+			bucketACL(ctx, out)
+		}
+	})
+}
+
+func cisTrailCloudWatch(ctx *Ctx) {
+	for _, a := range getTrails(ctx) {
+		for _, t := range a.trails {
+			if t.CloudWatchLogsLogGroupArn == nil {
+				ctx.FailAt(t.ref, t.arn(), "trail not integrated with CloudWatch Logs")
+			} else if t.status != nil && t.status.LatestCloudWatchLogsDeliveryError != nil {
+				ctx.FailAt(t.statusRef, t.arn(), "CloudWatch Logs delivery error: %s",
+					aws.StringValue(t.status.LatestCloudWatchLogsDeliveryError))
+			}
+		}
+	}
+}
+
+func cisTrailBucketLogging(ctx *Ctx) {
+	buckets := trailBuckets(ctx)
+	ctx.Each(func(out *s3.GetBucketLoggingOutput) {
+		if out != nil && out.LoggingEnabled == nil && buckets[trailBucketKey(ctx)] {
+			ctx.Fail(bucketARN(ctx), "access logging disabled")
+		}
+	})
+}
+
+func cisTrailKMS(ctx *Ctx) {
+	for _, a := range getTrails(ctx) {
+		for _, t := range a.trails {
+			if t.KmsKeyId == nil {
+				ctx.FailAt(t.ref, t.arn(), "logs not encrypted using KMS")
+			}
+		}
+	}
+}
+
+func cisFlowLogs(ctx *Ctx) {
+	logged := make(map[string]bool)
+	ctx.Each(func(out *ec2.DescribeFlowLogsOutput) {
+		if out != nil {
+			for _, fl := range out.FlowLogs {
+				logged[arnKey(ctx, aws.StringValue(fl.ResourceId))] = true
+			}
+		}
+	})
+	ctx.Each(func(out *ec2.DescribeVpcsOutput) {
+		if out == nil {
+			return
+		}
+		for _, v := range out.Vpcs {
+			if id := aws.StringValue(v.VpcId); !logged[arnKey(ctx, id)] {
+				ctx.Fail(ctx.Map().New("ec2", "vpc/", id), "flow logs not enabled")
+			}
+		}
+	})
+}
+
+// cisAlarm returns a function that verifies the existence of a metric filter
+// for the CloudWatch Logs group of a multi-region trail and an alarm for that
+// metric. Filter patterns must contain all terms after removal of whitespace
+// and quotes.
+func cisAlarm(terms ...string) func(ctx *Ctx) {
+	return func(ctx *Ctx) {
+		type metric struct{ region, namespace, name string }
+		type group struct {
+			key string // "<account>/<region>/<name>"
+			ref Ref    // DescribeTrails call
+			res arn.ARN
+		}
+		all := getTrails(ctx)
+		groups := make(map[string][]*group)
+		for _, a := range all {
+			for _, t := range a.trails {
+				if aws.BoolValue(t.IsMultiRegionTrail) && t.logging() &&
+					t.CloudWatchLogsLogGroupArn != nil {
+					v := arn.ARN(strings.TrimSuffix(*t.CloudWatchLogsLogGroupArn, ":*"))
+					name := strings.TrimPrefix(v.Resource(), "log-group:")
+					acct := a.ref.m.Account
+					groups[acct] = append(groups[acct], &group{
+						key: v.Account() + "/" + v.Region() + "/" + name,
+						ref: t.ref,
+						res: v,
+					})
+				}
+			}
+		}
+
+		// Find metrics produced by matching filters for each log group
+		metrics := make(map[string][]metric)
+		filters := make(map[string]Ref)
+		ctx.Each(func(out *cloudwatchlogs.DescribeMetricFiltersOutput) {
+			if out == nil {
+				return
+			}
+			m := ctx.Map()
+			for _, f := range out.MetricFilters {
+				if !matchPattern(aws.StringValue(f.FilterPattern), terms) {
+					continue
+				}
+				k := m.Account + "/" + m.Region + "/" + aws.StringValue(f.LogGroupName)
+				filters[k] = ctx.Ref()
+				for _, mt := range f.MetricTransformations {
+					metrics[k] = append(metrics[k], metric{m.Region,
+						aws.StringValue(mt.MetricNamespace),
+						aws.StringValue(mt.MetricName)})
+				}
+			}
+		})
+
+		// Find metrics with alarm actions
+		alarmed := make(map[string]bool)
+		ctx.Each(func(out *cloudwatch.DescribeAlarmsOutput) {
+			if out == nil {
+				return
+			}
+			m := ctx.Map()
+			for _, a := range out.MetricAlarms {
+				if len(a.AlarmActions) > 0 {
+					alarmed[m.Account+"/"+m.Region+"/"+aws.StringValue(a.Namespace)+
+						"/"+aws.StringValue(a.MetricName)] = true
+				}
+			}
+		})
+
+		// Control passes if any trail log group has an alarmed metric filter
+	accounts:
+		for _, a := range all {
+			acct := a.ref.m.Account
+			for _, g := range groups[acct] {
+				for _, mt := range metrics[g.key] {
+					if alarmed[acct+"/"+mt.region+"/"+mt.namespace+"/"+mt.name] {
+						continue accounts
+					}
+				}
+			}
+			if len(groups[acct]) == 0 {
+				ctx.FailAt(a.ref, a.root, "no multi-region trail delivers to CloudWatch Logs")
+			}
+			for _, g := range groups[acct] {
+				if ref, ok := filters[g.key]; ok {
+					ctx.FailAt(ref, g.res, "no alarm with actions for matching metric filter")
+				} else {
+					ctx.FailAt(g.ref, g.res, "no matching metric filter")
+				}
+			}
+		}
+	}
+}
+
+// eventNames returns metric filter pattern terms for the given event names.
+func eventNames(names ...string) []string {
+	terms := make([]string, len(names))
+	for i, name := range names {
+		terms[i] = "$.eventName=" + name
+	}
+	return terms
+}
+
+// matchPattern returns true if the filter pattern contains all terms.
+func matchPattern(pattern string, terms []string) bool {
+	pattern = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '"':
+			return -1
+		}
+		return r
+	}, pattern)
+	for _, t := range terms {
+		if !strings.Contains(pattern, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func cisOpenPort(port int64) func(ctx *Ctx) {
+	return func(ctx *Ctx) {
+		ctx.Each(func(out *ec2.DescribeSecurityGroupsOutput) {
+			if out == nil {
+				return
+			}
+			for i := range out.SecurityGroups {
+				sg := &out.SecurityGroups[i]
+				for j := range sg.IpPermissions {
+					p := &sg.IpPermissions[j]
+					if !openIngress(p) {
+						continue
+					}
+					switch aws.StringValue(p.IpProtocol) {
+					case "tcp", "6":
+						if aws.Int64Value(p.FromPort) > port || port > aws.Int64Value(p.ToPort) {
+							continue
+						}
+					case "-1":
+					default:
+						continue
+					}
+					res := ctx.Map().New("ec2", "security-group/", aws.StringValue(sg.GroupId))
+					ctx.Fail(res, "%s open to the internet", portRange(p))
+				}
+			}
+		})
+	}
+}
+
+func cisDefaultSG(ctx *Ctx) {
+	ctx.Each(func(out *ec2.DescribeSecurityGroupsOutput) {
+		if out == nil {
+			return
+		}
+		for i := range out.SecurityGroups {
+			sg := &out.SecurityGroups[i]
+			if aws.StringValue(sg.GroupName) != "default" {
+				continue
+			}
+			if n := len(sg.IpPermissions) + len(sg.IpPermissionsEgress); n > 0 {
+				res := ctx.Map().New("ec2", "security-group/", aws.StringValue(sg.GroupId))
+				ctx.Fail(res, "default security group has %d rule(s)", n)
+			}
+		}
+	})
+}
+
+// openIngress returns true if p allows traffic from any IPv4 or IPv6 address.
+func openIngress(p *ec2.IpPermission) bool {
+	for _, r := range p.IpRanges {
+		if aws.StringValue(r.CidrIp) == "0.0.0.0/0" {
+			return true
+		}
+	}
+	for _, r := range p.Ipv6Ranges {
+		if aws.StringValue(r.CidrIpv6) == "::/0" {
+			return true
+		}
+	}
+	return false
+}
+
+// arnKey returns a key that identifies resource id within the current
+// account and region.
+func arnKey(ctx *Ctx, id string) string {
+	m := ctx.Map()
+	return m.Account + "/" + m.Region + "/" + id
+}
+
+// days returns the number of whole days in d.
+func days(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
+
+//
+// Credential report
+//
+
+// rootUser is the name of the root account in the credential report.
+const rootUser = "<root_account>"
+
+// credUser is one row of the IAM credential report indexed by column name.
+type credUser map[string]string
+
+// time returns the value of a timestamp column. It returns false if the
+// column does not contain a valid time (e.g. "N/A" or "no_information").
+func (u credUser) time(col string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, u[col])
+	return t, err == nil
+}
+
+// eachUser calls fn for every IAM user, excluding the root account, in all
+// credential reports.
+func eachUser(ctx *Ctx, fn func(u credUser, now time.Time)) {
+	eachCredUser(ctx, func(u credUser, now time.Time) {
+		if u["user"] != rootUser {
+			fn(u, now)
+		}
+	})
+}
+
+// eachCredUser calls fn for every row in all credential reports. The report
+// generation time is used as the current time.
+func eachCredUser(ctx *Ctx, fn func(u credUser, now time.Time)) {
+	ctx.Each(func(out *iam.GetCredentialReportOutput) {
+		if out == nil {
+			return
+		}
+		rows, err := csv.NewReader(bytes.NewReader(out.Content)).ReadAll()
+		if err != nil || len(rows) == 0 {
+			ctx.Fail(rootARN(ctx.Map()), "invalid credential report")
+			return
+		}
+		now := aws.TimeValue(out.GeneratedTime)
+		hdr := rows[0]
+		for _, row := range rows[1:] {
+			u := make(credUser, len(hdr))
+			for i, v := range row {
+				if i < len(hdr) {
+					u[hdr[i]] = v
+				}
+			}
+			fn(u, now)
+		}
+	})
+}
+
+//
+// CloudTrail
+//
+
+// acctTrails contains all trails in one account.
+type acctTrails struct {
+	ref    Ref     // First DescribeTrails call
+	root   arn.ARN // Account root ARN
+	trails []*trail
+}
+
+// trail combines information about one trail from multiple API calls.
+type trail struct {
+	*cloudtrail.Trail
+	ref       Ref
+	status    *cloudtrail.GetTrailStatusOutput
+	statusRef Ref
+	selectors []cloudtrail.EventSelector
+	custom    bool
+}
+
+// arn returns the trail ARN.
+func (t *trail) arn() arn.ARN { return arn.ARN(aws.StringValue(t.TrailARN)) }
+
+// logging returns true if the trail is logging.
+func (t *trail) logging() bool {
+	return t.status != nil && aws.BoolValue(t.status.IsLogging)
+}
+
+// managementEvents returns true if the trail logs all management events.
+func (t *trail) managementEvents() bool {
+	if !t.custom {
+		return true
+	}
+	for _, s := range t.selectors {
+		if aws.BoolValue(s.IncludeManagementEvents) &&
+			s.ReadWriteType == cloudtrail.ReadWriteTypeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// getTrails returns all trails in all scanned accounts. Trails are only
+// included in the results of their home region.
+func getTrails(ctx *Ctx) []*acctTrails {
+	var all []*acctTrails
+	acct := make(map[string]*acctTrails)
+	byARN := make(map[string]*trail)
+	ctx.Each(func(out *cloudtrail.DescribeTrailsOutput) {
+		m := ctx.Map()
+		a := acct[m.Account]
+		if a == nil {
+			if c := ctx.Call(); c.Err != nil && !c.Err.Ignore {
+				return
+			}
+			a = &acctTrails{ref: ctx.Ref(), root: rootARN(m)}
+			acct[m.Account] = a
+			all = append(all, a)
+		}
+		if out == nil {
+			return
+		}
+		for i := range out.TrailList {
+			t := &out.TrailList[i]
+			if aws.StringValue(t.HomeRegion) != m.Region {
+				continue
+			}
+			tr := &trail{Trail: t, ref: ctx.Ref(),
+				custom: aws.BoolValue(t.HasCustomEventSelectors)}
+			a.trails = append(a.trails, tr)
+			byARN[aws.StringValue(t.TrailARN)] = tr
+		}
+	})
+	ctx.Each(func(out *cloudtrail.GetTrailStatusOutput) {
+		in := ctx.Call().In.(*cloudtrail.GetTrailStatusInput)
+		if t := byARN[aws.StringValue(in.Name)]; t != nil && out != nil {
+			t.status, t.statusRef = out, ctx.Ref()
+		}
+	})
+	ctx.Each(func(out *cloudtrail.GetEventSelectorsOutput) {
+		in := ctx.Call().In.(*cloudtrail.GetEventSelectorsInput)
+		if t := byARN[aws.StringValue(in.TrailName)]; t != nil && out != nil {
+			t.selectors = append(t.selectors, out.EventSelectors...)
+		}
+	})
+	return all
+}
+
+// trailBuckets returns the account and name of all S3 buckets used by trails.
+func trailBuckets(ctx *Ctx) map[string]bool {
+	buckets := make(map[string]bool)
+	for _, a := range getTrails(ctx) {
+		for _, t := range a.trails {
+			if t.S3BucketName != nil {
+				buckets[a.ref.m.Account+"/"+*t.S3BucketName] = true
+			}
+		}
+	}
+	return buckets
+}
+
+// trailBucketKey returns the trailBuckets key for the current S3 call.
+func trailBucketKey(ctx *Ctx) string {
+	return ctx.Map().Account + "/" + bucketName(ctx.Call().In)
+}
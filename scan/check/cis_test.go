@@ -0,0 +1,232 @@
+package check
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIS(t *testing.T) {
+	const report = "" +
+		"user,arn,user_creation_time,password_enabled,password_last_used,mfa_active,access_key_1_active,access_key_1_last_rotated,access_key_1_last_used_date,access_key_2_active,access_key_2_last_rotated,access_key_2_last_used_date\n" +
+		"<root_account>,arn:aws:iam::123456789012:root,2018-01-01T00:00:00+00:00,not_supported,2019-01-01T00:00:00+00:00,true,true,2018-01-01T00:00:00+00:00,N/A,false,N/A,N/A\n" +
+		"alice,arn:aws:iam::123456789012:user/alice,2018-01-01T00:00:00+00:00,true,2019-01-30T00:00:00+00:00,false,true,2018-06-01T00:00:00+00:00,2019-01-30T00:00:00+00:00,false,N/A,N/A\n" +
+		"bob,arn:aws:iam::123456789012:user/bob,2018-01-01T00:00:00+00:00,true,no_information,true,false,N/A,N/A,true,2019-01-01T00:00:00+00:00,N/A\n"
+	const trailARN = "arn:aws:cloudtrail:us-east-1:123456789012:trail/t"
+	const groupARN = "arn:aws:logs:us-east-1:123456789012:log-group:trail:*"
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	newMap := func(svc string, calls map[string][]*scan.Call) *scan.Map {
+		return &scan.Map{Ctx: ac, Service: svc, Calls: calls}
+	}
+	out := func(v ...interface{}) []interface{} { return v }
+	filter := func(pattern, name string) cloudwatchlogs.MetricFilter {
+		return cloudwatchlogs.MetricFilter{
+			FilterPattern: aws.String(pattern),
+			LogGroupName:  aws.String("trail"),
+			MetricTransformations: []cloudwatchlogs.MetricTransformation{{
+				MetricNamespace: aws.String("CIS"),
+				MetricName:      aws.String(name),
+			}},
+		}
+	}
+	maps := []*scan.Map{
+		newMap("iam", map[string][]*scan.Call{
+			"GetCredentialReport": {{
+				ID: "report",
+				Out: out(&iam.GetCredentialReportOutput{
+					Content:       []byte(report),
+					GeneratedTime: aws.Time(time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)),
+				}),
+			}},
+			"GetAccountPasswordPolicy": {{
+				ID:  "pp",
+				Err: &scan.Err{Status: http.StatusNotFound, Ignore: true},
+			}},
+			"GetAccountSummary": {{
+				ID: "summary",
+				Out: out(&iam.GetAccountSummaryOutput{
+					SummaryMap: map[string]int64{"AccountMFAEnabled": 1},
+				}),
+			}},
+			"ListVirtualMFADevices": {{
+				ID: "mfa",
+				Out: out(&iam.ListVirtualMFADevicesOutput{
+					VirtualMFADevices: []iam.VirtualMFADevice{{
+						SerialNumber: aws.String("arn:aws:iam::123456789012:mfa/root-account-mfa-device"),
+					}},
+				}),
+			}},
+		}),
+		newMap("cloudtrail", map[string][]*scan.Call{
+			"DescribeTrails": {{
+				ID: "trails",
+				Out: out(&cloudtrail.DescribeTrailsOutput{
+					TrailList: []cloudtrail.Trail{{
+						CloudWatchLogsLogGroupArn: aws.String(groupARN),
+						HomeRegion:                aws.String("us-east-1"),
+						IsMultiRegionTrail:        aws.Bool(true),
+						LogFileValidationEnabled:  aws.Bool(true),
+						TrailARN:                  aws.String(trailARN),
+					}, {
+						HomeRegion: aws.String("us-west-2"),
+						TrailARN:   aws.String("arn:aws:cloudtrail:us-west-2:123456789012:trail/shadow"),
+					}},
+				}),
+			}},
+			"GetTrailStatus": {{
+				ID:  "status",
+				In:  &cloudtrail.GetTrailStatusInput{Name: aws.String(trailARN)},
+				Out: out(&cloudtrail.GetTrailStatusOutput{IsLogging: aws.Bool(true)}),
+			}},
+		}),
+		newMap("cloudwatchlogs", map[string][]*scan.Call{
+			"DescribeMetricFilters": {{
+				ID: "filters",
+				Out: out(&cloudwatchlogs.DescribeMetricFiltersOutput{
+					MetricFilters: []cloudwatchlogs.MetricFilter{
+						filter(`{ ($.errorCode = "*UnauthorizedOperation") || ($.errorCode = "AccessDenied*") }`, "Unauthorized"),
+						filter(`{ ($.eventName = "ConsoleLogin") && ($.additionalEventData.MFAUsed != "Yes") }`, "NoMFA"),
+					},
+				}),
+			}},
+		}),
+		newMap("cloudwatch", map[string][]*scan.Call{
+			"DescribeAlarms": {{
+				ID: "alarms",
+				Out: out(&cloudwatch.DescribeAlarmsOutput{
+					MetricAlarms: []cloudwatch.MetricAlarm{{
+						AlarmActions: []string{"arn:aws:sns:us-east-1:123456789012:alerts"},
+						MetricName:   aws.String("Unauthorized"),
+						Namespace:    aws.String("CIS"),
+					}, {
+						MetricName: aws.String("NoMFA"),
+						Namespace:  aws.String("CIS"),
+					}},
+				}),
+			}},
+		}),
+		newMap("ec2", map[string][]*scan.Call{
+			"DescribeSecurityGroups": {{
+				ID: "sg",
+				Out: out(&ec2.DescribeSecurityGroupsOutput{
+					SecurityGroups: []ec2.SecurityGroup{{
+						GroupId:   aws.String("sg-1"),
+						GroupName: aws.String("default"),
+						IpPermissions: []ec2.IpPermission{{
+							IpProtocol: aws.String("tcp"),
+							FromPort:   aws.Int64(0),
+							ToPort:     aws.Int64(1024),
+							IpRanges:   []ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+						}},
+					}},
+				}),
+			}},
+		}),
+	}
+	rules, err := Rules("cis")
+	require.NoError(t, err)
+	r := Run(maps, rules)
+
+	type result struct {
+		status   Status
+		messages []string
+	}
+	want := map[string]result{
+		"cis-1.2":  {Fail, []string{"console password enabled without MFA"}},
+		"cis-1.3":  {Fail, []string{"password unused for 396 days"}},
+		"cis-1.4":  {Fail, []string{"access key 1 not rotated for 245 days"}},
+		"cis-1.5":  {Fail, []string{"account password policy not set"}},
+		"cis-1.12": {Fail, []string{"root access key 1 is active"}},
+		"cis-1.13": {Pass, nil},
+		"cis-1.14": {Fail, []string{"root account uses virtual MFA device"}},
+		"cis-2.1":  {Pass, nil},
+		"cis-2.2":  {Pass, nil},
+		"cis-2.7":  {Fail, []string{"logs not encrypted using KMS"}},
+		"cis-3.1":  {Pass, nil},
+		"cis-3.2":  {Fail, []string{"no alarm with actions for matching metric filter"}},
+		"cis-3.3":  {Fail, []string{"no matching metric filter"}},
+		"cis-4.1":  {Fail, []string{"tcp ports 0-1024 open to the internet"}},
+		"cis-4.2":  {Pass, nil},
+		"cis-4.3":  {Fail, []string{"default security group has 1 rule(s)"}},
+	}
+	have := make(map[string]result)
+	for _, res := range r.Results {
+		if _, ok := want[res.Rule]; ok {
+			var msgs []string
+			for _, f := range res.Findings {
+				msgs = append(msgs, f.Message)
+			}
+			have[res.Rule] = result{res.Status, msgs}
+		}
+	}
+	assert.Equal(t, want, have)
+
+	for _, res := range r.Results {
+		switch res.Rule {
+		case "cis-3.2":
+			require.Len(t, res.Findings, 1)
+			f := res.Findings[0]
+			assert.Equal(t, arn.ARN("arn:aws:logs:us-east-1:123456789012:log-group:trail"), f.Resource)
+			assert.Equal(t, "filters", f.Evidence)
+		case "cis-3.3":
+			require.Len(t, res.Findings, 1)
+			assert.Equal(t, "trails", res.Findings[0].Evidence)
+		case "cis-2.1":
+			assert.Equal(t, []string{"status", "trails"}, res.Evidence)
+		}
+	}
+}
+
+func TestCISRootMFA(t *testing.T) {
+	rules, err := Rules("cis")
+	require.NoError(t, err)
+	status := func(mfa int64, calls map[string][]*scan.Call) map[string]Status {
+		calls["GetAccountSummary"] = []*scan.Call{{
+			ID: "summary",
+			Out: []interface{}{&iam.GetAccountSummaryOutput{
+				SummaryMap: map[string]int64{"AccountMFAEnabled": mfa},
+			}},
+		}}
+		maps := []*scan.Map{{
+			Ctx:     arn.Ctx{Partition: "aws", Region: "aws-global", Account: "123456789012"},
+			Service: "iam",
+			Calls:   calls,
+		}}
+		have := make(map[string]Status)
+		for _, res := range Run(maps, rules).Results {
+			if res.Rule == "cis-1.13" || res.Rule == "cis-1.14" {
+				have[res.Rule] = res.Status
+			}
+		}
+		return have
+	}
+	noDevices := func() map[string][]*scan.Call {
+		return map[string][]*scan.Call{"ListVirtualMFADevices": {{
+			ID:  "mfa",
+			Out: []interface{}{&iam.ListVirtualMFADevicesOutput{}},
+		}}}
+	}
+	assert.Equal(t, map[string]Status{"cis-1.13": Fail, "cis-1.14": Fail},
+		status(0, noDevices()))
+	assert.Equal(t, map[string]Status{"cis-1.13": Fail, "cis-1.14": Fail},
+		status(0, map[string][]*scan.Call{}))
+	assert.Equal(t, map[string]Status{"cis-1.13": Pass, "cis-1.14": Pass},
+		status(1, noDevices()))
+}
+
+func TestMatchPattern(t *testing.T) {
+	terms := eventNames("CreateTrail", "DeleteTrail")
+	assert.True(t, matchPattern(`{($.eventName = CreateTrail) || ($.eventName = "DeleteTrail")}`, terms))
+	assert.False(t, matchPattern(`{($.eventName = CreateTrail)}`, terms))
+}
@@ -0,0 +1,54 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// Errors is the name of the rule set that reports API errors.
+const Errors = "errors"
+
+var _ = Register(Errors, &Rule{
+	ID:       "api-errors",
+	Title:    "API calls complete without unexpected errors",
+	Severity: Medium,
+	Eval:     apiErrors,
+})
+
+func apiErrors(ctx *Ctx) {
+	ctx.All(func() {
+		if c := ctx.Call(); c.Err != nil && !c.Err.Ignore {
+			m := ctx.Map()
+			id := scan.ServiceInfo(m.Service).ID
+			if id == "" {
+				id = m.Service
+			}
+			r := m.Region
+			if strings.HasSuffix(r, "-global") {
+				r = ""
+			}
+			ctx.Fail(arn.New(m.Partition, id, r, m.Account), "%s", errMsg(c.Err))
+		}
+	})
+}
+
+// errMsg returns a description of API error e.
+func errMsg(e *scan.Err) string {
+	var parts []string
+	if e.Status != 0 {
+		parts = append(parts, fmt.Sprintf("[%d]", e.Status))
+	}
+	if e.Code != "" {
+		parts = append(parts, e.Code+":")
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	if e.RequestID != "" {
+		parts = append(parts, "(request id: "+e.RequestID+")")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,51 @@
+package check
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReport returns a report with API errors found in a single scan map.
+func testReport(t *testing.T) *Report {
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	maps := []*scan.Map{{Ctx: ac, Service: "ec2", Calls: map[string][]*scan.Call{
+		"DescribeVpcs": {{ID: "ok"}},
+		"DescribeImages": {{
+			ID: "denied",
+			Err: &scan.Err{
+				Status:    http.StatusForbidden,
+				Code:      "UnauthorizedOperation",
+				Message:   "You are not authorized to perform this operation.",
+				RequestID: "req",
+			},
+		}},
+		"DescribeFlowLogs": {{
+			ID:  "ignored",
+			Err: &scan.Err{Status: http.StatusNotFound, Ignore: true},
+		}},
+	}}}
+	rules, err := Rules(Errors, "cis")
+	require.NoError(t, err)
+	return Run(maps, rules[:2])
+}
+
+func TestAPIErrors(t *testing.T) {
+	r := testReport(t)
+	res := r.Results[0]
+	assert.Equal(t, Fail, res.Status)
+	assert.Equal(t, []string{"ignored", "ok"}, res.Evidence)
+	assert.Equal(t, []*Finding{{
+		Rule:     "api-errors",
+		Severity: Medium,
+		Resource: "arn:aws:ec2:us-east-1:123456789012:",
+		Source:   "123456789012/us-east-1/ec2.DescribeImages",
+		Evidence: "denied",
+		Message:  "[403] UnauthorizedOperation: You are not authorized to perform this operation. (request id: req)",
+	}}, res.Findings)
+	assert.Equal(t, NotApplicable, r.Results[1].Status)
+}
@@ -0,0 +1,120 @@
+package check
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// JUnit returns report r in JUnit XML format. Each rule is a test suite. Rules
+// with findings have one failed test case for each service that provided the
+// evidence, passing rules have one successful test case, and rules without
+// evidence have one skipped test case.
+func (r *Report) JUnit() ([]byte, error) {
+	all := junitSuites{Name: "awsscan"}
+	for _, res := range r.Results {
+		s := junitSuite{Name: res.Rule}
+		switch res.Status {
+		case Pass:
+			s.Cases = []junitCase{{Class: res.Rule, Name: res.Title}}
+		case NotApplicable:
+			s.Cases = []junitCase{{
+				Class:   res.Rule,
+				Name:    res.Title,
+				Skipped: &junitSkipped{Message: "no evidence found"},
+			}}
+			s.Skipped = 1
+		default:
+			bySvc := make(map[string][]*Finding)
+			for _, f := range res.Findings {
+				svc := f.Source
+				if i := strings.LastIndexByte(svc, '.'); i > 0 {
+					svc = svc[:i]
+				}
+				bySvc[svc] = append(bySvc[svc], f)
+			}
+			svcs := make([]string, 0, len(bySvc))
+			for svc := range bySvc {
+				svcs = append(svcs, svc)
+			}
+			sort.Strings(svcs)
+			for _, svc := range svcs {
+				name := svc
+				if name == "" {
+					name = res.Title
+				}
+				s.Cases = append(s.Cases, junitCase{
+					Class:   res.Rule,
+					Name:    name,
+					Failure: junitFail(res, bySvc[svc]),
+				})
+			}
+			s.Failures = len(s.Cases)
+		}
+		s.Tests = len(s.Cases)
+		all.Tests += s.Tests
+		all.Failures += s.Failures
+		all.Skipped += s.Skipped
+		all.Suites = append(all.Suites, s)
+	}
+	b, err := xml.MarshalIndent(&all, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode JUnit XML")
+	}
+	return append(append([]byte(xml.Header), b...), '\n'), nil
+}
+
+// junitFail returns a test case failure describing rule findings.
+func junitFail(res *Result, fs []*Finding) *junitFailure {
+	var b bytes.Buffer
+	for _, f := range fs {
+		fmt.Fprintf(&b, "%s: %s", f.Resource, f.Message)
+		if f.Evidence != "" {
+			fmt.Fprintf(&b, " (evidence: %s)", f.Evidence)
+		}
+		b.WriteByte('\n')
+	}
+	return &junitFailure{
+		Message: fmt.Sprintf("%d finding(s)", len(fs)),
+		Type:    res.Severity.String(),
+		Text:    b.String(),
+	}
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Class   string        `xml:"classname,attr"`
+	Name    string        `xml:"name,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Skipped *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
@@ -0,0 +1,38 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJUnit(t *testing.T) {
+	r := testReport(t)
+	r.Results = append(r.Results, &Result{
+		Rule:     "pass",
+		Title:    "Passing rule",
+		Status:   Pass,
+		Evidence: []string{"ok"},
+	})
+	b, err := r.JUnit()
+	require.NoError(t, err)
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="awsscan" tests="3" failures="1" skipped="1">
+	<testsuite name="api-errors" tests="1" failures="1" skipped="0">
+		<testcase classname="api-errors" name="123456789012/us-east-1/ec2">
+			<failure message="1 finding(s)" type="medium">arn:aws:ec2:us-east-1:123456789012:: [403] UnauthorizedOperation: You are not authorized to perform this operation. (request id: req) (evidence: denied)&#xA;</failure>
+		</testcase>
+	</testsuite>
+	<testsuite name="cis-1.2" tests="1" failures="0" skipped="1">
+		<testcase classname="cis-1.2" name="MFA is enabled for all IAM users that have a console password">
+			<skipped message="no evidence found"></skipped>
+		</testcase>
+	</testsuite>
+	<testsuite name="pass" tests="1" failures="0" skipped="0">
+		<testcase classname="pass" name="Passing rule"></testcase>
+	</testsuite>
+</testsuites>
+`
+	assert.Equal(t, want, string(b))
+}
@@ -0,0 +1,171 @@
+package check
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SARIF returns report r in SARIF 2.1.0 format. Each rule is described in the
+// tool driver, and each finding is a result located at the resource ARN.
+// Suppressed findings are included with their suppression justification.
+func (r *Report) SARIF() ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "awsscan",
+			InformationURI: "https://github.com/mxk/awsscan",
+			Rules:          make([]sarifRule, 0, len(r.Results)),
+		}},
+		Results: []sarifResult{},
+	}
+	for i, res := range r.Results {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               res.Rule,
+			ShortDescription: sarifText{res.Title},
+			DefaultConfiguration: sarifConfig{
+				Level: sarifLevel(res.Severity),
+			},
+			Properties: map[string]string{
+				"severity":          res.Severity.String(),
+				"security-severity": securitySeverity[res.Severity],
+			},
+		})
+		for _, f := range res.Findings {
+			run.Results = append(run.Results, sarifFinding(i, f, false))
+		}
+		for _, f := range res.Suppressed {
+			run.Results = append(run.Results, sarifFinding(i, f, true))
+		}
+	}
+	b, err := json.MarshalIndent(&sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode SARIF")
+	}
+	return append(b, '\n'), nil
+}
+
+// sarifFinding converts finding f of rule i into a SARIF result.
+func sarifFinding(i int, f *Finding, suppressed bool) sarifResult {
+	sr := sarifResult{
+		RuleID:    f.Rule,
+		RuleIndex: i,
+		Level:     sarifLevel(f.Severity),
+		Message:   sarifText{f.Message},
+		Properties: map[string]string{
+			"source":   f.Source,
+			"evidence": f.Evidence,
+		},
+	}
+	if f.Resource != "" {
+		sr.Locations = []sarifLocation{{
+			PhysicalLocation: sarifPhysical{
+				ArtifactLocation: sarifArtifact{URI: string(f.Resource)},
+			},
+			LogicalLocations: []sarifLogical{{
+				FullyQualifiedName: string(f.Resource),
+				Kind:               "resource",
+			}},
+		}}
+	}
+	if suppressed {
+		sr.Suppressions = []sarifSuppression{{
+			Kind:          "external",
+			Justification: f.Reason,
+		}}
+	}
+	return sr
+}
+
+// securitySeverity maps rule severities to the CVSS-like scores used by code
+// scanning tools to classify results.
+var securitySeverity = [...]string{
+	Info:     "0.0",
+	Low:      "3.0",
+	Medium:   "5.5",
+	High:     "8.0",
+	Critical: "9.5",
+}
+
+// sarifLevel returns the SARIF result level for severity s.
+func sarifLevel(s Severity) string {
+	switch {
+	case s >= High:
+		return "error"
+	case s >= Low:
+		return "warning"
+	}
+	return "note"
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	ShortDescription     sarifText         `json:"shortDescription"`
+	DefaultConfiguration sarifConfig       `json:"defaultConfiguration"`
+	Properties           map[string]string `json:"properties"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId"`
+	RuleIndex    int                `json:"ruleIndex"`
+	Level        string             `json:"level"`
+	Message      sarifText          `json:"message"`
+	Locations    []sarifLocation    `json:"locations,omitempty"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+	Properties   map[string]string  `json:"properties"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysical  `json:"physicalLocation"`
+	LogicalLocations []sarifLogical `json:"logicalLocations"`
+}
+
+type sarifPhysical struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogical struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
@@ -0,0 +1,53 @@
+package check
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSARIF(t *testing.T) {
+	b, err := testReport(t).SARIF()
+	require.NoError(t, err)
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID                   string
+						DefaultConfiguration struct{ Level string }
+					}
+				}
+			}
+			Results []struct {
+				RuleID    string
+				RuleIndex int
+				Level     string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+					}
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(b, &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	require.Len(t, run.Tool.Driver.Rules, 2)
+	assert.Equal(t, "api-errors", run.Tool.Driver.Rules[0].ID)
+	assert.Equal(t, "warning", run.Tool.Driver.Rules[0].DefaultConfiguration.Level)
+	assert.Equal(t, "error", run.Tool.Driver.Rules[1].DefaultConfiguration.Level)
+	require.Len(t, run.Results, 1)
+	res := run.Results[0]
+	assert.Equal(t, "api-errors", res.RuleID)
+	assert.Equal(t, 0, res.RuleIndex)
+	assert.Equal(t, "warning", res.Level)
+	require.Len(t, res.Locations, 1)
+	assert.Equal(t, "arn:aws:ec2:us-east-1:123456789012:",
+		res.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+}
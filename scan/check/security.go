@@ -0,0 +1,227 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+var _ = Register("security",
+	&Rule{
+		ID:       "ec2-sg-open-ingress",
+		Title:    "Security groups do not allow ingress from 0.0.0.0/0 or ::/0",
+		Severity: High,
+		Eval:     sgOpenIngress,
+	},
+	&Rule{
+		ID:       "s3-public-policy",
+		Title:    "S3 bucket policies do not grant public access",
+		Severity: High,
+		Eval:     s3PublicPolicy,
+	},
+	&Rule{
+		ID:       "s3-public-acl",
+		Title:    "S3 bucket ACLs do not grant access to all or authenticated users",
+		Severity: High,
+		Eval:     s3PublicACL,
+	},
+	&Rule{
+		ID:       "kms-key-rotation",
+		Title:    "Customer managed KMS keys have automatic rotation enabled",
+		Severity: Medium,
+		Eval:     kmsKeyRotation,
+	},
+	&Rule{
+		ID:       "iam-password-policy",
+		Title:    "IAM account password policy is configured",
+		Severity: Medium,
+		Eval:     iamPasswordPolicy,
+	},
+	&Rule{
+		ID:       "cloudtrail-logging",
+		Title:    "CloudTrail trails are logging",
+		Severity: High,
+		Eval:     cloudtrailLogging,
+	},
+)
+
+func sgOpenIngress(ctx *Ctx) {
+	ctx.Each(func(out *ec2.DescribeSecurityGroupsOutput) {
+		if out == nil {
+			return
+		}
+		for i := range out.SecurityGroups {
+			sg := &out.SecurityGroups[i]
+			for j := range sg.IpPermissions {
+				p := &sg.IpPermissions[j]
+				var open []string
+				for _, r := range p.IpRanges {
+					if aws.StringValue(r.CidrIp) == "0.0.0.0/0" {
+						open = append(open, "0.0.0.0/0")
+					}
+				}
+				for _, r := range p.Ipv6Ranges {
+					if aws.StringValue(r.CidrIpv6) == "::/0" {
+						open = append(open, "::/0")
+					}
+				}
+				if len(open) > 0 {
+					res := ctx.Map().New("ec2", "security-group/", aws.StringValue(sg.GroupId))
+					ctx.Fail(res, "%s open to %s", portRange(p), strings.Join(open, ", "))
+				}
+			}
+		}
+	})
+}
+
+func s3PublicPolicy(ctx *Ctx) {
+	ctx.Each(func(out *s3.GetBucketPolicyOutput) {
+		if out != nil {
+			bucketPolicy(ctx, out)
+		}
+	})
+}
+
+func s3PublicACL(ctx *Ctx) {
+	ctx.Each(func(out *s3.GetBucketAclOutput) {
+		if out != nil {
+			bucketACL(ctx, out)
+		}
+	})
+}
+
+// kmsKeyRotation reports customer managed keys without rotation. Only keys that
+// DescribeKey shows to be AWS managed, disabled, or pending deletion are
+// ignored. Keys without DescribeKey results, such as when the call failed or
+// was skipped by limits, are reported, since they may need rotation.
+func kmsKeyRotation(ctx *Ctx) {
+	cmk := make(map[string]bool)
+	ctx.Each(func(out *kms.DescribeKeyOutput) {
+		if out == nil || out.KeyMetadata == nil {
+			return
+		}
+		k := out.KeyMetadata
+		cmk[arnKey(ctx, aws.StringValue(k.KeyId))] =
+			k.KeyManager == kms.KeyManagerTypeCustomer &&
+				k.KeyState == kms.KeyStateEnabled
+	})
+	ctx.Each(func(out *kms.GetKeyRotationStatusOutput) {
+		if out == nil || aws.BoolValue(out.KeyRotationEnabled) {
+			return
+		}
+		id := aws.StringValue(ctx.Call().In.(*kms.GetKeyRotationStatusInput).KeyId)
+		res := ctx.Map().New("kms", "key/", id)
+		if ok, known := cmk[arnKey(ctx, id)]; !known {
+			ctx.Fail(res, "key rotation disabled (key manager and state unknown)")
+		} else if ok {
+			ctx.Fail(res, "key rotation disabled")
+		}
+	})
+}
+
+func iamPasswordPolicy(ctx *Ctx) {
+	ctx.Each(func(out *iam.GetAccountPasswordPolicyOutput) {
+		if c := ctx.Call(); out == nil && c.Err != nil && c.Err.Ignore {
+			ctx.Fail(rootARN(ctx.Map()), "account password policy not set")
+		}
+	})
+}
+
+func cloudtrailLogging(ctx *Ctx) {
+	ctx.Each(func(out *cloudtrail.GetTrailStatusOutput) {
+		if out == nil || aws.BoolValue(out.IsLogging) {
+			return
+		}
+		name := aws.StringValue(ctx.Call().In.(*cloudtrail.GetTrailStatusInput).Name)
+		ctx.Fail(arn.ARN(name), "trail is not logging")
+	})
+}
+
+// bucketPolicy reports public statements in a bucket policy.
+func bucketPolicy(ctx *Ctx, out *s3.GetBucketPolicyOutput) {
+	if out.Policy == nil {
+		return
+	}
+	res := bucketARN(ctx)
+	doc, err := policy.Parse(*out.Policy)
+	if err != nil {
+		ctx.Fail(res, "invalid bucket policy: %v", err)
+		return
+	}
+	for i, s := range doc.Statement {
+		if s.Public() {
+			ctx.Fail(res, "statement %s allows public access", sid(s, i))
+		}
+	}
+}
+
+// bucketACL reports grants to all or authenticated users in a bucket ACL.
+func bucketACL(ctx *Ctx, out *s3.GetBucketAclOutput) {
+	const groups = "http://acs.amazonaws.com/groups/global/"
+	for _, g := range out.Grants {
+		if g.Grantee == nil {
+			continue
+		}
+		switch uri := aws.StringValue(g.Grantee.URI); uri {
+		case groups + "AllUsers", groups + "AuthenticatedUsers":
+			ctx.Fail(bucketARN(ctx), "%s granted to %s",
+				g.Permission, strings.TrimPrefix(uri, groups))
+		}
+	}
+}
+
+// bucketARN returns the ARN of the bucket accessed by the current call.
+func bucketARN(ctx *Ctx) arn.ARN {
+	bucket := bucketName(ctx.Call().In)
+	return arn.Ctx{Partition: ctx.Map().Partition}.New("s3", bucket)
+}
+
+// bucketName returns the bucket name from an S3 API input struct.
+func bucketName(in interface{}) string {
+	switch in := in.(type) {
+	case *s3.GetBucketPolicyInput:
+		return aws.StringValue(in.Bucket)
+	case *s3.GetBucketAclInput:
+		return aws.StringValue(in.Bucket)
+	case *s3.GetBucketLoggingInput:
+		return aws.StringValue(in.Bucket)
+	case *s3.GetBucketTaggingInput:
+		return aws.StringValue(in.Bucket)
+	}
+	return ""
+}
+
+// rootARN returns the ARN of the account root user.
+func rootARN(m *scan.Map) arn.ARN {
+	return arn.Ctx{Partition: m.Partition, Account: m.Account}.New("iam", "root")
+}
+
+// portRange returns a description of the protocol and ports in p.
+func portRange(p *ec2.IpPermission) string {
+	proto := aws.StringValue(p.IpProtocol)
+	if proto == "-1" {
+		return "all traffic"
+	}
+	from, to := aws.Int64Value(p.FromPort), aws.Int64Value(p.ToPort)
+	if from == to {
+		return fmt.Sprintf("%s port %d", proto, from)
+	}
+	return fmt.Sprintf("%s ports %d-%d", proto, from, to)
+}
+
+// sid returns the statement ID or its index if the ID is not set.
+func sid(s *policy.Statement, i int) string {
+	if s.Sid != "" {
+		return fmt.Sprintf("%q", s.Sid)
+	}
+	return fmt.Sprintf("#%d", i)
+}
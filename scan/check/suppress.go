@@ -0,0 +1,68 @@
+package check
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/pkg/errors"
+)
+
+// Suppression excludes matching findings from rule results. Rule and Resource
+// patterns may contain '*' and '?' wildcards. Empty patterns match everything,
+// but at least one pattern must be specified.
+type Suppression struct {
+	Rule     string `json:"rule,omitempty"`     // Rule ID pattern
+	Resource string `json:"resource,omitempty"` // Resource ARN pattern
+	Reason   string `json:"reason,omitempty"`   // Justification
+}
+
+// LoadSuppressions reads a JSON array of suppressions from file.
+func LoadSuppressions(file string) ([]*Suppression, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var all []*Suppression
+	if err = json.Unmarshal(b, &all); err != nil {
+		return nil, errors.Wrapf(err, "invalid suppression file %q", file)
+	}
+	for i, s := range all {
+		if s.Rule == "" && s.Resource == "" {
+			return nil, errors.Errorf("suppression %d in %q matches all findings", i, file)
+		}
+	}
+	return all, nil
+}
+
+// match returns true if s matches finding f.
+func (s *Suppression) match(f *Finding) bool {
+	return (s.Rule == "" || policy.Match(s.Rule, f.Rule, false)) &&
+		(s.Resource == "" || policy.Match(s.Resource, string(f.Resource), false))
+}
+
+// Suppress moves findings that match any suppression in list to the Suppressed
+// list of each result and updates result status.
+func (r *Report) Suppress(list []*Suppression) {
+	if len(list) == 0 {
+		return
+	}
+	for _, res := range r.Results {
+		keep := res.Findings[:0]
+	next:
+		for _, f := range res.Findings {
+			for _, s := range list {
+				if s.match(f) {
+					f.Reason = s.Reason
+					res.Suppressed = append(res.Suppressed, f)
+					continue next
+				}
+			}
+			keep = append(keep, f)
+		}
+		if res.Findings = keep; len(keep) == 0 {
+			res.Findings = nil
+		}
+		res.setStatus()
+	}
+}
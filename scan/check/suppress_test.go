@@ -0,0 +1,41 @@
+package check
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "suppress.json")
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[{"reason": "all"}]`), 0644))
+	_, err = LoadSuppressions(file)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[
+		{"rule": "api-*", "resource": "arn:aws:ec2:*", "reason": "known"}
+	]`), 0644))
+	list, err := LoadSuppressions(file)
+	require.NoError(t, err)
+
+	r := testReport(t)
+	r.Suppress(list)
+	res := r.Results[0]
+	assert.Equal(t, Pass, res.Status)
+	assert.Empty(t, res.Findings)
+	require.Len(t, res.Suppressed, 1)
+	assert.Equal(t, "known", res.Suppressed[0].Reason)
+	assert.Empty(t, r.Findings())
+
+	b, err := r.SARIF()
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"justification": "known"`)
+}
@@ -0,0 +1,368 @@
+package check
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elb"
+	"github.com/aws/aws-sdk-go-v2/service/elbv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/pkg/errors"
+)
+
+// TagPolicy specifies the tags required on resources of matching types.
+// Resource types are "<service>:<type>" strings derived from resource ARNs
+// (e.g. "ec2:instance", "s3:bucket", "rds:db"). Resource and value patterns may
+// contain '*' and '?' wildcards. An empty list of values allows any value.
+type TagPolicy struct {
+	Resource string              `json:"resource"` // Resource type pattern
+	Tags     map[string][]string `json:"tags"`     // Required keys and allowed value patterns
+}
+
+// LoadTagPolicy reads a JSON array of tag policies from file.
+func LoadTagPolicy(file string) ([]*TagPolicy, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var all []*TagPolicy
+	if err = json.Unmarshal(b, &all); err != nil {
+		return nil, errors.Wrapf(err, "invalid tag policy file %q", file)
+	}
+	for i, p := range all {
+		if p.Resource == "" || len(p.Tags) == 0 {
+			return nil, errors.Errorf("tag policy %d in %q is incomplete", i, file)
+		}
+	}
+	return all, nil
+}
+
+// TagPolicyRule returns a rule that reports resources that do not comply with
+// all matching tag policies in list.
+func TagPolicyRule(list []*TagPolicy) *Rule {
+	return &Rule{
+		ID:       "tag-policy",
+		Title:    "Resources have the tags required by tag policy",
+		Severity: Low,
+		Eval: func(ctx *Ctx) {
+			eachTagged(ctx, func(r Ref, res arn.ARN, tags map[string]string) {
+				typ := resourceType(res)
+				for _, p := range list {
+					if policy.Match(p.Resource, typ, false) {
+						p.eval(ctx, r, res, tags)
+					}
+				}
+			})
+		},
+	}
+}
+
+// eval reports each tag required by p that is missing from tags or has a
+// value that is not allowed.
+func (p *TagPolicy) eval(ctx *Ctx, r Ref, res arn.ARN, tags map[string]string) {
+	for key, allowed := range p.Tags {
+		v, ok := tags[key]
+		if !ok {
+			ctx.FailAt(r, res, "missing tag %q", key)
+			continue
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		match := false
+		for _, pat := range allowed {
+			if match = policy.Match(pat, v, false); match {
+				break
+			}
+		}
+		if !match {
+			ctx.FailAt(r, res, "tag %q value %q is not allowed", key, v)
+		}
+	}
+}
+
+// defaultTypes contains resource types for ARNs that do not have one.
+var defaultTypes = map[string]string{
+	"s3":  "bucket",
+	"sns": "topic",
+	"sqs": "queue",
+}
+
+// resourceType returns the "<service>:<type>" string for ARN r.
+func resourceType(r arn.ARN) string {
+	svc, typ := r.Service(), r.Type()
+	if typ == "" {
+		typ = defaultTypes[svc]
+	}
+	return svc + ":" + typ
+}
+
+// tagged is one resource and its tags.
+type tagged struct {
+	ref  Ref
+	tags map[string]string
+}
+
+// eachTagged calls fn for every resource with tags in the scan results in ARN
+// order. Tags from multiple pages are combined, and the first call that
+// returned the resource tags is used as evidence.
+func eachTagged(ctx *Ctx, fn func(r Ref, res arn.ARN, tags map[string]string)) {
+	all := make(map[arn.ARN]*tagged)
+	add := func(res arn.ARN, tags interface{}) {
+		if res == "" {
+			return
+		}
+		t := all[res]
+		if t == nil {
+			t = &tagged{ref: ctx.Ref(), tags: make(map[string]string)}
+			all[res] = t
+		}
+		tagMap(t.tags, tags)
+	}
+	in := func() interface{} { return ctx.Call().In }
+
+	// EC2 resources include tags in Describe outputs
+	ec2ARN := func(typ string, id *string) arn.ARN {
+		return ctx.Map().New("ec2", typ, aws.StringValue(id))
+	}
+	ctx.Each(func(out *ec2.DescribeInstancesOutput) {
+		if out != nil {
+			for _, r := range out.Reservations {
+				for _, i := range r.Instances {
+					add(ec2ARN("instance/", i.InstanceId), i.Tags)
+				}
+			}
+		}
+	})
+	ctx.Each(func(out *ec2.DescribeSecurityGroupsOutput) {
+		if out != nil {
+			for _, sg := range out.SecurityGroups {
+				add(ec2ARN("security-group/", sg.GroupId), sg.Tags)
+			}
+		}
+	})
+	ctx.Each(func(out *ec2.DescribeSubnetsOutput) {
+		if out != nil {
+			for _, s := range out.Subnets {
+				add(ec2ARN("subnet/", s.SubnetId), s.Tags)
+			}
+		}
+	})
+	ctx.Each(func(out *ec2.DescribeVolumesOutput) {
+		if out != nil {
+			for _, v := range out.Volumes {
+				add(ec2ARN("volume/", v.VolumeId), v.Tags)
+			}
+		}
+	})
+	ctx.Each(func(out *ec2.DescribeVpcsOutput) {
+		if out != nil {
+			for _, v := range out.Vpcs {
+				add(ec2ARN("vpc/", v.VpcId), v.Tags)
+			}
+		}
+	})
+
+	// Other services have separate tag APIs
+	ctx.Each(func(out *acm.ListTagsForCertificateOutput) {
+		if out != nil {
+			add(arn.Value(in().(*acm.ListTagsForCertificateInput).CertificateArn), out.Tags)
+		}
+	})
+	ctx.Each(func(out *acmpca.ListTagsOutput) {
+		if out != nil {
+			add(arn.Value(in().(*acmpca.ListTagsInput).CertificateAuthorityArn), out.Tags)
+		}
+	})
+	ctx.Each(func(out *cloudtrail.ListTagsOutput) {
+		if out != nil {
+			for _, t := range out.ResourceTagList {
+				add(arn.Value(t.ResourceId), t.TagsList)
+			}
+		}
+	})
+	ctx.Each(func(out *cloudwatchlogs.ListTagsLogGroupOutput) {
+		if out != nil {
+			name := in().(*cloudwatchlogs.ListTagsLogGroupInput).LogGroupName
+			add(ctx.Map().New("logs", "log-group:", aws.StringValue(name)), out.Tags)
+		}
+	})
+	ctx.Each(func(out *dynamodb.ListTagsOfResourceOutput) {
+		if out != nil {
+			add(arn.Value(in().(*dynamodb.ListTagsOfResourceInput).ResourceArn), out.Tags)
+		}
+	})
+	ctx.Each(func(out *efs.DescribeTagsOutput) {
+		if out != nil {
+			id := in().(*efs.DescribeTagsInput).FileSystemId
+			add(ctx.Map().New("elasticfilesystem", "file-system/", aws.StringValue(id)), out.Tags)
+		}
+	})
+	eachOutput(ctx, elasticache.EndpointsID, "ListTagsForResource", func(out interface{}) {
+		// ListTagsForResource returns RemoveTagsFromResourceOutput
+		if out, ok := out.(*elasticache.RemoveTagsFromResourceOutput); ok {
+			in := in().(*elasticache.ListTagsForResourceInput)
+			add(arn.Value(in.ResourceName), out.TagList)
+		}
+	})
+	ctx.Each(func(out *elb.DescribeTagsOutput) {
+		if out != nil {
+			for _, d := range out.TagDescriptions {
+				name := aws.StringValue(d.LoadBalancerName)
+				add(ctx.Map().New("elasticloadbalancing", "loadbalancer/", name), d.Tags)
+			}
+		}
+	})
+	ctx.Each(func(out *elbv2.DescribeTagsOutput) {
+		if out != nil {
+			for _, d := range out.TagDescriptions {
+				add(arn.Value(d.ResourceArn), d.Tags)
+			}
+		}
+	})
+	ctx.Each(func(out *iam.ListRoleTagsOutput) {
+		if out != nil {
+			name := aws.StringValue(in().(*iam.ListRoleTagsInput).RoleName)
+			add(iamARN(ctx, "role/", name), out.Tags)
+		}
+	})
+	ctx.Each(func(out *iam.ListUserTagsOutput) {
+		if out != nil {
+			name := aws.StringValue(in().(*iam.ListUserTagsInput).UserName)
+			add(iamARN(ctx, "user/", name), out.Tags)
+		}
+	})
+	ctx.Each(func(out *kinesis.ListTagsForStreamOutput) {
+		if out != nil {
+			name := in().(*kinesis.ListTagsForStreamInput).StreamName
+			add(ctx.Map().New("kinesis", "stream/", aws.StringValue(name)), out.Tags)
+		}
+	})
+	ctx.Each(func(out *kms.ListResourceTagsOutput) {
+		if out != nil {
+			id := aws.StringValue(in().(*kms.ListResourceTagsInput).KeyId)
+			res := arn.ARN(id)
+			if !strings.HasPrefix(id, "arn:") {
+				res = ctx.Map().New("kms", "key/", id)
+			}
+			add(res, out.Tags)
+		}
+	})
+	ctx.Each(func(out *lambda.ListTagsOutput) {
+		if out != nil {
+			add(arn.Value(in().(*lambda.ListTagsInput).Resource), out.Tags)
+		}
+	})
+	ctx.Each(func(out *rds.ListTagsForResourceOutput) {
+		if out != nil {
+			add(arn.Value(in().(*rds.ListTagsForResourceInput).ResourceName), out.TagList)
+		}
+	})
+	ctx.Each(func(out *s3.GetBucketTaggingOutput) {
+		if out != nil {
+			add(bucketARN(ctx), out.TagSet)
+		} else if err := ctx.Call().Err; err != nil && err.Ignore {
+			add(bucketARN(ctx), nil) // NoSuchTagSet
+		}
+	})
+	ctx.Each(func(out *sqs.ListQueueTagsOutput) {
+		if out != nil {
+			url := aws.StringValue(in().(*sqs.ListQueueTagsInput).QueueUrl)
+			add(ctx.Map().New("sqs", path.Base(url)), out.Tags)
+		}
+	})
+
+	keys := make([]arn.ARN, 0, len(all))
+	for res := range all {
+		keys = append(keys, res)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, res := range keys {
+		t := all[res]
+		fn(t.ref, res, t.tags)
+	}
+}
+
+// eachOutput calls fn for every output of svc.api calls. It is used instead of
+// Each for APIs whose output type name does not match the API name.
+func eachOutput(ctx *Ctx, svc, api string, fn func(out interface{})) {
+	for _, m := range ctx.Maps {
+		if m.Service != svc {
+			continue
+		}
+		for _, c := range m.Calls[api] {
+			ctx.visit(m, api, c)
+			for _, out := range c.Out {
+				fn(out)
+			}
+		}
+	}
+	ctx.m, ctx.api, ctx.c = nil, "", nil
+}
+
+// iamARN returns the ARN of an IAM resource in the current account.
+func iamARN(ctx *Ctx, typ, name string) arn.ARN {
+	m := ctx.Map()
+	return arn.Ctx{Partition: m.Partition, Account: m.Account}.New("iam", typ, name)
+}
+
+// tagMap adds tags to dst. Tags may be specified as a map of strings or a
+// slice of service-specific tag structs with Key/Value or TagKey/TagValue
+// fields.
+func tagMap(dst map[string]string, tags interface{}) {
+	if m, ok := tags.(map[string]string); ok {
+		for k, v := range m {
+			dst[k] = v
+		}
+		return
+	}
+	v := reflect.ValueOf(tags)
+	if v.Kind() != reflect.Slice {
+		return
+	}
+	str := func(t reflect.Value, name string) (string, bool) {
+		f := t.FieldByName(name)
+		if !f.IsValid() || f.Kind() != reflect.Ptr || f.IsNil() {
+			return "", false
+		}
+		return f.Elem().String(), true
+	}
+	for i := 0; i < v.Len(); i++ {
+		t := reflect.Indirect(v.Index(i))
+		if t.Kind() != reflect.Struct {
+			continue
+		}
+		k, ok := str(t, "Key")
+		if !ok {
+			if k, ok = str(t, "TagKey"); !ok {
+				continue
+			}
+		}
+		val, ok := str(t, "Value")
+		if !ok {
+			val, _ = str(t, "TagValue")
+		}
+		dst[k] = val
+	}
+}
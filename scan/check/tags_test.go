@@ -0,0 +1,134 @@
+package check
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "tags.json")
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[{"resource": "*"}]`), 0644))
+	_, err = LoadTagPolicy(file)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[
+		{"resource": "*", "tags": {"Owner": []}},
+		{"resource": "ec2:*", "tags": {"Environment": ["prod", "dev-*"]}}
+	]`), 0644))
+	list, err := LoadTagPolicy(file)
+	require.NoError(t, err)
+
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	newMap := func(svc string, calls map[string][]*scan.Call) *scan.Map {
+		return &scan.Map{Ctx: ac, Service: svc, Calls: calls}
+	}
+	out := func(v ...interface{}) []interface{} { return v }
+	const cluster = "arn:aws:elasticache:us-east-1:123456789012:cluster:c1"
+	maps := []*scan.Map{
+		newMap("ec2", map[string][]*scan.Call{
+			"DescribeInstances": {{ID: "ec2", Out: out(&ec2.DescribeInstancesOutput{
+				Reservations: []ec2.RunInstancesOutput{{
+					Instances: []ec2.Instance{{
+						InstanceId: aws.String("i-1"),
+						Tags: []ec2.Tag{
+							{Key: aws.String("Owner"), Value: aws.String("alice")},
+							{Key: aws.String("Environment"), Value: aws.String("dev-1")},
+						},
+					}, {
+						InstanceId: aws.String("i-2"),
+						Tags: []ec2.Tag{
+							{Key: aws.String("Environment"), Value: aws.String("test")},
+						},
+					}},
+				}},
+			})}},
+		}),
+		newMap("elasticache", map[string][]*scan.Call{
+			"ListTagsForResource": {{
+				ID: "ec",
+				In: &elasticache.ListTagsForResourceInput{ResourceName: aws.String(cluster)},
+				Out: out(&elasticache.RemoveTagsFromResourceOutput{
+					TagList: []elasticache.Tag{{Key: aws.String("Owner"), Value: aws.String("bob")}},
+				}),
+			}},
+		}),
+		newMap("kms", map[string][]*scan.Call{
+			"ListResourceTags": {{
+				ID: "kms",
+				In: &kms.ListResourceTagsInput{KeyId: aws.String("k1")},
+				Out: out(&kms.ListResourceTagsOutput{
+					Tags: []kms.Tag{{TagKey: aws.String("owner"), TagValue: aws.String("bob")}},
+				}),
+			}},
+		}),
+		newMap("s3", map[string][]*scan.Call{
+			"GetBucketTagging": {{
+				ID:  "s3",
+				In:  &s3.GetBucketTaggingInput{Bucket: aws.String("b1")},
+				Err: &scan.Err{Status: 404, Code: "NoSuchTagSet", Ignore: true},
+			}},
+		}),
+		newMap("sqs", map[string][]*scan.Call{
+			"ListQueueTags": {{
+				ID: "sqs",
+				In: &sqs.ListQueueTagsInput{
+					QueueUrl: aws.String("https://sqs.us-east-1.amazonaws.com/123456789012/q1"),
+				},
+				Out: out(&sqs.ListQueueTagsOutput{Tags: map[string]string{"Owner": "carol"}}),
+			}},
+		}),
+	}
+
+	r := Run(maps, []*Rule{TagPolicyRule(list)})
+	res := r.Results[0]
+	assert.Equal(t, Fail, res.Status)
+	assert.Equal(t, []string{"ec", "ec2", "kms", "s3", "sqs"}, res.Evidence)
+	type finding struct{ res, msg, ev string }
+	var have []finding
+	for _, f := range res.Findings {
+		have = append(have, finding{string(f.Resource), f.Message, f.Evidence})
+	}
+	assert.Equal(t, []finding{{
+		"arn:aws:ec2:us-east-1:123456789012:instance/i-2",
+		`missing tag "Owner"`, "ec2",
+	}, {
+		"arn:aws:ec2:us-east-1:123456789012:instance/i-2",
+		`tag "Environment" value "test" is not allowed`, "ec2",
+	}, {
+		"arn:aws:kms:us-east-1:123456789012:key/k1",
+		`missing tag "Owner"`, "kms",
+	}, {
+		"arn:aws:s3:::b1",
+		`missing tag "Owner"`, "s3",
+	}}, have)
+}
+
+func TestResourceType(t *testing.T) {
+	tests := []struct{ arn, typ string }{
+		{"arn:aws:ec2:us-east-1:123456789012:instance/i-1", "ec2:instance"},
+		{"arn:aws:rds:us-east-1:123456789012:db:db1", "rds:db"},
+		{"arn:aws:s3:::bucket", "s3:bucket"},
+		{"arn:aws:sqs:us-east-1:123456789012:q1", "sqs:queue"},
+		{"arn:aws:iam::123456789012:role/path/r1", "iam:role"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.typ, resourceType(arn.ARN(tc.arn)), "%s", tc.arn)
+	}
+}
@@ -0,0 +1,227 @@
+package check
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/elbv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// Resources that are likely unused or misconfigured and incurring cost.
+var _ = Register("unused",
+	&Rule{
+		ID:       "ec2-unattached-volume",
+		Title:    "EBS volumes are attached to instances",
+		Severity: Low,
+		Eval:     unattachedVolume,
+	},
+	&Rule{
+		ID:       "ec2-unassociated-eip",
+		Title:    "Elastic IP addresses are associated with instances or interfaces",
+		Severity: Low,
+		Eval:     unassociatedEIP,
+	},
+	&Rule{
+		ID:       "ec2-available-eni",
+		Title:    "Network interfaces are attached",
+		Severity: Low,
+		Eval:     availableENI,
+	},
+	&Rule{
+		ID:       "ec2-unused-sg",
+		Title:    "Security groups are used by at least one network interface",
+		Severity: Info,
+		Eval:     unusedSG,
+	},
+	&Rule{
+		ID:       "elbv2-no-healthy-targets",
+		Title:    "Target groups have at least one healthy target",
+		Severity: Low,
+		Eval:     noHealthyTargets,
+	},
+	&Rule{
+		ID:       "iam-unused-access-key",
+		Title:    "IAM access keys have been used",
+		Severity: Low,
+		Eval:     unusedAccessKey,
+	},
+	&Rule{
+		ID:       "logs-no-retention",
+		Title:    "CloudWatch log groups have a retention period",
+		Severity: Info,
+		Eval:     logsNoRetention,
+	},
+	&Rule{
+		ID:       "autoscaling-unused-launch-config",
+		Title:    "Launch configurations are used by at least one Auto Scaling group",
+		Severity: Info,
+		Eval:     unusedLaunchConfig,
+	},
+)
+
+func unattachedVolume(ctx *Ctx) {
+	ctx.Each(func(out *ec2.DescribeVolumesOutput) {
+		if out == nil {
+			return
+		}
+		for _, v := range out.Volumes {
+			if v.State == ec2.VolumeStateAvailable {
+				res := ctx.Map().New("ec2", "volume/", aws.StringValue(v.VolumeId))
+				ctx.Fail(res, "%d GiB %s volume is not attached",
+					aws.Int64Value(v.Size), v.VolumeType)
+			}
+		}
+	})
+}
+
+func unassociatedEIP(ctx *Ctx) {
+	ctx.Each(func(out *ec2.DescribeAddressesOutput) {
+		if out == nil {
+			return
+		}
+		for _, a := range out.Addresses {
+			if a.AssociationId == nil && a.InstanceId == nil &&
+				a.NetworkInterfaceId == nil {
+				id := aws.StringValue(a.AllocationId)
+				if id == "" {
+					id = aws.StringValue(a.PublicIp) // EC2-Classic
+				}
+				res := ctx.Map().New("ec2", "elastic-ip/", id)
+				ctx.Fail(res, "%s is not associated", aws.StringValue(a.PublicIp))
+			}
+		}
+	})
+}
+
+func availableENI(ctx *Ctx) {
+	seen := make(map[string]bool)
+	ctx.Each(func(out *ec2.DescribeNetworkInterfacesOutput) {
+		if out == nil {
+			return
+		}
+		for _, ni := range out.NetworkInterfaces {
+			id := aws.StringValue(ni.NetworkInterfaceId)
+			if ni.Status == ec2.NetworkInterfaceStatusAvailable && !seen[arnKey(ctx, id)] {
+				seen[arnKey(ctx, id)] = true
+				res := ctx.Map().New("ec2", "network-interface/", id)
+				ctx.Fail(res, "network interface is not attached")
+			}
+		}
+	})
+}
+
+func unusedSG(ctx *Ctx) {
+	// Security groups are only reported for regions with ENI information
+	used := make(map[string]bool)
+	known := make(map[string]bool)
+	ctx.Each(func(out *ec2.DescribeNetworkInterfacesOutput) {
+		if out == nil {
+			return
+		}
+		known[arnKey(ctx, "")] = true
+		for _, ni := range out.NetworkInterfaces {
+			for _, g := range ni.Groups {
+				used[arnKey(ctx, aws.StringValue(g.GroupId))] = true
+			}
+		}
+	})
+	ctx.Each(func(out *ec2.DescribeSecurityGroupsOutput) {
+		if out == nil || !known[arnKey(ctx, "")] {
+			return
+		}
+		for _, sg := range out.SecurityGroups {
+			id := aws.StringValue(sg.GroupId)
+			if aws.StringValue(sg.GroupName) != "default" && !used[arnKey(ctx, id)] {
+				res := ctx.Map().New("ec2", "security-group/", id)
+				ctx.Fail(res, "security group %q is not used by any network interface",
+					aws.StringValue(sg.GroupName))
+			}
+		}
+	})
+}
+
+func noHealthyTargets(ctx *Ctx) {
+	ctx.Each(func(out *elbv2.DescribeTargetHealthOutput) {
+		if out == nil {
+			return
+		}
+		healthy := 0
+		for _, t := range out.TargetHealthDescriptions {
+			if t.TargetHealth != nil &&
+				t.TargetHealth.State == elbv2.TargetHealthStateEnumHealthy {
+				healthy++
+			}
+		}
+		if healthy > 0 {
+			return
+		}
+		in := ctx.Call().In.(*elbv2.DescribeTargetHealthInput)
+		res := arn.Value(in.TargetGroupArn)
+		if n := len(out.TargetHealthDescriptions); n == 0 {
+			ctx.Fail(res, "target group has no registered targets")
+		} else {
+			ctx.Fail(res, "none of %d registered target(s) are healthy", n)
+		}
+	})
+}
+
+func unusedAccessKey(ctx *Ctx) {
+	ctx.Each(func(out *iam.GetAccessKeyLastUsedOutput) {
+		if out == nil || out.AccessKeyLastUsed != nil &&
+			out.AccessKeyLastUsed.LastUsedDate != nil {
+			return
+		}
+		key := aws.StringValue(ctx.Call().In.(*iam.GetAccessKeyLastUsedInput).AccessKeyId)
+		m := ctx.Map()
+		res := arn.Ctx{Partition: m.Partition, Account: m.Account}.New(
+			"iam", "user/", aws.StringValue(out.UserName))
+		ctx.Fail(res, "access key %s has never been used", key)
+	})
+}
+
+func logsNoRetention(ctx *Ctx) {
+	ctx.Each(func(out *cloudwatchlogs.DescribeLogGroupsOutput) {
+		if out == nil {
+			return
+		}
+		for _, g := range out.LogGroups {
+			if g.RetentionInDays == nil {
+				res := arn.ARN(strings.TrimSuffix(aws.StringValue(g.Arn), ":*"))
+				ctx.Fail(res, "log group %q never expires events",
+					aws.StringValue(g.LogGroupName))
+			}
+		}
+	})
+}
+
+func unusedLaunchConfig(ctx *Ctx) {
+	// Launch configurations are only reported for regions with ASG information
+	used := make(map[string]bool)
+	known := make(map[string]bool)
+	ctx.Each(func(out *autoscaling.DescribeAutoScalingGroupsOutput) {
+		if out == nil {
+			return
+		}
+		known[arnKey(ctx, "")] = true
+		for _, g := range out.AutoScalingGroups {
+			used[arnKey(ctx, aws.StringValue(g.LaunchConfigurationName))] = true
+		}
+	})
+	ctx.Each(func(out *autoscaling.DescribeLaunchConfigurationsOutput) {
+		if out == nil || !known[arnKey(ctx, "")] {
+			return
+		}
+		for _, lc := range out.LaunchConfigurations {
+			name := aws.StringValue(lc.LaunchConfigurationName)
+			if !used[arnKey(ctx, name)] {
+				ctx.Fail(arn.Value(lc.LaunchConfigurationARN),
+					"launch configuration %q is not used by any Auto Scaling group", name)
+			}
+		}
+	})
+}
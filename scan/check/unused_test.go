@@ -0,0 +1,163 @@
+package check
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/elbv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnused(t *testing.T) {
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	newMap := func(svc string, calls map[string][]*scan.Call) *scan.Map {
+		return &scan.Map{Ctx: ac, Service: svc, Calls: calls}
+	}
+	out := func(v ...interface{}) []interface{} { return v }
+	const tg = "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/tg/1"
+	maps := []*scan.Map{
+		newMap("ec2", map[string][]*scan.Call{
+			"DescribeVolumes": {{ID: "vol", Out: out(&ec2.DescribeVolumesOutput{
+				Volumes: []ec2.CreateVolumeOutput{{
+					VolumeId:   aws.String("vol-1"),
+					State:      ec2.VolumeStateAvailable,
+					Size:       aws.Int64(8),
+					VolumeType: ec2.VolumeTypeGp2,
+				}, {
+					VolumeId: aws.String("vol-2"),
+					State:    ec2.VolumeStateInUse,
+				}},
+			})}},
+			"DescribeAddresses": {{ID: "eip", Out: out(&ec2.DescribeAddressesOutput{
+				Addresses: []ec2.Address{{
+					AllocationId: aws.String("eipalloc-1"),
+					PublicIp:     aws.String("192.0.2.1"),
+				}, {
+					AllocationId:  aws.String("eipalloc-2"),
+					AssociationId: aws.String("eipassoc-2"),
+				}},
+			})}},
+			"DescribeNetworkInterfaces": {{ID: "eni", Out: out(&ec2.DescribeNetworkInterfacesOutput{
+				NetworkInterfaces: []ec2.NetworkInterface{{
+					NetworkInterfaceId: aws.String("eni-1"),
+					Status:             ec2.NetworkInterfaceStatusAvailable,
+				}, {
+					NetworkInterfaceId: aws.String("eni-2"),
+					Status:             ec2.NetworkInterfaceStatusInUse,
+					Groups:             []ec2.GroupIdentifier{{GroupId: aws.String("sg-1")}},
+				}},
+			})}},
+			"DescribeSecurityGroups": {{ID: "sg", Out: out(&ec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []ec2.SecurityGroup{
+					{GroupId: aws.String("sg-0"), GroupName: aws.String("default")},
+					{GroupId: aws.String("sg-1"), GroupName: aws.String("web")},
+					{GroupId: aws.String("sg-2"), GroupName: aws.String("old")},
+				},
+			})}},
+		}),
+		newMap("elbv2", map[string][]*scan.Call{
+			"DescribeTargetHealth": {{
+				ID: "tg",
+				In: &elbv2.DescribeTargetHealthInput{TargetGroupArn: aws.String(tg)},
+				Out: out(&elbv2.DescribeTargetHealthOutput{
+					TargetHealthDescriptions: []elbv2.TargetHealthDescription{{
+						TargetHealth: &elbv2.TargetHealth{State: elbv2.TargetHealthStateEnumUnhealthy},
+					}},
+				}),
+			}},
+		}),
+		newMap("iam", map[string][]*scan.Call{
+			"GetAccessKeyLastUsed": {{
+				ID: "key1",
+				In: &iam.GetAccessKeyLastUsedInput{AccessKeyId: aws.String("AKIA1")},
+				Out: out(&iam.GetAccessKeyLastUsedOutput{
+					UserName:          aws.String("alice"),
+					AccessKeyLastUsed: &iam.AccessKeyLastUsed{Region: aws.String("N/A")},
+				}),
+			}, {
+				ID: "key2",
+				In: &iam.GetAccessKeyLastUsedInput{AccessKeyId: aws.String("AKIA2")},
+				Out: out(&iam.GetAccessKeyLastUsedOutput{
+					UserName:          aws.String("alice"),
+					AccessKeyLastUsed: &iam.AccessKeyLastUsed{LastUsedDate: aws.Time(time.Now())},
+				}),
+			}},
+		}),
+		newMap("cloudwatchlogs", map[string][]*scan.Call{
+			"DescribeLogGroups": {{ID: "logs", Out: out(&cloudwatchlogs.DescribeLogGroupsOutput{
+				LogGroups: []cloudwatchlogs.LogGroup{{
+					Arn:          aws.String("arn:aws:logs:us-east-1:123456789012:log-group:a:*"),
+					LogGroupName: aws.String("a"),
+				}, {
+					Arn:             aws.String("arn:aws:logs:us-east-1:123456789012:log-group:b:*"),
+					LogGroupName:    aws.String("b"),
+					RetentionInDays: aws.Int64(30),
+				}},
+			})}},
+		}),
+		newMap("autoscaling", map[string][]*scan.Call{
+			"DescribeAutoScalingGroups": {{ID: "asg", Out: out(&autoscaling.DescribeAutoScalingGroupsOutput{
+				AutoScalingGroups: []autoscaling.Group{{
+					LaunchConfigurationName: aws.String("lc-1"),
+				}},
+			})}},
+			"DescribeLaunchConfigurations": {{ID: "lc", Out: out(&autoscaling.DescribeLaunchConfigurationsOutput{
+				LaunchConfigurations: []autoscaling.LaunchConfiguration{{
+					LaunchConfigurationName: aws.String("lc-1"),
+					LaunchConfigurationARN:  aws.String("arn:lc-1"),
+				}, {
+					LaunchConfigurationName: aws.String("lc-2"),
+					LaunchConfigurationARN:  aws.String("arn:lc-2"),
+				}},
+			})}},
+		}),
+	}
+
+	rules, err := Rules("unused")
+	require.NoError(t, err)
+	r := Run(maps, rules)
+	type finding struct{ res, msg string }
+	have := make(map[string][]finding)
+	for _, f := range r.Findings() {
+		have[f.Rule] = append(have[f.Rule], finding{string(f.Resource), f.Message})
+	}
+	assert.Equal(t, map[string][]finding{
+		"ec2-unattached-volume": {{
+			"arn:aws:ec2:us-east-1:123456789012:volume/vol-1",
+			"8 GiB gp2 volume is not attached",
+		}},
+		"ec2-unassociated-eip": {{
+			"arn:aws:ec2:us-east-1:123456789012:elastic-ip/eipalloc-1",
+			"192.0.2.1 is not associated",
+		}},
+		"ec2-available-eni": {{
+			"arn:aws:ec2:us-east-1:123456789012:network-interface/eni-1",
+			"network interface is not attached",
+		}},
+		"ec2-unused-sg": {{
+			"arn:aws:ec2:us-east-1:123456789012:security-group/sg-2",
+			`security group "old" is not used by any network interface`,
+		}},
+		"elbv2-no-healthy-targets": {{tg, "none of 1 registered target(s) are healthy"}},
+		"iam-unused-access-key": {{
+			"arn:aws:iam::123456789012:user/alice",
+			"access key AKIA1 has never been used",
+		}},
+		"logs-no-retention": {{
+			"arn:aws:logs:us-east-1:123456789012:log-group:a",
+			`log group "a" never expires events`,
+		}},
+		"autoscaling-unused-launch-config": {{
+			"arn:lc-2",
+			`launch configuration "lc-2" is not used by any Auto Scaling group`,
+		}},
+	}, have)
+}
@@ -0,0 +1,318 @@
+// Package cost estimates monthly costs of scanned resources using offline
+// price lists.
+package cost
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/elb"
+	"github.com/aws/aws-sdk-go-v2/service/elbv2"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// HoursPerMonth is used to convert hourly prices to monthly costs.
+const HoursPerMonth = 730
+
+// Estimate is the estimated monthly cost of all scanned resources.
+type Estimate struct {
+	Currency string   `json:"currency"`
+	Monthly  float64  `json:"monthly"`
+	Unpriced int      `json:"unpriced,omitempty"` // Number of items without a price
+	Groups   []*Group `json:"groups"`
+}
+
+// Group is the estimated monthly cost of resources in one account, region, and
+// service.
+type Group struct {
+	Account string  `json:"account"`
+	Region  string  `json:"region"`
+	Service string  `json:"service"`
+	Monthly float64 `json:"monthly"`
+	Items   []*Item `json:"items"`
+}
+
+// Item is the estimated monthly cost of one billable component of a resource.
+type Item struct {
+	Resource arn.ARN `json:"resource"`
+	Usage    string  `json:"usage"` // Instance type, volume type, etc.
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+	Monthly  float64 `json:"monthly"`
+	Unpriced bool    `json:"unpriced,omitempty"` // Price not found
+}
+
+// Estimate returns the estimated monthly cost of running EC2 instances, EBS
+// volumes, NAT gateways, load balancers, RDS instances, and DynamoDB tables
+// with provisioned capacity in maps, which must not be compacted. Data
+// transfer and other usage-based charges are not included.
+func (p *Prices) Estimate(maps []*scan.Map) *Estimate {
+	e := &Estimate{Currency: Currency, Groups: []*Group{}}
+	for _, m := range maps {
+		g := &Group{
+			Account: m.Account,
+			Region:  m.Region,
+			Service: m.Service,
+		}
+		est := &estimator{p: p, m: m, g: g, seen: make(map[string]bool)}
+		scan.Walk([]*scan.Map{m}, func(_ *scan.Map, _ string, c *scan.Call) error {
+			for _, out := range c.Out {
+				est.add(out)
+			}
+			return nil
+		})
+		if len(g.Items) == 0 {
+			continue
+		}
+		sort.SliceStable(g.Items, func(i, j int) bool {
+			return g.Items[i].Resource < g.Items[j].Resource
+		})
+		for _, it := range g.Items {
+			if it.Unpriced {
+				e.Unpriced++
+			}
+			g.Monthly += it.Monthly
+		}
+		g.Monthly = round(g.Monthly)
+		e.Monthly += g.Monthly
+		e.Groups = append(e.Groups, g)
+	}
+	e.Monthly = round(e.Monthly)
+	return e
+}
+
+// estimator adds items for resources in one map.
+type estimator struct {
+	p    *Prices
+	m    *scan.Map
+	g    *Group
+	seen map[string]bool
+}
+
+// add adds items for all billable resources in API output v.
+func (est *estimator) add(v interface{}) {
+	switch out := v.(type) {
+	case *ec2.DescribeInstancesOutput:
+		for _, r := range out.Reservations {
+			for _, i := range r.Instances {
+				if i.State == nil || i.State.Name != ec2.InstanceStateNameRunning {
+					continue
+				}
+				os := "Linux"
+				if strings.EqualFold(string(i.Platform), string(ec2.PlatformValuesWindows)) {
+					os = "Windows"
+				}
+				tenancy := "Shared"
+				if i.Placement != nil {
+					switch i.Placement.Tenancy {
+					case ec2.TenancyDedicated:
+						tenancy = "Dedicated"
+					case ec2.TenancyHost:
+						tenancy = "Host"
+					}
+				}
+				res := est.m.New("ec2", "instance/", aws.StringValue(i.InstanceId))
+				est.item(res, string(i.InstanceType), HoursPerMonth, &query{
+					offer:  "AmazonEC2",
+					family: "Compute Instance",
+					unit:   "Hrs",
+					attrs: map[string]string{
+						"instanceType":    string(i.InstanceType),
+						"operatingSystem": os,
+						"tenancy":         tenancy,
+						"preInstalledSw":  "NA",
+						"capacitystatus":  "Used",
+						"licenseModel":    "No License required",
+					},
+				})
+			}
+		}
+	case *ec2.DescribeVolumesOutput:
+		for _, v := range out.Volumes {
+			res := est.m.New("ec2", "volume/", aws.StringValue(v.VolumeId))
+			typ := string(v.VolumeType)
+			est.item(res, typ, float64(aws.Int64Value(v.Size)), &query{
+				offer:  "AmazonEC2",
+				family: "Storage",
+				unit:   "GB-Mo",
+				attrs:  map[string]string{"volumeApiName": typ},
+			})
+			if v.VolumeType == ec2.VolumeTypeIo1 {
+				est.item(res, typ+" iops", float64(aws.Int64Value(v.Iops)), &query{
+					offer:  "AmazonEC2",
+					family: "System Operation",
+					unit:   "IOPS-Mo",
+					attrs:  map[string]string{"volumeApiName": typ, "group": "EBS IOPS"},
+				})
+			}
+		}
+	case *ec2.DescribeNatGatewaysOutput:
+		for _, n := range out.NatGateways {
+			if n.State != ec2.NatGatewayStateAvailable && n.State != ec2.NatGatewayStatePending {
+				continue
+			}
+			res := est.m.New("ec2", "natgateway/", aws.StringValue(n.NatGatewayId))
+			est.item(res, "nat-gateway", HoursPerMonth, &query{
+				offer:  "AmazonEC2",
+				family: "NAT Gateway",
+				unit:   "Hrs",
+			})
+		}
+	case *elb.DescribeLoadBalancersOutput:
+		for _, lb := range out.LoadBalancerDescriptions {
+			name := aws.StringValue(lb.LoadBalancerName)
+			res := est.m.New("elasticloadbalancing", "loadbalancer/", name)
+			est.item(res, "classic", HoursPerMonth, &query{
+				offer:  "AWSELB",
+				family: "Load Balancer",
+				unit:   "Hrs",
+			})
+		}
+	case *elbv2.DescribeLoadBalancersOutput:
+		for _, lb := range out.LoadBalancers {
+			family := "Load Balancer-Application"
+			if lb.Type == elbv2.LoadBalancerTypeEnumNetwork {
+				family = "Load Balancer-Network"
+			}
+			est.item(arn.Value(lb.LoadBalancerArn), string(lb.Type), HoursPerMonth, &query{
+				offer:  "AWSELB",
+				family: family,
+				unit:   "Hrs",
+			})
+		}
+	case *rds.DescribeDBInstancesOutput:
+		for _, db := range out.DBInstances {
+			res := arn.Value(db.DBInstanceArn)
+			engine := aws.StringValue(db.Engine)
+			deploy := "Single-AZ"
+			if aws.BoolValue(db.MultiAZ) {
+				deploy = "Multi-AZ"
+			}
+			if aws.StringValue(db.DBInstanceStatus) != "stopped" {
+				class := aws.StringValue(db.DBInstanceClass)
+				est.item(res, class, HoursPerMonth, &query{
+					offer:  "AmazonRDS",
+					family: "Database Instance",
+					unit:   "Hrs",
+					attrs: map[string]string{
+						"instanceType":     class,
+						"databaseEngine":   rdsEngine(engine),
+						"deploymentOption": deploy,
+					},
+				})
+			}
+			if strings.HasPrefix(engine, "aurora") {
+				continue // Aurora storage is billed per cluster
+			}
+			typ := aws.StringValue(db.StorageType)
+			est.item(res, typ, float64(aws.Int64Value(db.AllocatedStorage)), &query{
+				offer:  "AmazonRDS",
+				family: "Database Storage",
+				unit:   "GB-Mo",
+				attrs: map[string]string{
+					"volumeType":       rdsVolumeType(typ),
+					"deploymentOption": deploy,
+				},
+			})
+		}
+	case *dynamodb.DescribeTableOutput:
+		t := out.Table
+		if t == nil || t.ProvisionedThroughput == nil || (t.BillingModeSummary != nil &&
+			t.BillingModeSummary.BillingMode == dynamodb.BillingModePayPerRequest) {
+			return
+		}
+		rcu, wcu := capacity(t.ProvisionedThroughput)
+		for _, gsi := range t.GlobalSecondaryIndexes {
+			r, w := capacity(gsi.ProvisionedThroughput)
+			rcu, wcu = rcu+r, wcu+w
+		}
+		res := arn.Value(t.TableArn)
+		est.item(res, "read-capacity", rcu*HoursPerMonth, &query{
+			offer:  "AmazonDynamoDB",
+			family: "Provisioned IOPS",
+			unit:   "ReadCapacityUnit-Hrs",
+			attrs:  map[string]string{"group": "DDB-ReadUnits"},
+		})
+		est.item(res, "write-capacity", wcu*HoursPerMonth, &query{
+			offer:  "AmazonDynamoDB",
+			family: "Provisioned IOPS",
+			unit:   "WriteCapacityUnit-Hrs",
+			attrs:  map[string]string{"group": "DDB-WriteUnits"},
+		})
+	}
+}
+
+// item adds the cost of using quantity units of the product matching q.
+// Duplicate items, which may be returned by multiple calls, are ignored.
+func (est *estimator) item(res arn.ARN, usage string, quantity float64, q *query) {
+	key := string(res) + "\x00" + usage
+	if res == "" || quantity <= 0 || est.seen[key] {
+		return
+	}
+	est.seen[key] = true
+	q.region = est.m.Region
+	it := &Item{Resource: res, Usage: usage, Quantity: quantity, Unit: q.unit}
+	if pr := est.p.find(q); pr != nil {
+		it.Monthly = round(pr.cost(q.unit, quantity))
+	} else {
+		it.Unpriced = true
+	}
+	est.g.Items = append(est.g.Items, it)
+}
+
+// capacity returns provisioned read and write capacity units.
+func capacity(pt *dynamodb.ProvisionedThroughputDescription) (rcu, wcu float64) {
+	if pt != nil {
+		rcu = float64(aws.Int64Value(pt.ReadCapacityUnits))
+		wcu = float64(aws.Int64Value(pt.WriteCapacityUnits))
+	}
+	return
+}
+
+// rdsEngines maps RDS engine names to price list databaseEngine values.
+var rdsEngines = map[string]string{
+	"aurora":            "Aurora MySQL",
+	"aurora-mysql":      "Aurora MySQL",
+	"aurora-postgresql": "Aurora PostgreSQL",
+	"mariadb":           "MariaDB",
+	"mysql":             "MySQL",
+	"postgres":          "PostgreSQL",
+}
+
+// rdsEngine returns the price list databaseEngine value for RDS engine name.
+func rdsEngine(name string) string {
+	if e, ok := rdsEngines[name]; ok {
+		return e
+	}
+	switch {
+	case strings.HasPrefix(name, "oracle"):
+		return "Oracle"
+	case strings.HasPrefix(name, "sqlserver"):
+		return "SQL Server"
+	}
+	return name
+}
+
+// rdsVolumeType returns the price list volumeType value for RDS storage type.
+func rdsVolumeType(typ string) string {
+	switch typ {
+	case "gp2":
+		return "General Purpose"
+	case "io1":
+		return "Provisioned IOPS"
+	case "standard":
+		return "Magnetic"
+	}
+	return typ
+}
+
+// round rounds v to whole cents.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
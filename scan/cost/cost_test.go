@@ -0,0 +1,150 @@
+package cost
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPrices = `[{
+	"offerCode": "AmazonEC2",
+	"products": {
+		"LINUX": {"productFamily": "Compute Instance", "attributes": {
+			"regionCode": "us-east-1", "instanceType": "m5.large",
+			"operatingSystem": "Linux", "tenancy": "Shared", "preInstalledSw": "NA"}},
+		"WINDOWS": {"productFamily": "Compute Instance", "attributes": {
+			"regionCode": "us-east-1", "instanceType": "m5.large",
+			"operatingSystem": "Windows", "tenancy": "Shared", "preInstalledSw": "NA"}},
+		"GP2": {"productFamily": "Storage", "attributes": {
+			"regionCode": "us-east-1", "volumeApiName": "gp2"}},
+		"GP2W": {"productFamily": "Storage", "attributes": {
+			"regionCode": "us-west-2", "volumeApiName": "gp2"}}
+	},
+	"terms": {"OnDemand": {
+		"LINUX": {"LINUX.T": {"priceDimensions": {"LINUX.T.D": {
+			"unit": "Hrs", "pricePerUnit": {"USD": "0.0960000000"}}}}},
+		"WINDOWS": {"WINDOWS.T": {"priceDimensions": {"WINDOWS.T.D": {
+			"unit": "Hrs", "pricePerUnit": {"USD": "0.1880000000"}}}}},
+		"GP2": {"GP2.T": {"priceDimensions": {"GP2.T.D": {
+			"unit": "GB-Mo", "pricePerUnit": {"USD": "0.10"}}}}},
+		"GP2W": {"GP2W.T": {"priceDimensions": {"GP2W.T.D": {
+			"unit": "GB-Mo", "pricePerUnit": {"USD": "0.20"}}}}}
+	}}
+}, {
+	"offerCode": "AmazonDynamoDB",
+	"products": {
+		"RCU": {"productFamily": "Provisioned IOPS", "attributes": {
+			"regionCode": "us-east-1", "group": "DDB-ReadUnits"}}
+	},
+	"terms": {"OnDemand": {
+		"RCU": {"RCU.T": {"priceDimensions": {
+			"RCU.T.FREE": {"unit": "ReadCapacityUnit-Hrs", "beginRange": "0",
+				"endRange": "18600", "pricePerUnit": {"USD": "0"}},
+			"RCU.T.PAID": {"unit": "ReadCapacityUnit-Hrs", "beginRange": "18600",
+				"endRange": "Inf", "pricePerUnit": {"USD": "0.00013"}}
+		}}}
+	}}
+}]`
+
+func TestEstimate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cost")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "prices.json")
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"products": {}}`), 0644))
+	_, err = LoadPrices(file)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(testPrices), 0644))
+	p, err := LoadPrices(file)
+	require.NoError(t, err)
+
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	out := func(v ...interface{}) []interface{} { return v }
+	running := &ec2.InstanceState{Name: ec2.InstanceStateNameRunning}
+	maps := []*scan.Map{{Ctx: ac, Service: "ec2", Calls: map[string][]*scan.Call{
+		"DescribeInstances": {{ID: "i", Out: out(&ec2.DescribeInstancesOutput{
+			Reservations: []ec2.RunInstancesOutput{{Instances: []ec2.Instance{{
+				InstanceId:   aws.String("i-1"),
+				InstanceType: ec2.InstanceTypeM5Large,
+				State:        running,
+			}, {
+				InstanceId:   aws.String("i-2"),
+				InstanceType: ec2.InstanceTypeM5Large,
+				Platform:     "windows",
+				State:        running,
+			}, {
+				InstanceId:   aws.String("i-3"),
+				InstanceType: ec2.InstanceTypeM5Large,
+				State:        &ec2.InstanceState{Name: ec2.InstanceStateNameStopped},
+			}, {
+				InstanceId:   aws.String("i-4"),
+				InstanceType: ec2.InstanceTypeC5Large,
+				State:        running,
+			}}}},
+		})}},
+		"DescribeVolumes": {{ID: "v", Out: out(&ec2.DescribeVolumesOutput{
+			Volumes: []ec2.CreateVolumeOutput{{
+				VolumeId:   aws.String("vol-1"),
+				VolumeType: ec2.VolumeTypeGp2,
+				Size:       aws.Int64(100),
+			}},
+		})}},
+	}}, {Ctx: ac, Service: "dynamodb", Calls: map[string][]*scan.Call{
+		"DescribeTable": {{ID: "t", Out: out(&dynamodb.DescribeTableOutput{
+			Table: &dynamodb.TableDescription{
+				TableArn: aws.String("arn:aws:dynamodb:us-east-1:123456789012:table/t"),
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{
+					ReadCapacityUnits:  aws.Int64(20),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+				GlobalSecondaryIndexes: []dynamodb.GlobalSecondaryIndexDescription{{
+					ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{
+						ReadCapacityUnits:  aws.Int64(10),
+						WriteCapacityUnits: aws.Int64(5),
+					},
+				}},
+			},
+		})}},
+	}}}
+
+	e := p.Estimate(maps)
+	const prefix = "arn:aws:ec2:us-east-1:123456789012:"
+	const table = "arn:aws:dynamodb:us-east-1:123456789012:table/t"
+	assert.Equal(t, &Estimate{
+		Currency: "USD",
+		Monthly:  70.08 + 137.24 + 10 + 0.43,
+		Unpriced: 2,
+		Groups: []*Group{{
+			Account: "123456789012",
+			Region:  "us-east-1",
+			Service: "ec2",
+			Monthly: 70.08 + 137.24 + 10,
+			Items: []*Item{
+				{prefix + "instance/i-1", "m5.large", 730, "Hrs", 70.08, false},
+				{prefix + "instance/i-2", "m5.large", 730, "Hrs", 137.24, false},
+				{prefix + "instance/i-4", "c5.large", 730, "Hrs", 0, true},
+				{prefix + "volume/vol-1", "gp2", 100, "GB-Mo", 10, false},
+			},
+		}, {
+			Account: "123456789012",
+			Region:  "us-east-1",
+			Service: "dynamodb",
+			Monthly: 0.43,
+			Items: []*Item{
+				{table, "read-capacity", 30 * 730, "ReadCapacityUnit-Hrs", 0.43, false},
+				{table, "write-capacity", 10 * 730, "WriteCapacityUnit-Hrs", 0, true},
+			},
+		}},
+	}, e)
+}
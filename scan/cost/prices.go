@@ -0,0 +1,183 @@
+package cost
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Currency is the currency of all prices and estimates.
+const Currency = "USD"
+
+// Prices contains on-demand prices loaded from AWS Price List offer files.
+type Prices struct {
+	products []*product
+}
+
+// product is one SKU with its on-demand price dimensions.
+type product struct {
+	sku    string
+	offer  string
+	family string
+	attrs  map[string]string
+	dims   []*dimension
+}
+
+// dimension is one price tier of a product.
+type dimension struct {
+	unit       string
+	begin, end float64
+	price      float64
+}
+
+// offerFile is the subset of the AWS Price List offer file format used for
+// estimates. Only on-demand terms are considered.
+type offerFile struct {
+	OfferCode string `json:"offerCode"`
+	Products  map[string]struct {
+		SKU           string            `json:"sku"`
+		ProductFamily string            `json:"productFamily"`
+		Attributes    map[string]string `json:"attributes"`
+	} `json:"products"`
+	Terms struct {
+		OnDemand map[string]map[string]struct {
+			PriceDimensions map[string]struct {
+				Unit         string            `json:"unit"`
+				BeginRange   string            `json:"beginRange"`
+				EndRange     string            `json:"endRange"`
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// LoadPrices reads AWS Price List offer files. Each file may contain one offer
+// or a JSON array of offers. Products must have a "regionCode" attribute to be
+// matched with scanned resources.
+func LoadPrices(files ...string) (*Prices, error) {
+	p := new(Prices)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var offers []*offerFile
+		if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+			err = json.Unmarshal(b, &offers)
+		} else {
+			offers = []*offerFile{new(offerFile)}
+			err = json.Unmarshal(b, offers[0])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid price list file %q", file)
+		}
+		for _, o := range offers {
+			if err = p.add(o); err != nil {
+				return nil, errors.Wrapf(err, "invalid price list file %q", file)
+			}
+		}
+	}
+	sort.Slice(p.products, func(i, j int) bool {
+		return p.products[i].sku < p.products[j].sku
+	})
+	return p, nil
+}
+
+// add adds all products in offer o to p.
+func (p *Prices) add(o *offerFile) error {
+	if o.OfferCode == "" {
+		return errors.New("missing offer code")
+	}
+	for sku, prod := range o.Products {
+		pr := &product{
+			sku:    sku,
+			offer:  o.OfferCode,
+			family: prod.ProductFamily,
+			attrs:  prod.Attributes,
+		}
+		for _, term := range o.Terms.OnDemand[sku] {
+			for _, d := range term.PriceDimensions {
+				usd, ok := d.PricePerUnit[Currency]
+				if !ok {
+					continue
+				}
+				dim := &dimension{unit: d.Unit, end: math.Inf(1)}
+				var err error
+				if dim.price, err = strconv.ParseFloat(usd, 64); err != nil {
+					return errors.Wrapf(err, "invalid price for SKU %q", sku)
+				}
+				if d.BeginRange != "" {
+					if dim.begin, err = strconv.ParseFloat(d.BeginRange, 64); err != nil {
+						return errors.Wrapf(err, "invalid begin range for SKU %q", sku)
+					}
+				}
+				if d.EndRange != "" && d.EndRange != "Inf" {
+					if dim.end, err = strconv.ParseFloat(d.EndRange, 64); err != nil {
+						return errors.Wrapf(err, "invalid end range for SKU %q", sku)
+					}
+				}
+				pr.dims = append(pr.dims, dim)
+			}
+		}
+		if len(pr.dims) > 0 {
+			p.products = append(p.products, pr)
+		}
+	}
+	return nil
+}
+
+// query identifies a product and the unit of its price.
+type query struct {
+	offer  string
+	family string
+	region string
+	unit   string
+	attrs  map[string]string
+}
+
+// find returns the first product matching q. Attributes in q that are not
+// defined by a product are ignored, which allows price lists to omit
+// attributes that do not distinguish between products.
+func (p *Prices) find(q *query) *product {
+next:
+	for _, pr := range p.products {
+		if pr.offer != q.offer || pr.family != q.family ||
+			pr.attrs["regionCode"] != q.region || !pr.hasUnit(q.unit) {
+			continue
+		}
+		for k, v := range q.attrs {
+			if have, ok := pr.attrs[k]; ok && have != v {
+				continue next
+			}
+		}
+		return pr
+	}
+	return nil
+}
+
+// hasUnit returns true if pr has a price dimension for the specified unit.
+func (pr *product) hasUnit(unit string) bool {
+	for _, d := range pr.dims {
+		if d.unit == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// cost returns the cost of using quantity units of pr, applying tiered prices.
+func (pr *product) cost(unit string, quantity float64) float64 {
+	var total float64
+	for _, d := range pr.dims {
+		if d.unit != unit || quantity <= d.begin {
+			continue
+		}
+		total += (math.Min(quantity, d.end) - d.begin) * d.price
+	}
+	return total
+}
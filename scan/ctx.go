@@ -3,12 +3,17 @@ package scan
 import (
 	"bytes"
 	"container/heap"
+	"context"
 	"crypto/sha512"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"path"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/defaults"
@@ -21,12 +26,26 @@ import (
 type Ctx struct {
 	Map // Scan results
 
-	mode   Mode             // Scan mode
-	ars    string           // ID hash "<account>/<region>/<service>" prefix
-	svc    *svc             // Service metadata
-	iface  svcIface         // Service instance
-	client reflect.Value    // SDK client instance
-	run    map[*link]*batch // Run queue
+	mode    Mode             // Scan mode
+	ars     string           // ID hash "<account>/<region>/<service>" prefix
+	svc     *svc             // Service metadata
+	iface   svcIface         // Service instance
+	client  reflect.Value    // SDK client instance
+	run     map[*link]*batch // Run queue
+	prev    map[string]*Call // Previous scan calls by ID
+	sc      context.Context  // Scan context
+	ctmo    time.Duration    // Call timeout
+	maxc    int              // Default call limit per link
+	limits  map[string]int   // Call limits by "<service>.<api>" pattern
+	maxi    int              // Default item limit per source output
+	ilimits map[string]int   // Item limits by "<service>.<api>" pattern
+	sample  bool             // Sample limited calls
+	dupKeys map[string]bool  // Resource keys shared by multiple resources
+
+	metrics *Metrics // Metrics registry
+	logger  Logger   // Structured logger
+	tracer  *Tracer  // Span tracer
+	span    *Span    // Context trace span
 
 	totalCalls int // Total number of calls made
 	readyCalls int // Number of calls ready for execution
@@ -42,11 +61,21 @@ func newCtx(cfg *aws.Config, ac arn.Ctx, svc *svc, opts Opts) *Ctx {
 			Service: svc.name,
 			Calls:   make(map[string][]*Call, len(svc.api)),
 		},
-		mode:   opts.Mode,
-		ars:    strings.Join([]string{ac.Account, ac.Region, svc.name}, "/"),
-		svc:    svc,
-		client: svc.newClient.Call([]reflect.Value{reflect.ValueOf(cpy)})[0],
-		run:    make(map[*link]*batch, len(svc.links)),
+		mode:    opts.Mode,
+		ars:     strings.Join([]string{ac.Account, ac.Region, svc.name}, "/"),
+		svc:     svc,
+		client:  svc.newClient.Call([]reflect.Value{reflect.ValueOf(cpy)})[0],
+		run:     make(map[*link]*batch, len(svc.links)),
+		ctmo:    opts.CallTimeout,
+		maxc:    opts.MaxCalls,
+		limits:  opts.Limits,
+		maxi:    opts.MaxItems,
+		ilimits: opts.ItemLimits,
+		sample:  opts.Sample,
+
+		metrics: opts.Metrics,
+		logger:  opts.Logger,
+		tracer:  opts.Tracer,
 	}
 	iface := reflect.New(svc.typ).Elem()
 	iface.FieldByName("Ctx").Set(reflect.ValueOf(ctx))
@@ -223,6 +252,10 @@ func (ctx *Ctx) tryRun(lnk *link) {
 	}
 	for _, dep := range lnk.deps {
 		if ctx.Calls[dep] == nil {
+			ctx.log(LogDebug, "link waiting", func(f Fields) {
+				f["api"] = lnk.api
+				f["dep"] = dep
+			})
 			return // Waiting for dependency
 		}
 	}
@@ -230,17 +263,35 @@ func (ctx *Ctx) tryRun(lnk *link) {
 	// Allocate new batch instance
 	b := &batch{ctx: ctx, lnk: lnk}
 	ctx.run[lnk] = b
+	skip := "no inputs"
 	defer func(b *batch) {
 		if len(b.all) > 0 {
+			ctx.limit(b)
+			ctx.log(LogDebug, "link scheduled", func(f Fields) {
+				f["api"] = lnk.api
+				f["deps"] = lnk.deps
+				f["calls"] = len(b.all)
+			})
 			b.next = append(b.next, b.all...)
 			b.ctx.readyCalls += len(b.all)
 		} else {
+			ctx.log(LogDebug, "link skipped", func(f Fields) {
+				f["api"] = lnk.api
+				f["deps"] = lnk.deps
+				f["reason"] = skip
+			})
 			b.ctx.finish(b)
 		}
 	}(b)
 	if ctx.Mode(TFState) && !lnk.postProc {
+		skip = "not needed for post-processing"
 		return // Link not needed for output post-processing
 	}
+	if m := ctx.mode & svcRegistry.limits; lnk.modes&m != m ||
+		ctx.mode&lnk.only != lnk.only {
+		skip = "not needed in current mode"
+		return // Link not needed in the current mode
+	}
 
 	// Extract all dependencies from ctx.out
 	type src struct {
@@ -259,6 +310,7 @@ func (ctx *Ctx) tryRun(lnk *link) {
 			}
 		}
 		if len(srcs) == 0 {
+			skip = "no outputs from " + dep
 			return
 		}
 		outs[i+1] = srcs
@@ -272,13 +324,19 @@ func (ctx *Ctx) tryRun(lnk *link) {
 			args[i] = outs[i][j].out
 		}
 		inputs := lnk.input.Call(args)[0]
+		if len(lnk.deps) > 0 {
+			inputs = ctx.limitItems(lnk.api, inputs)
+		}
 		if n := inputs.Len(); n > 0 {
 			var src map[string]int
+			reuse := false
 			if len(idx) > 1 {
 				src = make(map[string]int, len(idx)-1)
+				reuse = ctx.prev != nil
 				for i, j := range idx[1:] {
 					s := &outs[i+1][j]
 					src[s.call.ID] = s.idx
+					reuse = reuse && s.idx < len(s.call.same) && s.call.same[s.idx]
 				}
 			}
 			calls := make([]Call, n)
@@ -292,6 +350,7 @@ func (ctx *Ctx) tryRun(lnk *link) {
 					c.Stats = &stats[i]
 				}
 				c.Src = src
+				c.reuse = reuse
 				c.In = inputs.Index(i).Addr().Interface()
 				c.bat = b
 				b.all = append(b.all, c)
@@ -311,6 +370,117 @@ func (ctx *Ctx) tryRun(lnk *link) {
 	}
 }
 
+// limit removes calls from batch b that exceed the call limit for its API.
+// Root links are never limited.
+func (ctx *Ctx) limit(b *batch) {
+	api := b.lnk.api
+	n := apiLimit(ctx.Service+"."+api, ctx.maxc, ctx.limits)
+	if n <= 0 || len(b.all) <= n || len(b.lnk.deps) == 0 {
+		return
+	}
+	skip := len(b.all) - n
+	keep := ctx.keep(api, n, len(b.all), func(i int) interface{} {
+		return b.all[i].In
+	})
+	all := make([]*Call, n)
+	for i, j := range keep {
+		all[i] = b.all[j]
+	}
+	b.all = all
+	ctx.truncate(api, "link truncated", n, skip)
+}
+
+// limitItems removes inputs that one combination of source outputs provided to
+// a dependent API in excess of its item limit.
+func (ctx *Ctx) limitItems(api string, inputs reflect.Value) reflect.Value {
+	n := apiLimit(ctx.Service+"."+api, ctx.maxi, ctx.ilimits)
+	if n <= 0 || inputs.Len() <= n {
+		return inputs
+	}
+	skip := inputs.Len() - n
+	keep := ctx.keep(api, n, inputs.Len(), func(i int) interface{} {
+		return inputs.Index(i).Addr().Interface()
+	})
+	v := reflect.MakeSlice(inputs.Type(), n, n)
+	for i, j := range keep {
+		v.Index(i).Set(inputs.Index(j))
+	}
+	ctx.truncate(api, "items truncated", n, skip)
+	return v
+}
+
+// keep returns the sorted indices of n out of total inputs for the specified
+// API. By default, the first inputs are kept. When sampling, the inputs with
+// the smallest hashes of their JSON encodings are kept, so the same resources
+// are selected by every scan regardless of their positions in source outputs.
+func (ctx *Ctx) keep(api string, n, total int, in func(i int) interface{}) []int {
+	idx := make([]int, total)
+	for i := range idx {
+		idx[i] = i
+	}
+	if !ctx.sample {
+		return idx[:n]
+	}
+	sum := make([]uint64, total)
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	h := fnv.New64a()
+	for i := range sum {
+		b.WriteString(ctx.ars)
+		b.WriteByte('.')
+		b.WriteString(api)
+		b.WriteByte('?')
+		enc.Encode(in(i))
+		h.Reset()
+		h.Write(b.Bytes())
+		b.Reset()
+		sum[i] = h.Sum64()
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		a, b := idx[i], idx[j]
+		return sum[a] < sum[b] || sum[a] == sum[b] && a < b
+	})
+	idx = idx[:n]
+	sort.Ints(idx)
+	return idx
+}
+
+// truncate records the number of calls to api that were skipped because of
+// limits.
+func (ctx *Ctx) truncate(api, msg string, n, skip int) {
+	if ctx.Truncated == nil {
+		ctx.Truncated = make(map[string]int)
+	}
+	ctx.Truncated[api] += skip
+	ctx.log(LogInfo, msg, func(f Fields) {
+		f["api"] = api
+		f["calls"] = n
+		f["skipped"] = skip
+	})
+}
+
+// apiLimit returns the limit for the specified "<service>.<api>" name. Exact
+// names in lim take precedence over patterns, which are matched in sorted
+// order. The default limit is returned if there is no match.
+func apiLimit(name string, def int, lim map[string]int) int {
+	if n, ok := lim[name]; ok {
+		return n
+	}
+	if len(lim) > 0 {
+		pats := make([]string, 0, len(lim))
+		for p := range lim {
+			pats = append(pats, p)
+		}
+		sort.Strings(pats)
+		for _, p := range pats {
+			if ok, _ := path.Match(p, name); ok {
+				return lim[p]
+			}
+		}
+	}
+	return def
+}
+
 // next returns the next call to execute.
 func (ctx *Ctx) next() *Call {
 	if ctx.readyCalls == 0 {
@@ -332,9 +502,31 @@ func (ctx *Ctx) next() *Call {
 // done updates context state after call completion and returns true when the
 // entire service has been scanned.
 func (ctx *Ctx) done(c *Call) bool {
-	if c.Err != nil && c.Err.Code != "" && len(c.Out) == 0 {
-		ctx.iface.HandleError(c.req, c.Err)
+	if c.Err != nil {
+		ctx.log(LogDebug, "call error", func(f Fields) {
+			c.logFields(f)
+			logErr(f, c.Err)
+		})
+		if c.Err.Code != "" && c.Err.Code != ErrCodeTimeout && len(c.Out) == 0 &&
+			c.req != nil {
+			ctx.iface.HandleError(c.req, c.Err)
+		}
+		if c.Err.Ignore {
+			ctx.log(LogDebug, "error ignored", func(f Fields) {
+				c.logFields(f)
+				f["code"] = c.Err.Code
+			})
+		} else {
+			ctx.log(LogWarn, "call failed", func(f Fields) {
+				c.logFields(f)
+				logErr(f, c.Err)
+			})
+		}
 	}
+	ctx.log(LogDebug, "call finish", func(f Fields) {
+		c.logFields(f)
+		f["pages"] = len(c.Out)
+	})
 	ctx.postProcess(c)
 	b := c.bat
 	c.bat = nil
@@ -360,6 +552,10 @@ func (ctx *Ctx) postProcess(c *Call) {
 		if err := fn.Call(args)[0]; !err.IsNil() {
 			// TODO: Pass up to scanner and terminate scan?
 			err := err.Interface().(error)
+			ctx.log(LogError, "post-processing failed", func(f Fields) {
+				c.logFields(f)
+				f["error"] = err.Error()
+			})
 			panic("scan: service tfstate error: " + err.Error())
 		}
 	}
@@ -384,7 +580,9 @@ func (ctx *Ctx) finish(b *batch) {
 	ctx.tryNext(api)
 }
 
-// addResources adds new resources to ctx.Resources.
+// addResources adds new resources to ctx.Resources. Resources with the same
+// key are disambiguated by a hash of their state, and identical duplicates are
+// dropped.
 func (ctx *Ctx) addResources(rs []tfx.Resource, err error) error {
 	if len(rs) == 0 || err != nil {
 		return err
@@ -395,16 +593,31 @@ func (ctx *Ctx) addResources(rs []tfx.Resource, err error) error {
 	for _, r := range rs {
 		id := r.Key[strings.IndexByte(r.Key, '.')+1:]
 		r.Key = r.Type + "." + ctx.Region + "_" + id
-		k, i := r.Key, 0
-		for ctx.Resources[k] != nil {
-			i++
-			k = r.Key + "_" + strconv.Itoa(i)
+		k := r.Key
+		if old := ctx.Resources[k]; old != nil || ctx.dupKeys[k] {
+			// All resources sharing a key are renamed using a hash of their
+			// state, so keys do not depend on the order of post-processing.
+			if old != nil {
+				delete(ctx.Resources, k)
+				ctx.Resources[k+"_"+stateHash(old)] = old
+				if ctx.dupKeys == nil {
+					ctx.dupKeys = make(map[string]bool)
+				}
+				ctx.dupKeys[k] = true
+			}
+			if k += "_" + stateHash(r.ResourceState); ctx.Resources[k] != nil {
+				continue // Identical duplicate
+			}
 		}
 		if !strings.HasSuffix(ctx.Region, "-global") &&
 			!strings.Contains(ctx.Region, "fips") {
 			r.Provider += "." + ctx.Region
 		}
 		ctx.Resources[k] = r.ResourceState
+		ctx.log(LogDebug, "resource added", func(f Fields) {
+			f["type"] = r.Type
+			f["key"] = k
+		})
 	}
 	return nil
 }
@@ -429,10 +642,14 @@ type scanner struct {
 	ech   chan<- *Call // Execution channel
 	rch   <-chan *Call // Return channel
 	calls int          // Call counter
+	tmo   int          // Calls aborted by a timeout
+	prog  progress     // Progress report state
+	mt    *Metrics     // Metrics registry
+	root  *Span        // Scan trace span
 }
 
 // newScanner starts worker goroutines in preparation for scanning contexts.
-func newScanner(all []*Ctx, workers int) scanner {
+func newScanner(all []*Ctx, op Opts) scanner {
 	run := make([]*Ctx, 0, len(all))
 	idx := make(map[*Ctx]int, len(all))
 	for _, ctx := range all {
@@ -444,6 +661,7 @@ func newScanner(all []*Ctx, workers int) scanner {
 	if len(run) == 0 {
 		return scanner{}
 	}
+	workers := op.Workers
 	if workers < 1 {
 		workers = 64
 	}
@@ -458,17 +676,32 @@ func newScanner(all []*Ctx, workers int) scanner {
 			j.SetEscapeHTML(false)
 			h := sha512.New512_256()
 			for c := range ech {
+				c.bat.ctx.metrics.queued(c)
 				if c.ID == "" {
 					c.ID = c.id(&b, j, h)
 					b.Reset()
 					h.Reset()
 				}
-				c.exec()
+				if c.reusePrev() {
+					c.bat.ctx.log(LogDebug, "call reused", c.logFields)
+				} else {
+					c.bat.ctx.log(LogDebug, "call start", c.logFields)
+					c.bat.ctx.tracer.startCall(c)
+					c.exec()
+					c.comparePrev()
+				}
 				rch <- c
 			}
 		}(ech, rch)
 	}
-	return scanner{run, idx, ech, rch, 0}
+	return scanner{
+		heap: run,
+		idx:  idx,
+		ech:  ech,
+		rch:  rch,
+		prog: progress{Progress: op.Progress},
+		mt:   op.Metrics,
+	}
 }
 
 // scan scans all active contexts until the heap is empty.
@@ -477,31 +710,64 @@ func (s *scanner) scan() {
 		return
 	}
 	defer close(s.ech)
+	s.mt.begin()
+	defer s.mt.end()
+	var tick <-chan time.Time
+	var detail <-chan struct{}
+	if s.prog.Progress != nil {
+		d := s.prog.Interval
+		if d <= 0 {
+			d = time.Second
+		}
+		t := time.NewTicker(d)
+		defer t.Stop()
+		tick, detail = t.C, s.prog.Detail
+		s.prog.start = time.Now()
+		defer s.report(false, true)
+	}
 	heap.Init(s)
 	next := s.next()
 	for {
-		if next != nil {
-			select {
-			case s.ech <- next:
-				next.Stats.exec()
-			case c := <-s.rch:
-				if s.done(c) {
-					return
-				}
-				continue
+		// Sending is disabled by a nil channel when there is nothing to send
+		ech := s.ech
+		if next == nil {
+			ech = nil
+		}
+		select {
+		case ech <- next:
+			next.Stats.exec()
+			s.prog.running++
+			next = s.next()
+		case c := <-s.rch:
+			if s.done(c) {
+				return
 			}
-		} else if s.done(<-s.rch) {
-			return
+			if next == nil {
+				next = s.next()
+			}
+		case <-tick:
+			s.report(false, false)
+		case <-detail:
+			s.report(true, false)
 		}
-		next = s.next()
 	}
 }
 
 // next returns the next call to execute.
 func (s *scanner) next() *Call {
-	c := s.heap[0].next()
+	ctx := s.heap[0]
+	c := ctx.next()
+	if c != nil && ctx.span == nil && ctx.tracer != nil {
+		ctx.span = ctx.tracer.start(s.root, "context")
+		ctx.span.set("aws.account", ctx.Account)
+		ctx.span.set("aws.region", ctx.Region)
+		ctx.span.set("aws.service", ctx.Service)
+	}
 	if c != nil {
 		c.Stats.ready(s.calls)
+		if s.mt != nil {
+			c.ready = time.Now()
+		}
 		s.calls++
 		heap.Fix(s, 0)
 	}
@@ -511,13 +777,31 @@ func (s *scanner) next() *Call {
 // done updates scan state after call completion and returns true when the scan
 // is done.
 func (s *scanner) done(c *Call) bool {
-	updateTypes(c.req)
-	if ctx := c.bat.ctx; ctx.done(c) {
+	if c.req != nil {
+		updateTypes(c.req)
+	}
+	ctx, api := c.bat.ctx, c.bat.lnk.api
+	finished := ctx.done(c)
+	ctx.tracer.endCall(c)
+	if finished {
 		heap.Remove(s, s.idx[ctx])
+		ctx.span.set("context.calls", ctx.totalCalls)
+		ctx.tracer.end(ctx.span)
 	} else {
 		heap.Fix(s, s.idx[ctx])
 	}
+	s.mt.done(ctx, api, c.Err)
 	c.Stats.done(c.Err)
+	p := &s.prog
+	p.running--
+	p.done++
+	p.throttles += c.throttles
+	if c.Err != nil && !c.Err.Ignore {
+		p.errors++
+	}
+	if c.Err != nil && c.Err.Code == ErrCodeTimeout {
+		s.tmo++
+	}
 	return len(s.heap) == 0
 }
 
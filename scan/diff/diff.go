@@ -0,0 +1,285 @@
+// Package diff compares scan results and reports changes between them.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mxk/awsscan/scan"
+)
+
+// Kind is the type of change reported by an Event.
+type Kind string
+
+// Change kinds.
+const (
+	Created  Kind = "created"  // Call or resource is new
+	Modified Kind = "modified" // Call or resource outputs or error changed
+	Deleted  Kind = "deleted"  // Call or resource is no longer present
+)
+
+// Event is one change between two scans. Calls are matched by their stable
+// IDs. Root call outputs are further split into resources, which are matched
+// by their IDs and reported separately with Resource set. Any remaining root
+// call outputs are reported as a call event without Resource.
+type Event struct {
+	Time     time.Time   `json:"time"`
+	Kind     Kind        `json:"kind"`
+	Account  string      `json:"account"`
+	Region   string      `json:"region"`
+	Service  string      `json:"service"`
+	API      string      `json:"api"`
+	ID       string      `json:"id"`
+	Resource string      `json:"resource,omitempty"`
+	In       interface{} `json:"in,omitempty"`
+	Before   *State      `json:"before,omitempty"`
+	After    *State      `json:"after,omitempty"`
+}
+
+// State is the result of one call or the state of one resource.
+type State struct {
+	Out []interface{} `json:"out,omitempty"`
+	Err *scan.Err     `json:"err,omitempty"`
+}
+
+// Diff returns events that transform prev into cur, sorted by account, region,
+// service, API, call ID, and resource. Event times are set to t. Both sets of
+// maps should be compacted so that only meaningful values are compared. Errors
+// are compared by status and code only, since messages may contain request
+// IDs.
+func Diff(prev, cur []*scan.Map, t time.Time) []*Event {
+	old := index(prev)
+	var ev []*Event
+	for k, c := range index(cur) {
+		if p := old[k]; p == nil {
+			ev = append(ev, k.event(t, Created, c, nil, c))
+		} else {
+			if !equal(p, c) {
+				ev = append(ev, k.event(t, Modified, c, p, c))
+			}
+			delete(old, k)
+		}
+	}
+	for k, p := range old {
+		ev = append(ev, k.event(t, Deleted, p, p, nil))
+	}
+	sort.Slice(ev, func(i, j int) bool {
+		a, b := ev[i], ev[j]
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.API != b.API {
+			return a.API < b.API
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Resource < b.Resource
+	})
+	return ev
+}
+
+// key uniquely identifies a call or a resource in root call outputs across
+// scans.
+type key struct{ account, region, service, api, id, res string }
+
+// entry is the state of one call or resource.
+type entry struct {
+	in  interface{}
+	out []interface{}
+	err *scan.Err
+}
+
+// index returns all calls and root call resources in maps indexed by key.
+func index(maps []*scan.Map) map[key]*entry {
+	idx := make(map[key]*entry)
+	scan.Walk(maps, func(m *scan.Map, api string, c *scan.Call) error {
+		k := key{m.Account, m.Region, m.Service, api, c.ID, ""}
+		if len(c.Src) > 0 || c.Err != nil {
+			idx[k] = &entry{c.In, c.Out, c.Err}
+			return nil
+		}
+		res := make(map[string]interface{})
+		rest := make([]interface{}, len(c.Out))
+		for i, out := range c.Out {
+			rest[i] = split(normalize(out), "", res)
+		}
+		if len(res) == 0 {
+			idx[k] = &entry{c.In, c.Out, nil}
+			return nil
+		}
+		idx[k] = &entry{c.In, rest, nil}
+		for id, v := range res {
+			r := k
+			r.res = id
+			idx[r] = &entry{c.In, []interface{}{v}, nil}
+		}
+		return nil
+	})
+	return idx
+}
+
+// event creates a new event for key k. Entry e provides the inputs.
+func (k key) event(t time.Time, kind Kind, e, before, after *entry) *Event {
+	return &Event{
+		Time:     t,
+		Kind:     kind,
+		Account:  k.account,
+		Region:   k.region,
+		Service:  k.service,
+		API:      k.api,
+		ID:       k.id,
+		Resource: k.res,
+		In:       e.in,
+		Before:   state(before),
+		After:    state(after),
+	}
+}
+
+// state returns the state of entry e.
+func state(e *entry) *State {
+	if e == nil {
+		return nil
+	}
+	return &State{Out: e.out, Err: e.err}
+}
+
+// equal returns true if entries a and b have the same state.
+func equal(a, b *entry) bool {
+	if (a.err == nil) != (b.err == nil) || a.err != nil &&
+		(a.err.Status != b.err.Status || a.err.Code != b.err.Code) {
+		return false
+	}
+	x, err1 := json.Marshal(a.out)
+	y, err2 := json.Marshal(b.out)
+	return err1 == nil && err2 == nil && bytes.Equal(x, y)
+}
+
+// normalize converts v to its generic JSON representation.
+func normalize(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var g interface{}
+	if json.Unmarshal(b, &g) != nil {
+		return v
+	}
+	return g
+}
+
+// split moves resources from output v into res and returns what remains.
+// Resources are elements of object lists that have unique IDs (see resID).
+// They are keyed by their parent resource key (if any), list name, and ID
+// (e.g. "Reservations:r-1/Instances:i-1"). Nested resources are removed from
+// their parents, so a change to an instance is not also reported as a change
+// to its reservation.
+func split(v interface{}, parent string, res map[string]interface{}) interface{} {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	rest := make(map[string]interface{}, len(obj))
+	for name, v := range obj {
+		list, ok := v.([]interface{})
+		ids := listIDs(name, list)
+		if !ok || ids == nil {
+			rest[name] = v
+			continue
+		}
+		for i, elem := range list {
+			k := name + ":" + ids[i]
+			if parent != "" {
+				k = parent + "/" + k
+			}
+			res[k] = split(elem, k, res)
+		}
+	}
+	return rest
+}
+
+// listIDs returns the IDs of all elements in list, which is stored in a field
+// called name. It returns nil if list is empty or any element is not an object
+// with a unique ID.
+func listIDs(name string, list []interface{}) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]string, len(list))
+	seen := make(map[string]bool, len(list))
+	one := singular(name)
+	for i, v := range list {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		id := resID(one, obj)
+		if id == "" || seen[id] {
+			return nil
+		}
+		ids[i], seen[id] = id, true
+	}
+	return ids
+}
+
+// idSuffixes are field name suffixes that identify resources, in order of
+// preference.
+var idSuffixes = [...]string{"Arn", "ARN", "Id", "Name"}
+
+// resID returns the ID of resource obj, which is an element of a list of
+// resources of type typ (e.g. "Instance"). In order of preference, the ID is
+// the value of "<typ><suffix>", "<t><suffix>" where t is a suffix of typ (e.g.
+// "GroupId" for "SecurityGroup"), or "<suffix>". It returns "" if obj has no
+// such field with a non-empty string value.
+func resID(typ string, obj map[string]interface{}) string {
+	get := func(name string) string {
+		s, _ := obj[name].(string)
+		return s
+	}
+	for _, sfx := range idSuffixes {
+		if id := get(typ + sfx); id != "" {
+			return id
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, sfx := range idSuffixes {
+		for _, name := range names {
+			if t := strings.TrimSuffix(name, sfx); t != name && t != "" &&
+				strings.HasSuffix(typ, t) {
+				if id := get(name); id != "" {
+					return id
+				}
+			}
+		}
+	}
+	for _, sfx := range idSuffixes {
+		if id := get(sfx); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// singular returns the singular form of list name.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"):
+		return name[:len(name)-2]
+	}
+	return strings.TrimSuffix(name, "s")
+}
@@ -0,0 +1,250 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	call := func(id, name string) *scan.Call {
+		return &scan.Call{
+			ID:  id,
+			In:  scan.IO{"UserName": name},
+			Out: []interface{}{scan.IO{"User": scan.IO{"UserName": name}}},
+		}
+	}
+	bob, carol := call("b", "bob"), call("c", "carol")
+	bob2, dave := call("b", "bob"), call("d", "dave")
+	bob2.Out = []interface{}{scan.IO{"User": scan.IO{"UserName": "bob", "Path": "/x/"}}}
+	carolErr := call("c", "carol")
+	carolErr.Err = &scan.Err{Status: 400, Code: "Throttling", Message: "one"}
+	carolErr2 := call("c", "carol")
+	carolErr2.Err = &scan.Err{Status: 400, Code: "Throttling", Message: "two"}
+	newMap := func(calls ...*scan.Call) []*scan.Map {
+		return []*scan.Map{{
+			Ctx:     arn.Ctx{Partition: "aws", Region: "aws-global", Account: "123"},
+			Service: "iam",
+			Calls:   map[string][]*scan.Call{"GetUser": calls},
+		}}
+	}
+	now := time.Unix(1, 0)
+
+	assert.Empty(t, Diff(newMap(bob, carol), newMap(call("b", "bob"), call("c", "carol")), now))
+	assert.Empty(t, Diff(newMap(carolErr), newMap(carolErr2), now))
+
+	ev := Diff(newMap(bob, carol), newMap(bob2, dave), now)
+	require.Len(t, ev, 3)
+	want := []struct {
+		kind          Kind
+		id            string
+		before, after *scan.Call
+	}{
+		{Modified, "b", bob, bob2},
+		{Deleted, "c", carol, nil},
+		{Created, "d", nil, dave},
+	}
+	for i, w := range want {
+		e := ev[i]
+		assert.Equal(t, w.kind, e.Kind, "%d", i)
+		assert.Equal(t, w.id, e.ID, "%d", i)
+		assert.Equal(t, now, e.Time)
+		assert.Equal(t, "123", e.Account)
+		assert.Equal(t, "aws-global", e.Region)
+		assert.Equal(t, "iam", e.Service)
+		assert.Equal(t, "GetUser", e.API)
+		assert.NotNil(t, e.In)
+		assert.Empty(t, e.Resource)
+		assert.Equal(t, callState(w.before), e.Before, "%d", i)
+		assert.Equal(t, callState(w.after), e.After, "%d", i)
+	}
+
+	ev = Diff(newMap(carol), newMap(carolErr), now)
+	require.Len(t, ev, 1)
+	assert.Equal(t, Modified, ev[0].Kind)
+	assert.Equal(t, "Throttling", ev[0].After.Err.Code)
+}
+
+func TestDiffResources(t *testing.T) {
+	inst := func(id, typ string) map[string]interface{} {
+		return map[string]interface{}{"InstanceId": id, "InstanceType": typ,
+			"VpcId": "vpc-1"}
+	}
+	resv := func(id string, inst ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"ReservationId": id, "OwnerId": "123",
+			"Instances": inst}
+	}
+	newMap := func(out ...interface{}) []*scan.Map {
+		return []*scan.Map{{
+			Ctx:     arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123"},
+			Service: "ec2",
+			Calls: map[string][]*scan.Call{"DescribeInstances": {{
+				ID:  "root",
+				Out: out,
+			}}},
+		}}
+	}
+	prev := newMap(scan.IO{"Reservations": []interface{}{
+		resv("r-1", inst("i-1", "t2.micro"), inst("i-2", "t2.micro")),
+		resv("r-2", inst("i-3", "t2.micro")),
+	}})
+	cur := newMap(scan.IO{"Reservations": []interface{}{
+		resv("r-1", inst("i-1", "t2.micro"), inst("i-2", "m5.large")),
+		resv("r-3", inst("i-4", "t2.micro")),
+	}})
+	now := time.Unix(1, 0)
+	assert.Empty(t, Diff(prev, prev, now))
+
+	ev := Diff(prev, cur, now)
+	require.Len(t, ev, 5)
+	want := []struct {
+		kind Kind
+		res  string
+	}{
+		{Modified, "Reservations:r-1/Instances:i-2"},
+		{Deleted, "Reservations:r-2"},
+		{Deleted, "Reservations:r-2/Instances:i-3"},
+		{Created, "Reservations:r-3"},
+		{Created, "Reservations:r-3/Instances:i-4"},
+	}
+	for i, w := range want {
+		assert.Equal(t, w.kind, ev[i].Kind, "%d", i)
+		assert.Equal(t, "root", ev[i].ID, "%d", i)
+		assert.Equal(t, w.res, ev[i].Resource, "%d", i)
+	}
+	assert.Equal(t, &State{Out: []interface{}{map[string]interface{}{
+		"InstanceId": "i-2", "InstanceType": "m5.large", "VpcId": "vpc-1",
+	}}}, ev[0].After)
+	assert.Equal(t, &State{Out: []interface{}{map[string]interface{}{
+		"ReservationId": "r-2", "OwnerId": "123",
+	}}}, ev[1].Before)
+
+	// Lists without unique IDs are compared as part of their parent
+	tags := func(v string) []*scan.Map {
+		return newMap(scan.IO{"Tags": []interface{}{
+			map[string]interface{}{"Key": "k", "Value": v},
+		}})
+	}
+	ev = Diff(tags("a"), tags("b"), now)
+	require.Len(t, ev, 1)
+	assert.Equal(t, Modified, ev[0].Kind)
+	assert.Empty(t, ev[0].Resource)
+}
+
+func TestResID(t *testing.T) {
+	obj := func(kv ...string) map[string]interface{} {
+		m := make(map[string]interface{})
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = kv[i+1]
+		}
+		return m
+	}
+	tests := []*struct {
+		list string
+		obj  map[string]interface{}
+		id   string
+	}{
+		{"Instances", obj("InstanceId", "i-1", "VpcId", "vpc-1"), "i-1"},
+		{"Functions", obj("FunctionName", "f", "FunctionArn", "arn"), "arn"},
+		{"SecurityGroups", obj("GroupId", "sg-1", "VpcId", "vpc-1"), "sg-1"},
+		{"Policies", obj("PolicyName", "p", "PolicyId", "id"), "id"},
+		{"Addresses", obj("AllocationId", "a", "AddressId", "x"), "x"},
+		{"Buckets", obj("Name", "b"), "b"},
+		{"Tags", obj("Key", "k", "Value", "v"), ""},
+		{"Subnets", obj("VpcId", "vpc-1"), ""},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.id, resID(singular(tc.list), tc.obj), "%+v", tc)
+	}
+}
+
+func callState(c *scan.Call) *State {
+	if c == nil {
+		return nil
+	}
+	return &State{Out: c.Out, Err: c.Err}
+}
+
+func TestSinks(t *testing.T) {
+	ev := []*Event{
+		{Kind: Created, Service: "iam", API: "GetUser", ID: "a"},
+		{Kind: Deleted, Service: "iam", API: "GetUser", ID: "b"},
+	}
+	check := func(b []byte) {
+		var got []*Event
+		dec := json.NewDecoder(bytes.NewReader(b))
+		for dec.More() {
+			var e *Event
+			require.NoError(t, dec.Decode(&e))
+			got = append(got, e)
+		}
+		assert.Equal(t, ev, got)
+	}
+	dir, err := ioutil.TempDir("", "diff")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// File
+	name := filepath.Join(dir, "events")
+	s, err := NewSink(name)
+	require.NoError(t, err)
+	require.NoError(t, s.Send(ev[:1]))
+	require.NoError(t, s.Send(nil))
+	require.NoError(t, s.Send(ev[1:]))
+	require.NoError(t, s.Close())
+	b, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	check(b)
+
+	// Unix socket
+	sock := filepath.Join(dir, "sock")
+	ln, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer ln.Close()
+	recv := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			recv <- nil
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		recv <- b
+	}()
+	s, err = NewSink("unix:" + sock)
+	require.NoError(t, err)
+	require.NoError(t, s.Send(ev))
+	check(<-recv)
+
+	// Webhook
+	var typ string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		typ = r.Header.Get("Content-Type")
+		b, _ = ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	s, err = NewSink(srv.URL + "/hook")
+	require.NoError(t, err)
+	require.NoError(t, s.Send(ev))
+	assert.Equal(t, "application/x-ndjson", typ)
+	check(b)
+	s, err = NewSink(srv.URL + "/fail")
+	require.NoError(t, err)
+	assert.Error(t, s.Send(ev))
+}
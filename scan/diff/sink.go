@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sink receives change events.
+type Sink interface {
+	// Send delivers events as a single batch.
+	Send(ev []*Event) error
+
+	// Close releases sink resources.
+	Close() error
+}
+
+// NewSink returns a sink for the specified spec, which is an "http://" or
+// "https://" webhook URL, "unix:<path>" for a Unix socket, or a file name
+// ("-" for stdout). Events are encoded as JSON lines.
+func NewSink(spec string) (Sink, error) {
+	switch {
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &Webhook{URL: spec, Client: &http.Client{Timeout: time.Minute}}, nil
+	case strings.HasPrefix(spec, "unix:"):
+		return &Socket{Path: strings.TrimPrefix(spec, "unix:")}, nil
+	case spec == "-":
+		return &File{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(spec, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &File{w: f, c: f}, nil
+}
+
+// File is a sink that appends events to a file.
+type File struct {
+	w io.Writer
+	c io.Closer
+}
+
+// Send implements Sink.
+func (f *File) Send(ev []*Event) error {
+	if len(ev) == 0 {
+		return nil
+	}
+	b, err := encode(ev)
+	if err == nil {
+		_, err = f.w.Write(b)
+	}
+	return errors.Wrap(err, "failed to write events")
+}
+
+// Close implements Sink.
+func (f *File) Close() error {
+	if f.c == nil {
+		return nil
+	}
+	return f.c.Close()
+}
+
+// Socket is a sink that writes events to a Unix stream socket. A new
+// connection is made for each batch, so the listener may be restarted between
+// scans.
+type Socket struct{ Path string }
+
+// Send implements Sink.
+func (s *Socket) Send(ev []*Event) error {
+	if len(ev) == 0 {
+		return nil
+	}
+	b, err := encode(ev)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", s.Path)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to event socket")
+	}
+	_, err = conn.Write(b)
+	if e := conn.Close(); err == nil {
+		err = e
+	}
+	return errors.Wrap(err, "failed to write events")
+}
+
+// Close implements Sink.
+func (*Socket) Close() error { return nil }
+
+// Webhook is a sink that posts each batch of events to a URL as one request
+// with an "application/x-ndjson" body.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send implements Sink.
+func (wh *Webhook) Send(ev []*Event) error {
+	if len(ev) == 0 {
+		return nil
+	}
+	b, err := encode(ev)
+	if err != nil {
+		return err
+	}
+	c := wh.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	rsp, err := c.Post(wh.URL, "application/x-ndjson", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to post events")
+	}
+	io.Copy(ioutil.Discard, rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		return errors.Errorf("event webhook returned %s", rsp.Status)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (*Webhook) Close() error { return nil }
+
+// encode returns events as JSON lines.
+func encode(ev []*Event) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	for _, e := range ev {
+		if err := enc.Encode(e); err != nil {
+			return nil, errors.Wrap(err, "failed to encode event")
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,309 @@
+// Package iameval evaluates scanned IAM identity policies offline.
+package iameval
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/pkg/errors"
+)
+
+// Principal is an IAM user or role with all of its identity policies.
+type Principal struct {
+	ARN        arn.ARN   `json:"arn"`
+	Policies   []*Policy `json:"policies,omitempty"`
+	Unresolved []arn.ARN `json:"unresolved,omitempty"` // Managed policies that were not scanned
+}
+
+// Policy is one identity policy that applies to a principal.
+type Policy struct {
+	Name   string      `json:"name"`   // Inline policy name or managed policy ARN
+	Source arn.ARN     `json:"source"` // User, group, or role that has the policy
+	Doc    *policy.Doc `json:"doc"`
+}
+
+// Principals returns all users and roles found in maps, which must not be
+// compacted, sorted by ARN. Only customer managed policy documents are
+// scanned, so AWS managed policies are reported as unresolved.
+func Principals(maps []*scan.Map) ([]*Principal, error) {
+	var all []*Principal
+	for _, m := range maps {
+		if m.Service == iam.EndpointsID {
+			p, err := principals(m)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, p...)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ARN < all[j].ARN })
+	return all, nil
+}
+
+// entity is an IAM user, group, or role.
+type entity struct {
+	arn      arn.ARN
+	inline   []*Policy
+	attached []string
+	groups   []string
+}
+
+// principals returns all users and roles from one IAM map.
+func principals(m *scan.Map) ([]*Principal, error) {
+	users := make(map[string]*entity)
+	groups := make(map[string]*entity)
+	roles := make(map[string]*entity)
+	get := func(all map[string]*entity, name string) *entity {
+		e := all[name]
+		if e == nil {
+			e = new(entity)
+			all[name] = e
+		}
+		return e
+	}
+	docs := make(map[string]*policy.Doc)
+	var err error
+	inline := func(all map[string]*entity, name, pol, doc *string) {
+		d, e := policy.Parse(aws.StringValue(doc))
+		if e != nil && err == nil {
+			err = errors.Wrapf(e, "invalid policy %q for %q",
+				aws.StringValue(pol), aws.StringValue(name))
+		}
+		ent := get(all, aws.StringValue(name))
+		ent.inline = append(ent.inline, &Policy{Name: aws.StringValue(pol), Doc: d})
+	}
+	attach := func(e *entity, ps []iam.AttachedPolicy) {
+		for _, p := range ps {
+			e.attached = append(e.attached, aws.StringValue(p.PolicyArn))
+		}
+	}
+	scan.Walk([]*scan.Map{m}, func(_ *scan.Map, _ string, c *scan.Call) error {
+		for _, out := range c.Out {
+			switch out := out.(type) {
+			case *iam.ListUsersOutput:
+				for _, u := range out.Users {
+					get(users, aws.StringValue(u.UserName)).arn = arn.Value(u.Arn)
+				}
+			case *iam.ListGroupsOutput:
+				for _, g := range out.Groups {
+					get(groups, aws.StringValue(g.GroupName)).arn = arn.Value(g.Arn)
+				}
+			case *iam.ListRolesOutput:
+				for _, r := range out.Roles {
+					get(roles, aws.StringValue(r.RoleName)).arn = arn.Value(r.Arn)
+				}
+			case *iam.GetUserPolicyOutput:
+				inline(users, out.UserName, out.PolicyName, out.PolicyDocument)
+			case *iam.GetGroupPolicyOutput:
+				inline(groups, out.GroupName, out.PolicyName, out.PolicyDocument)
+			case *iam.GetRolePolicyOutput:
+				inline(roles, out.RoleName, out.PolicyName, out.PolicyDocument)
+			case *iam.ListAttachedUserPoliciesOutput:
+				in := c.In.(*iam.ListAttachedUserPoliciesInput)
+				attach(get(users, aws.StringValue(in.UserName)), out.AttachedPolicies)
+			case *iam.ListAttachedGroupPoliciesOutput:
+				in := c.In.(*iam.ListAttachedGroupPoliciesInput)
+				attach(get(groups, aws.StringValue(in.GroupName)), out.AttachedPolicies)
+			case *iam.ListAttachedRolePoliciesOutput:
+				in := c.In.(*iam.ListAttachedRolePoliciesInput)
+				attach(get(roles, aws.StringValue(in.RoleName)), out.AttachedPolicies)
+			case *iam.ListGroupsForUserOutput:
+				u := get(users, aws.StringValue(c.In.(*iam.ListGroupsForUserInput).UserName))
+				for _, g := range out.Groups {
+					u.groups = append(u.groups, aws.StringValue(g.GroupName))
+				}
+			case *iam.GetPolicyVersionOutput:
+				if v := out.PolicyVersion; v != nil && v.Document != nil {
+					pol := aws.StringValue(c.In.(*iam.GetPolicyVersionInput).PolicyArn)
+					d, e := policy.Parse(*v.Document)
+					if e != nil && err == nil {
+						err = errors.Wrapf(e, "invalid policy %q", pol)
+					}
+					docs[pol] = d
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*Principal
+	add := func(p *Principal, src *entity) {
+		for _, pol := range src.inline {
+			cp := *pol
+			cp.Source = src.arn
+			p.Policies = append(p.Policies, &cp)
+		}
+		for _, pol := range src.attached {
+			if d := docs[pol]; d != nil {
+				p.Policies = append(p.Policies, &Policy{Name: pol, Source: src.arn, Doc: d})
+			} else {
+				p.Unresolved = append(p.Unresolved, arn.ARN(pol))
+			}
+		}
+	}
+	for _, set := range []map[string]*entity{users, roles} {
+		for _, e := range set {
+			if e.arn == "" {
+				continue // Not returned by List API
+			}
+			p := &Principal{ARN: e.arn}
+			add(p, e)
+			for _, g := range e.groups {
+				if g := groups[g]; g != nil && g.arn != "" {
+					add(p, g)
+				}
+			}
+			p.Unresolved = dedup(p.Unresolved)
+			all = append(all, p)
+		}
+	}
+	return all, nil
+}
+
+// dedup sorts and removes duplicate ARNs from v.
+func dedup(v []arn.ARN) []arn.ARN {
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+	out := v[:0]
+	for i, r := range v {
+		if i == 0 || r != v[i-1] {
+			out = append(out, r)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Match identifies one statement that determined an evaluation decision.
+type Match struct {
+	Policy string  `json:"policy"`
+	Source arn.ARN `json:"source"`
+	Sid    string  `json:"sid,omitempty"`
+	Effect string  `json:"effect"`
+}
+
+// Result is the outcome of evaluating one request for one principal.
+type Result struct {
+	Principal  arn.ARN         `json:"principal"`
+	Action     string          `json:"action"`
+	Resource   string          `json:"resource"`
+	Decision   policy.Decision `json:"decision"`
+	Matches    []*Match        `json:"matches,omitempty"`
+	Unresolved []arn.ARN       `json:"unresolved,omitempty"` // Decision may be incomplete
+}
+
+// Eval determines whether the principal's identity policies allow action on
+// resource. Permission boundaries, SCPs, session policies, and resource-based
+// policies are not considered. Only keys that describe the principal are known,
+// so statements with conditions on other keys (e.g. aws:SourceIp) make the
+// decision conditional, with those statements reported as matches.
+func (p *Principal) Eval(action, resource string) *Result {
+	req := &policy.Request{
+		Action:   action,
+		Resource: resource,
+		Context:  p.context(),
+		Partial:  true,
+	}
+	// Managed policies attached to the principal and its groups share
+	// statements, which are evaluated once and reported for each source
+	var stmts []*policy.Statement
+	src := make(map[*policy.Statement][]*Policy)
+	for _, pol := range p.Policies {
+		if pol.Doc != nil {
+			for _, s := range pol.Doc.Statement {
+				if src[s] == nil {
+					stmts = append(stmts, s)
+				}
+				src[s] = append(src[s], pol)
+			}
+		}
+	}
+	d, stmts := policy.Eval(req, stmts)
+	r := &Result{
+		Principal:  p.ARN,
+		Action:     action,
+		Resource:   resource,
+		Decision:   d,
+		Unresolved: p.Unresolved,
+	}
+	for _, s := range stmts {
+		for _, pol := range src[s] {
+			r.Matches = append(r.Matches, &Match{
+				Policy: pol.Name,
+				Source: pol.Source,
+				Sid:    s.Sid,
+				Effect: s.Effect,
+			})
+		}
+	}
+	return r
+}
+
+// context returns global condition keys that describe the principal.
+func (p *Principal) context() map[string][]string {
+	ctx := map[string][]string{
+		"aws:PrincipalArn":     {string(p.ARN)},
+		"aws:PrincipalAccount": {p.ARN.Account()},
+	}
+	typ, name := p.ARN.Type(), p.ARN.Name()
+	if typ == "user" {
+		ctx["aws:PrincipalType"] = []string{"User"}
+		ctx["aws:username"] = []string{name}
+	} else if typ == "role" {
+		ctx["aws:PrincipalType"] = []string{"AssumedRole"}
+	}
+	return ctx
+}
+
+// Permission is one statement from the principal's identity policies.
+type Permission struct {
+	Policy string  `json:"policy"`
+	Source arn.ARN `json:"source"`
+	*policy.Statement
+}
+
+// Permissions returns all statements that apply to the principal, with
+// explicit denies listed first.
+func (p *Principal) Permissions() []*Permission {
+	var deny, allow []*Permission
+	for _, pol := range p.Policies {
+		if pol.Doc == nil {
+			continue
+		}
+		for _, s := range pol.Doc.Statement {
+			perm := &Permission{Policy: pol.Name, Source: pol.Source, Statement: s}
+			if s.Effect == policy.Deny {
+				deny = append(deny, perm)
+			} else {
+				allow = append(allow, perm)
+			}
+		}
+	}
+	return append(deny, allow...)
+}
+
+// Find returns all principals matching name, which may be a full ARN, a
+// "user/<name>" or "role/<name>" suffix, a user or role name, or "*" for all
+// principals.
+func Find(all []*Principal, name string) []*Principal {
+	if name == "*" {
+		return all
+	}
+	var out []*Principal
+	for _, p := range all {
+		s := string(p.ARN)
+		if s == name || strings.HasSuffix(s, ":"+name) || p.ARN.Name() == name {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package iameval
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipals(t *testing.T) {
+	const (
+		alice = "arn:aws:iam::123456789012:user/alice"
+		devs  = "arn:aws:iam::123456789012:group/devs"
+		app   = "arn:aws:iam::123456789012:role/app"
+		local = "arn:aws:iam::123456789012:policy/s3-read"
+		admin = "arn:aws:iam::aws:policy/AdministratorAccess"
+	)
+	enc := func(doc string) *string { return aws.String(url.QueryEscape(doc)) }
+	call := func(in interface{}, out ...interface{}) *scan.Call {
+		return &scan.Call{In: in, Out: out}
+	}
+	m := &scan.Map{
+		Ctx:     arn.Ctx{Partition: "aws", Region: "aws-global", Account: "123456789012"},
+		Service: "iam",
+		Calls: map[string][]*scan.Call{
+			"ListUsers": {call(&iam.ListUsersInput{}, &iam.ListUsersOutput{
+				Users: []iam.User{{Arn: aws.String(alice), UserName: aws.String("alice")}},
+			})},
+			"ListGroups": {call(&iam.ListGroupsInput{}, &iam.ListGroupsOutput{
+				Groups: []iam.Group{{Arn: aws.String(devs), GroupName: aws.String("devs")}},
+			})},
+			"ListRoles": {call(&iam.ListRolesInput{}, &iam.ListRolesOutput{
+				Roles: []iam.Role{{Arn: aws.String(app), RoleName: aws.String("app")}},
+			})},
+			"GetUserPolicy": {call(&iam.GetUserPolicyInput{}, &iam.GetUserPolicyOutput{
+				UserName:       aws.String("alice"),
+				PolicyName:     aws.String("deny-prod"),
+				PolicyDocument: enc(`{"Statement":{"Sid":"Prod","Effect":"Deny","Action":"s3:*","Resource":"arn:aws:s3:::prod/*"}}`),
+			})},
+			"GetGroupPolicy": {call(&iam.GetGroupPolicyInput{}, &iam.GetGroupPolicyOutput{
+				GroupName:      aws.String("devs"),
+				PolicyName:     aws.String("ec2"),
+				PolicyDocument: enc(`{"Statement":[{"Effect":"Allow","Action":"ec2:Describe*","Resource":"*"}]}`),
+			})},
+			"GetRolePolicy": {call(&iam.GetRolePolicyInput{}, &iam.GetRolePolicyOutput{
+				RoleName:       aws.String("app"),
+				PolicyName:     aws.String("office"),
+				PolicyDocument: enc(`{"Statement":{"Sid":"Office","Effect":"Allow","Action":"s3:PutObject","Resource":"*","Condition":{"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}}}`),
+			})},
+			"ListGroupsForUser": {call(
+				&iam.ListGroupsForUserInput{UserName: aws.String("alice")},
+				&iam.ListGroupsForUserOutput{Groups: []iam.Group{{GroupName: aws.String("devs")}}},
+			)},
+			"ListAttachedUserPolicies": {call(
+				&iam.ListAttachedUserPoliciesInput{UserName: aws.String("alice")},
+				&iam.ListAttachedUserPoliciesOutput{AttachedPolicies: []iam.AttachedPolicy{
+					{PolicyArn: aws.String(local)},
+				}},
+			)},
+			"ListAttachedRolePolicies": {call(
+				&iam.ListAttachedRolePoliciesInput{RoleName: aws.String("app")},
+				&iam.ListAttachedRolePoliciesOutput{AttachedPolicies: []iam.AttachedPolicy{
+					{PolicyArn: aws.String(local)},
+					{PolicyArn: aws.String(admin)},
+				}},
+			)},
+			"GetPolicyVersion": {call(
+				&iam.GetPolicyVersionInput{PolicyArn: aws.String(local)},
+				&iam.GetPolicyVersionOutput{PolicyVersion: &iam.PolicyVersion{
+					Document: enc(`{"Statement":[{"Sid":"Read","Effect":"Allow","Action":["s3:Get*","s3:List*"],"Resource":"*"}]}`),
+				}},
+			)},
+		},
+	}
+	all, err := Principals([]*scan.Map{m})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	role, user := all[0], all[1]
+	assert.Equal(t, arn.ARN(alice), user.ARN)
+	assert.Equal(t, arn.ARN(app), role.ARN)
+	assert.Len(t, user.Policies, 3)
+	assert.Empty(t, user.Unresolved)
+	assert.Equal(t, []arn.ARN{admin}, role.Unresolved)
+
+	r := user.Eval("s3:GetObject", "arn:aws:s3:::dev/k")
+	assert.Equal(t, policy.Allowed, r.Decision)
+	assert.Equal(t, []*Match{{Policy: local, Source: alice, Sid: "Read", Effect: "Allow"}}, r.Matches)
+
+	r = user.Eval("s3:GetObject", "arn:aws:s3:::prod/k")
+	assert.Equal(t, policy.ExplicitDeny, r.Decision)
+	assert.Equal(t, []*Match{{Policy: "deny-prod", Source: alice, Sid: "Prod", Effect: "Deny"}}, r.Matches)
+
+	r = user.Eval("ec2:DescribeVpcs", "*")
+	assert.Equal(t, policy.Allowed, r.Decision)
+	assert.Equal(t, arn.ARN(devs), r.Matches[0].Source)
+
+	r = role.Eval("ec2:DescribeVpcs", "*")
+	assert.Equal(t, policy.ImplicitDeny, r.Decision)
+	assert.Equal(t, []arn.ARN{admin}, r.Unresolved)
+
+	r = role.Eval("s3:PutObject", "arn:aws:s3:::dev/k")
+	assert.Equal(t, policy.Conditional, r.Decision)
+	assert.Equal(t, []*Match{{Policy: "office", Source: app, Sid: "Office", Effect: "Allow"}}, r.Matches)
+
+	perms := user.Permissions()
+	require.Len(t, perms, 3)
+	assert.Equal(t, "deny-prod", perms[0].Policy)
+
+	assert.Equal(t, all[1:], Find(all, "alice"))
+	assert.Equal(t, all[:1], Find(all, "role/app"))
+	assert.Equal(t, all[:1], Find(all, app))
+	assert.Equal(t, all, Find(all, "*"))
+	assert.Empty(t, Find(all, "bob"))
+}
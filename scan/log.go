@@ -0,0 +1,139 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota // Scheduling and call details
+	LogInfo                  // Notable events
+	LogWarn                  // API errors
+	LogError                 // Scan failures
+)
+
+var logLevels = [...]string{"debug", "info", "warn", "error"}
+
+// String implements fmt.Stringer.
+func (l LogLevel) String() string {
+	if 0 <= l && int(l) < len(logLevels) {
+		return logLevels[l]
+	}
+	return "unknown"
+}
+
+// ParseLogLevel returns the level with the specified name.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, s := range logLevels {
+		if strings.EqualFold(name, s) {
+			return LogLevel(i), nil
+		}
+	}
+	return 0, errors.Errorf("invalid log level %q", name)
+}
+
+// Fields contains structured log message data.
+type Fields map[string]interface{}
+
+// Logger receives structured log messages from the scanner. Implementations
+// must be safe for concurrent use.
+type Logger interface {
+	// Enabled returns true if messages at the specified level are logged.
+	Enabled(LogLevel) bool
+
+	// Log logs one message.
+	Log(lvl LogLevel, msg string, f Fields)
+}
+
+// JSONLogger writes log messages at or above a minimum level to an io.Writer
+// as JSON lines.
+type JSONLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min LogLevel
+	buf bytes.Buffer
+}
+
+// NewJSONLogger returns a logger that writes messages at or above min to w.
+func NewJSONLogger(w io.Writer, min LogLevel) *JSONLogger {
+	return &JSONLogger{w: w, min: min}
+}
+
+// Enabled implements Logger.
+func (l *JSONLogger) Enabled(lvl LogLevel) bool { return lvl >= l.min }
+
+// Log implements Logger. Each line contains "time", "level", and "msg" keys
+// followed by fields in sorted order.
+func (l *JSONLogger) Log(lvl LogLevel, msg string, f Fields) {
+	if !l.Enabled(lvl) {
+		return
+	}
+	hdr, _ := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().UTC().Format(time.RFC3339Nano), lvl.String(), msg})
+	var body []byte
+	if len(f) > 0 {
+		var err error
+		if body, err = json.Marshal(f); err != nil {
+			body, _ = json.Marshal(Fields{"logError": err.Error()})
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := &l.buf
+	b.Reset()
+	b.Write(hdr[:len(hdr)-1])
+	if len(body) > 2 {
+		b.WriteByte(',')
+		b.Write(body[1:])
+	} else {
+		b.WriteByte('}')
+	}
+	b.WriteByte('\n')
+	l.w.Write(b.Bytes())
+}
+
+// log logs a message with context fields if the level is enabled. Fields are
+// only created when needed.
+func (ctx *Ctx) log(lvl LogLevel, msg string, fn func(f Fields)) {
+	if ctx.logger == nil || !ctx.logger.Enabled(lvl) {
+		return
+	}
+	f := Fields{
+		"account": ctx.Account,
+		"region":  ctx.Region,
+		"service": ctx.Service,
+	}
+	if fn != nil {
+		fn(f)
+	}
+	ctx.logger.Log(lvl, msg, f)
+}
+
+// logFields adds API name and call ID to f. It must not be called after the
+// call is finished.
+func (c *Call) logFields(f Fields) {
+	f["api"] = c.bat.lnk.api
+	f["id"] = c.ID
+}
+
+// logErr adds API error information to f.
+func logErr(f Fields, err *Err) {
+	f["status"] = err.Status
+	f["code"] = err.Code
+	f["error"] = err.Message
+	if err.RequestID != "" {
+		f["requestId"] = err.RequestID
+	}
+}
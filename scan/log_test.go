@@ -0,0 +1,57 @@
+package scan
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevel(t *testing.T) {
+	for _, name := range []string{"debug", "info", "warn", "error"} {
+		lvl, err := ParseLogLevel(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, lvl.String())
+	}
+	lvl, err := ParseLogLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LogWarn, lvl)
+	_, err = ParseLogLevel("trace")
+	assert.Error(t, err)
+	assert.Equal(t, "unknown", LogLevel(-1).String())
+}
+
+func TestJSONLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewJSONLogger(&b, LogInfo)
+	assert.False(t, l.Enabled(LogDebug))
+	assert.True(t, l.Enabled(LogWarn))
+	l.Log(LogDebug, "hidden", nil)
+	l.Log(LogInfo, "no fields", nil)
+	l.Log(LogWarn, "call failed", Fields{"code": "AccessDenied", "api": "ListUsers"})
+	lines := bytes.SplitAfter(b.Bytes(), []byte("\n"))
+	require.Len(t, lines, 3)
+	assert.Regexp(t, `^\{"time":"[^"]+","level":"info","msg":"no fields"\}\n$`, string(lines[0]))
+	assert.Regexp(t, `^\{"time":"[^"]+","level":"warn","msg":"call failed",`+
+		`"api":"ListUsers","code":"AccessDenied"\}\n$`, string(lines[1]))
+	assert.Empty(t, lines[2])
+}
+
+// testLogger records log messages.
+type testLogger struct {
+	mu   sync.Mutex
+	msgs map[string]int
+}
+
+func (*testLogger) Enabled(LogLevel) bool { return true }
+
+func (l *testLogger) Log(_ LogLevel, msg string, _ Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.msgs == nil {
+		l.msgs = make(map[string]int)
+	}
+	l.msgs[msg]++
+}
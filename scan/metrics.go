@@ -0,0 +1,313 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the HTTP content type of OpenMetrics text.
+const MetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Histogram bucket upper bounds in seconds.
+var (
+	latencyBuckets = []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	queueBuckets   = []float64{0.001, 0.01, 0.1, 1, 10, 60}
+)
+
+// Metrics collects call and scan metrics across one or more scans. All methods
+// are safe for concurrent use and do nothing if the receiver is nil.
+type Metrics struct {
+	mu        sync.Mutex
+	calls     map[metricKey]float64    // Calls by status
+	requests  map[metricKey]float64    // Requests, including retries
+	retries   map[metricKey]float64    // Retried requests
+	throttles map[metricKey]float64    // Throttled requests
+	latency   map[metricKey]*histogram // Request round trip time
+	queue     histogram                // Time spent waiting for a worker
+	scans     float64                  // Completed scans
+	start     time.Time                // Current scan start time
+	duration  float64                  // Duration of the last completed scan
+}
+
+// metricKey contains metric label values.
+type metricKey struct{ service, region, api, status string }
+
+// NewMetrics returns a new metrics registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		calls:     make(map[metricKey]float64),
+		requests:  make(map[metricKey]float64),
+		retries:   make(map[metricKey]float64),
+		throttles: make(map[metricKey]float64),
+		latency:   make(map[metricKey]*histogram),
+		queue:     newHistogram(queueBuckets),
+	}
+}
+
+// WriteTo writes all metrics to w in OpenMetrics text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	counter := func(name, help string, v map[metricKey]float64) {
+		family(cw, name, "counter", help)
+		for _, k := range sortedKeys(v) {
+			fmt.Fprintf(cw, "%s_total%s %s\n", name, k.labels(""), fmtFloat(v[k]))
+		}
+	}
+	counter("awsscan_calls", "API calls by result status.", m.calls)
+	counter("awsscan_requests", "API requests, including retries.", m.requests)
+	counter("awsscan_retries", "Retried API requests.", m.retries)
+	counter("awsscan_throttles", "Throttled API requests.", m.throttles)
+
+	family(cw, "awsscan_request_duration_seconds", "histogram", "API request round trip time.")
+	keys := make([]metricKey, 0, len(m.latency))
+	for k := range m.latency {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	for _, k := range keys {
+		m.latency[k].write(cw, "awsscan_request_duration_seconds", k)
+	}
+	family(cw, "awsscan_queue_duration_seconds", "histogram", "Time calls spent waiting for a worker.")
+	m.queue.write(cw, "awsscan_queue_duration_seconds", metricKey{})
+
+	family(cw, "awsscan_scans", "counter", "Completed scans.")
+	fmt.Fprintf(cw, "awsscan_scans_total %s\n", fmtFloat(m.scans))
+	family(cw, "awsscan_scan_duration_seconds", "gauge",
+		"Duration of the current or last completed scan.")
+	d := m.duration
+	if !m.start.IsZero() {
+		d = time.Since(m.start).Seconds()
+	}
+	fmt.Fprintf(cw, "awsscan_scan_duration_seconds %s\n", fmtFloat(d))
+	io.WriteString(cw, "# EOF\n")
+	err := cw.w.(*bufio.Writer).Flush()
+	if err == nil {
+		err = cw.err
+	}
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler by writing metrics in OpenMetrics format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+	m.WriteTo(w)
+}
+
+// begin records scan start time.
+func (m *Metrics) begin() {
+	if m != nil {
+		m.mu.Lock()
+		m.start = time.Now()
+		m.mu.Unlock()
+	}
+}
+
+// end records scan duration.
+func (m *Metrics) end() {
+	if m != nil {
+		m.mu.Lock()
+		m.duration = time.Since(m.start).Seconds()
+		m.start = time.Time{}
+		m.scans++
+		m.mu.Unlock()
+	}
+}
+
+// queued records the time call c spent waiting for a worker. It must be called
+// by the worker that received c.
+func (m *Metrics) queued(c *Call) {
+	if m != nil {
+		d := time.Since(c.ready).Seconds()
+		c.ready = time.Time{}
+		m.mu.Lock()
+		m.queue.observe(d)
+		m.mu.Unlock()
+	}
+}
+
+// request records the round trip time d of one request made by call c.
+func (m *Metrics) request(c *Call, d time.Duration) {
+	if m != nil {
+		k := c.metricKey("")
+		m.mu.Lock()
+		h := m.latency[k]
+		if h == nil {
+			hist := newHistogram(latencyBuckets)
+			h = &hist
+			m.latency[k] = h
+		}
+		h.observe(d.Seconds())
+		m.mu.Unlock()
+	}
+}
+
+// exec records the number of requests, retries, and throttles for call c.
+func (m *Metrics) exec(c *Call, requests, retries int) {
+	if m != nil {
+		k := c.metricKey("")
+		m.mu.Lock()
+		m.requests[k] += float64(requests)
+		if retries > 0 {
+			m.retries[k] += float64(retries)
+		}
+		if c.throttles > 0 {
+			m.throttles[k] += float64(c.throttles)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// done records the result status of a finished call to the specified API.
+func (m *Metrics) done(ctx *Ctx, api string, err *Err) {
+	if m != nil {
+		status := "ok"
+		if err != nil {
+			if status = "error"; err.Ignore {
+				status = "ignored"
+			}
+		}
+		k := metricKey{ctx.Service, ctx.Region, api, status}
+		m.mu.Lock()
+		m.calls[k]++
+		m.mu.Unlock()
+	}
+}
+
+// metricKey returns metric labels for call c, which must not be finished.
+func (c *Call) metricKey(status string) metricKey {
+	ctx := c.bat.ctx
+	return metricKey{ctx.Service, ctx.Region, c.bat.lnk.api, status}
+}
+
+// labels returns the label set for k with an optional histogram bucket.
+func (k metricKey) labels(le string) string {
+	var b strings.Builder
+	add := func(name, v string) {
+		if v == "" {
+			return
+		}
+		if b.Len() == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(v))
+		b.WriteByte('"')
+	}
+	add("service", k.service)
+	add("region", k.region)
+	add("api", k.api)
+	add("status", k.status)
+	add("le", le)
+	if b.Len() > 0 {
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+// labelEscaper escapes label values.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// histogram counts observations in buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // Non-cumulative bucket counts, including +Inf
+	sum    float64
+	count  uint64
+}
+
+// newHistogram returns a histogram with the specified bucket upper bounds.
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// observe adds value v to the histogram.
+func (h *histogram) observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.sum += v
+	h.count++
+}
+
+// write writes histogram samples for metric name with labels k.
+func (h *histogram) write(w io.Writer, name string, k metricKey) {
+	var n uint64
+	for i, c := range h.counts {
+		n += c
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = fmtFloat(h.bounds[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, k.labels(le), n)
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, k.labels(""), fmtFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, k.labels(""), h.count)
+}
+
+// family writes metric family metadata.
+func family(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+}
+
+// sortedKeys returns the keys of v in sorted order.
+func sortedKeys(v map[metricKey]float64) []metricKey {
+	keys := make([]metricKey, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	return keys
+}
+
+// sortKeys sorts metric keys by service, region, API, and status.
+func sortKeys(keys []metricKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.region != b.region {
+			return a.region < b.region
+		}
+		if a.api != b.api {
+			return a.api < b.api
+		}
+		return a.status < b.status
+	})
+}
+
+// fmtFloat formats a metric value.
+func fmtFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countWriter counts bytes written to w and retains the first error.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+// Write implements io.Writer.
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,90 @@
+package scan
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	var nilMetrics *Metrics
+	nilMetrics.done(nil, "", nil)
+	n, err := nilMetrics.WriteTo(nil)
+	assert.Zero(t, n)
+	assert.NoError(t, err)
+
+	m := NewMetrics()
+	ctx := &Ctx{Map: Map{Ctx: arn.Ctx{Region: "us-east-1"}, Service: "iam"}}
+	c := &Call{bat: &batch{ctx: ctx, lnk: &link{api: "ListUsers"}}, throttles: 1}
+	m.request(c, 30*time.Millisecond)
+	m.request(c, 2*time.Second)
+	m.exec(c, 3, 1)
+	m.done(ctx, "ListUsers", nil)
+	m.done(ctx, "ListUsers", &Err{Code: "AccessDenied"})
+	m.done(ctx, "ListUsers", &Err{Code: "NoSuchEntity", Ignore: true})
+	m.scans, m.duration = 1, 2.5
+
+	var b bytes.Buffer
+	n, err = m.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, int64(b.Len()), n)
+	lbl := `service="iam",region="us-east-1",api="ListUsers"`
+	want := `# TYPE awsscan_calls counter
+# HELP awsscan_calls API calls by result status.
+awsscan_calls_total{` + lbl + `,status="error"} 1
+awsscan_calls_total{` + lbl + `,status="ignored"} 1
+awsscan_calls_total{` + lbl + `,status="ok"} 1
+# TYPE awsscan_requests counter
+# HELP awsscan_requests API requests, including retries.
+awsscan_requests_total{` + lbl + `} 3
+# TYPE awsscan_retries counter
+# HELP awsscan_retries Retried API requests.
+awsscan_retries_total{` + lbl + `} 1
+# TYPE awsscan_throttles counter
+# HELP awsscan_throttles Throttled API requests.
+awsscan_throttles_total{` + lbl + `} 1
+# TYPE awsscan_request_duration_seconds histogram
+# HELP awsscan_request_duration_seconds API request round trip time.
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="0.025"} 0
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="0.05"} 1
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="0.1"} 1
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="0.25"} 1
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="0.5"} 1
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="1"} 1
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="2.5"} 2
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="5"} 2
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="10"} 2
+awsscan_request_duration_seconds_bucket{` + lbl + `,le="+Inf"} 2
+awsscan_request_duration_seconds_sum{` + lbl + `} 2.03
+awsscan_request_duration_seconds_count{` + lbl + `} 2
+# TYPE awsscan_queue_duration_seconds histogram
+# HELP awsscan_queue_duration_seconds Time calls spent waiting for a worker.
+awsscan_queue_duration_seconds_bucket{le="0.001"} 0
+awsscan_queue_duration_seconds_bucket{le="0.01"} 0
+awsscan_queue_duration_seconds_bucket{le="0.1"} 0
+awsscan_queue_duration_seconds_bucket{le="1"} 0
+awsscan_queue_duration_seconds_bucket{le="10"} 0
+awsscan_queue_duration_seconds_bucket{le="60"} 0
+awsscan_queue_duration_seconds_bucket{le="+Inf"} 0
+awsscan_queue_duration_seconds_sum 0
+awsscan_queue_duration_seconds_count 0
+# TYPE awsscan_scans counter
+# HELP awsscan_scans Completed scans.
+awsscan_scans_total 1
+# TYPE awsscan_scan_duration_seconds gauge
+# HELP awsscan_scan_duration_seconds Duration of the current or last completed scan.
+awsscan_scan_duration_seconds 2.5
+# EOF
+`
+	assert.Equal(t, want, b.String())
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, MetricsContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, want, w.Body.String())
+}
@@ -0,0 +1,127 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	tf "github.com/hashicorp/terraform/terraform"
+)
+
+// Naming determines how Terraform resources are named by Rename.
+type Naming struct {
+	Tag     string // Tag key whose value is preferred over resource ID
+	Account string // Account ID prefix
+}
+
+// Rename replaces the names of all resources in s with valid identifiers in
+// "[<account>_]<region>_<label>" format, where label is the value of the n.Tag
+// tag or the resource ID. State must be refreshed for tags to be available.
+// Names that collide within one resource type are disambiguated by appending a
+// hash of the resource ID, so each name depends only on the resource itself and
+// the set of resources sharing its label, not on scan order. Rename must be
+// called before resource dependencies are inferred.
+func (n Naming) Rename(s *tf.State) {
+	type entry struct {
+		key  string
+		name string
+		id   string
+		r    *tf.ResourceState
+	}
+	rs := s.RootModule().Resources
+	all := make([]*entry, 0, len(rs))
+	for k, r := range rs {
+		e := &entry{key: k, r: r}
+		if r.Primary != nil {
+			e.id = r.Primary.ID
+		}
+		region, label := k[len(r.Type)+1:], ""
+		if i := strings.IndexByte(region, '_'); i >= 0 {
+			region, label = region[:i], region[i+1:]
+		}
+		if e.id != "" {
+			label = e.id
+		}
+		if n.Tag != "" && r.Primary != nil {
+			if v := r.Primary.Attributes["tags."+n.Tag]; v != "" {
+				label = v
+			}
+		}
+		e.name = region + "_" + label
+		if n.Account != "" {
+			e.name = n.Account + "_" + e.name
+		}
+		e.name = r.Type + "." + Ident(e.name)
+		all = append(all, e)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].key < all[j].key })
+
+	// Disambiguate collisions
+	group := make(map[string][]*entry, len(all))
+	for _, e := range all {
+		group[e.name] = append(group[e.name], e)
+	}
+	for _, g := range group {
+		if len(g) > 1 {
+			for _, e := range g {
+				h := sha256.Sum256([]byte(e.id))
+				e.name += "_" + hex.EncodeToString(h[:4])
+			}
+		}
+	}
+
+	// Rebuild resource map, handling duplicate IDs by key order
+	for k := range rs {
+		delete(rs, k)
+	}
+	for _, e := range all {
+		k, i := e.name, 0
+		for rs[k] != nil {
+			i++
+			k = e.name + "_" + strconv.Itoa(i)
+		}
+		rs[k] = e.r
+	}
+}
+
+// Ident converts s into a valid Terraform identifier by replacing invalid
+// characters with underscores. An underscore is prepended if s does not start
+// with a letter or underscore.
+func Ident(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') &&
+			!('0' <= c && c <= '9') && c != '_' && c != '-' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || !(('a' <= b[0] && b[0] <= 'z') ||
+		('A' <= b[0] && b[0] <= 'Z') || b[0] == '_') {
+		b = append([]byte{'_'}, b...)
+	}
+	return string(b)
+}
+
+// stateHash returns a short hash of the resource ID and attributes in r, which
+// is used to disambiguate state keys independently of the order in which
+// resources are added.
+func stateHash(r *tf.ResourceState) string {
+	h := sha256.New()
+	if r.Primary != nil {
+		h.Write([]byte(r.Primary.ID))
+		keys := make([]string, 0, len(r.Primary.Attributes))
+		for k := range r.Primary.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			h.Write([]byte{0})
+			h.Write([]byte(k))
+			h.Write([]byte{0})
+			h.Write([]byte(r.Primary.Attributes[k]))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:4])
+}
@@ -0,0 +1,116 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-terraform/tfx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNaming(t *testing.T) {
+	res := func(typ, id string, tags ...string) *tf.ResourceState {
+		attrs := map[string]string{"id": id}
+		for i := 0; i < len(tags); i += 2 {
+			attrs["tags."+tags[i]] = tags[i+1]
+		}
+		return &tf.ResourceState{
+			Type:    typ,
+			Primary: &tf.InstanceState{ID: id, Attributes: attrs},
+		}
+	}
+	hash := func(id string) string {
+		h := sha256.Sum256([]byte(id))
+		return hex.EncodeToString(h[:4])
+	}
+	vpc1 := res("aws_vpc", "vpc-1", "Name", "web server")
+	vpc2 := res("aws_vpc", "vpc-2", "Name", "db")
+	vpc3 := res("aws_vpc", "vpc-3", "Name", "db")
+	vpc4 := res("aws_vpc", "vpc-4")
+	pol := res("aws_iam_policy", "arn:aws:iam::1:policy/a")
+	user := &tf.ResourceState{Type: "aws_iam_user"}
+	newState := func() *tf.State {
+		s := tfx.NewState()
+		rs := s.RootModule().Resources
+		rs["aws_vpc.us-east-1_vpc-1"] = vpc1
+		rs["aws_vpc.us-east-1_vpc-2"] = vpc2
+		rs["aws_vpc.us-east-1_vpc-3"] = vpc3
+		rs["aws_vpc.us-east-1_vpc-4"] = vpc4
+		rs["aws_iam_policy.aws-global_arn:aws:iam::1:policy/a"] = pol
+		rs["aws_iam_user.aws-global_bob"] = user
+		return s
+	}
+
+	s := newState()
+	Naming{}.Rename(s)
+	assert.Equal(t, map[string]*tf.ResourceState{
+		"aws_vpc.us-east-1_vpc-1":                           vpc1,
+		"aws_vpc.us-east-1_vpc-2":                           vpc2,
+		"aws_vpc.us-east-1_vpc-3":                           vpc3,
+		"aws_vpc.us-east-1_vpc-4":                           vpc4,
+		"aws_iam_policy.aws-global_arn_aws_iam__1_policy_a": pol,
+		"aws_iam_user.aws-global_bob":                       user,
+	}, s.RootModule().Resources)
+
+	s = newState()
+	Naming{Tag: "Name", Account: "123456789012"}.Rename(s)
+	assert.Equal(t, map[string]*tf.ResourceState{
+		"aws_vpc._123456789012_us-east-1_web_server":                      vpc1,
+		"aws_vpc._123456789012_us-east-1_db_" + hash("vpc-2"):             vpc2,
+		"aws_vpc._123456789012_us-east-1_db_" + hash("vpc-3"):             vpc3,
+		"aws_vpc._123456789012_us-east-1_vpc-4":                           vpc4,
+		"aws_iam_policy._123456789012_aws-global_arn_aws_iam__1_policy_a": pol,
+		"aws_iam_user._123456789012_aws-global_bob":                       user,
+	}, s.RootModule().Resources)
+}
+
+func TestIdent(t *testing.T) {
+	tests := []*struct{ in, want string }{
+		{"", "_"},
+		{"abc", "abc"},
+		{"a-b_c", "a-b_c"},
+		{"1abc", "_1abc"},
+		{"-abc", "_-abc"},
+		{"a.b/c:d", "a_b_c_d"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, Ident(tc.in), "in=%q", tc.in)
+	}
+}
+
+func TestAddResources(t *testing.T) {
+	res := func(id, path string) tfx.Resource {
+		return tfx.Resource{
+			Key: "aws_iam_user." + id,
+			ResourceState: &tf.ResourceState{
+				Type:     "aws_iam_user",
+				Provider: "provider.aws",
+				Primary: &tf.InstanceState{ID: id, Attributes: map[string]string{
+					"id":   id,
+					"path": path,
+				}},
+			},
+		}
+	}
+	a, b, c := res("bob", "/a/"), res("bob", "/b/"), res("carol", "/")
+	add := func(rs ...tfx.Resource) map[string]*tf.ResourceState {
+		ctx := &Ctx{Map: Map{Ctx: arn.Ctx{Region: "aws-global"}}}
+		for _, r := range rs {
+			r = res(r.Primary.ID, r.Primary.Attributes["path"])
+			require.NoError(t, ctx.addResources([]tfx.Resource{r}, nil))
+		}
+		return ctx.Resources
+	}
+	want := map[string]*tf.ResourceState{
+		"aws_iam_user.aws-global_bob_" + stateHash(a.ResourceState): a.ResourceState,
+		"aws_iam_user.aws-global_bob_" + stateHash(b.ResourceState): b.ResourceState,
+		"aws_iam_user.aws-global_carol":                             c.ResourceState,
+	}
+	assert.Equal(t, want, add(a, b, c))
+	assert.Equal(t, want, add(c, b, a))
+	assert.Equal(t, want, add(b, a, b, c, a))
+}
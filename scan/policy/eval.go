@@ -0,0 +1,300 @@
+package policy
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Decision is the outcome of policy evaluation.
+type Decision int
+
+const (
+	ImplicitDeny Decision = iota // No statement allows the request
+	Allowed                      // Allowed and not explicitly denied
+	ExplicitDeny                 // Denied by at least one statement
+	Conditional                  // Depends on conditions that were not evaluated
+)
+
+var decisionNames = [...]string{"implicitDeny", "allow", "explicitDeny", "conditional"}
+
+// String implements fmt.Stringer.
+func (d Decision) String() string {
+	if 0 <= d && int(d) < len(decisionNames) {
+		return decisionNames[d]
+	}
+	return "Decision(" + strconv.Itoa(int(d)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Decision) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Request describes an API request for offline policy evaluation.
+type Request struct {
+	Action   string              // Service action (e.g. "s3:GetObject")
+	Resource string              // Resource ARN
+	Context  map[string][]string // Condition keys and their values
+	Partial  bool                // Context may lack keys that the request has
+}
+
+// Eval evaluates all statements in d against req. It returns the decision and
+// the statements that determined it (see Eval).
+func (d *Doc) Eval(req *Request) (Decision, []*Statement) {
+	return Eval(req, d.Statement)
+}
+
+// Eval evaluates stmts, which may come from multiple policies, against req. It
+// returns the decision and the statements that determined it. The decision is
+// Conditional if a statement that could change it applies only under
+// conditions that could not be evaluated, in which case those statements are
+// returned. A request that no statement can allow is denied even if a deny
+// statement is undetermined.
+func Eval(req *Request, stmts []*Statement) (Decision, []*Statement) {
+	var allow, deny, maybeAllow, maybeDeny []*Statement
+	for _, s := range stmts {
+		ok, known := s.Applies(req)
+		if !ok {
+			continue
+		}
+		if s.Effect == Deny {
+			if known {
+				deny = append(deny, s)
+			} else {
+				maybeDeny = append(maybeDeny, s)
+			}
+		} else if s.Effect == Allow {
+			if known {
+				allow = append(allow, s)
+			} else {
+				maybeAllow = append(maybeAllow, s)
+			}
+		}
+	}
+	switch {
+	case len(deny) > 0:
+		return ExplicitDeny, deny
+	case len(maybeDeny) > 0 && len(allow) > 0:
+		return Conditional, maybeDeny
+	case len(maybeDeny) > 0 && len(maybeAllow) > 0:
+		return Conditional, append(maybeDeny, maybeAllow...)
+	case len(allow) > 0:
+		return Allowed, allow
+	case len(maybeAllow) > 0:
+		return Conditional, maybeAllow
+	}
+	return ImplicitDeny, nil
+}
+
+// Applies returns true if the statement action, resource, and conditions may
+// match req. Principals are not evaluated. Statements without Resource or
+// NotResource elements, such as those in role trust policies, match any
+// resource. If the match depends on an unsupported condition operator or, for
+// a partial request, on a key or policy variable that is not in req.Context,
+// the statement is reported as applicable with known set to false.
+func (s *Statement) Applies(req *Request) (ok, known bool) {
+	switch {
+	case len(s.Action) > 0:
+		if ok, _ := matchAny(s.Action, req.Action, nil, true); !ok {
+			return false, true
+		}
+	case len(s.NotAction) > 0:
+		if ok, _ := matchAny(s.NotAction, req.Action, nil, true); ok {
+			return false, true
+		}
+	default:
+		return false, true
+	}
+	known = true
+	if len(s.Resource) > 0 || len(s.NotResource) > 0 {
+		v, neg := s.Resource, false
+		if len(v) == 0 {
+			v, neg = s.NotResource, true
+		}
+		ok, missing := matchAny(v, req.Resource, req.Context, false)
+		if ok == neg && !(missing && req.Partial) {
+			return false, true
+		}
+		known = !missing || !req.Partial
+	}
+	for op, keys := range s.Condition {
+		for key, want := range keys {
+			ok, k := condition(op, key, want, req)
+			if !ok && k {
+				return false, true
+			}
+			known = known && k
+		}
+	}
+	return true, known
+}
+
+// Match returns true if s matches pattern, which may contain '*' and '?'
+// wildcards. Comparison is case-insensitive if fold is true.
+func Match(pattern, s string, fold bool) bool {
+	if fold {
+		pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	}
+	p, i := 0, 0
+	star, next := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case star >= 0:
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchAny returns true if s matches any pattern in v after expanding policy
+// variables using ctx. It also returns missing=true if s might match a pattern
+// with a variable that is missing from ctx.
+func matchAny(v Value, s string, ctx map[string][]string, fold bool) (ok, missing bool) {
+	for _, pattern := range v {
+		p, m := expand(pattern, ctx, "")
+		if Match(p, s, fold) {
+			return true, false
+		}
+		if m && !missing {
+			p, _ = expand(pattern, ctx, "*")
+			missing = Match(p, s, fold)
+		}
+	}
+	return false, missing
+}
+
+// expand replaces policy variables (e.g. "${aws:username}") in s with their
+// values from ctx. Variables without a value are replaced with fill or left
+// unchanged if fill is empty, and missing is set to true.
+func expand(s string, ctx map[string][]string, fill string) (_ string, missing bool) {
+	i := strings.Index(s, "${")
+	if i < 0 {
+		return s, false
+	}
+	var b strings.Builder
+	for i >= 0 {
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		switch name := s[i+2 : i+j]; name {
+		case "*", "?", "$":
+			b.WriteString(name)
+		default:
+			if v := ctx[name]; len(v) > 0 {
+				b.WriteString(v[0])
+			} else if missing = true; fill != "" {
+				b.WriteString(fill)
+			} else {
+				b.WriteString(s[i : i+j+1])
+			}
+		}
+		s = s[i+j+1:]
+		i = strings.Index(s, "${")
+	}
+	b.WriteString(s)
+	return b.String(), missing
+}
+
+// condition evaluates one condition operator for a key in req.Context. It
+// returns known=false if the operator is not supported or, for a partial
+// request, if the key or a policy variable in want is missing from the context.
+func condition(op, key string, want Value, req *Request) (ok, known bool) {
+	have := req.Context[key]
+	if len(have) == 0 && req.Partial {
+		return false, false
+	}
+	allValues := false
+	if i := strings.IndexByte(op, ':'); i >= 0 {
+		switch op[:i] {
+		case "ForAnyValue":
+		case "ForAllValues":
+			allValues = true
+		default:
+			return false, false
+		}
+		op = op[i+1:]
+	}
+	if op == "Null" {
+		return len(want) == 1 && want[0] == strconv.FormatBool(len(have) == 0), true
+	}
+	ifExists := strings.HasSuffix(op, "IfExists")
+	op = strings.TrimSuffix(op, "IfExists")
+	neg := strings.Contains(op, "Not")
+	cmp := comparator(strings.Replace(op, "Not", "", 1))
+	if cmp == nil {
+		return false, false
+	}
+	if len(have) == 0 {
+		// Negated operators and ForAllValues are satisfied by missing keys
+		return ifExists || neg || allValues, true
+	}
+	match := func(v string) (ok, known bool) {
+		missing := false
+		for _, w := range want {
+			w, m := expand(w, req.Context, "")
+			if cmp(v, w) {
+				return !neg, true
+			}
+			missing = missing || m
+		}
+		return neg, !missing || !req.Partial
+	}
+	// A known match decides ForAnyValue, and a known mismatch decides
+	// ForAllValues
+	known = true
+	for _, v := range have {
+		ok, k := match(v)
+		if k && ok != allValues {
+			return ok, true
+		}
+		known = known && k
+	}
+	return known && allValues, known
+}
+
+// comparator returns the comparison function for a positive condition
+// operator or nil if the operator is not supported.
+func comparator(op string) func(have, want string) bool {
+	switch op {
+	case "StringEquals", "ArnEquals":
+		return func(h, w string) bool { return h == w }
+	case "StringEqualsIgnoreCase", "Bool":
+		return strings.EqualFold
+	case "StringLike", "ArnLike":
+		return func(h, w string) bool { return Match(w, h, false) }
+	case "NumericEquals":
+		return numeric(func(h, w float64) bool { return h == w })
+	case "NumericLessThan":
+		return numeric(func(h, w float64) bool { return h < w })
+	case "NumericLessThanEquals":
+		return numeric(func(h, w float64) bool { return h <= w })
+	case "NumericGreaterThan":
+		return numeric(func(h, w float64) bool { return h > w })
+	case "NumericGreaterThanEquals":
+		return numeric(func(h, w float64) bool { return h >= w })
+	}
+	return nil
+}
+
+// numeric converts a numeric comparison into a string comparator.
+func numeric(fn func(h, w float64) bool) func(have, want string) bool {
+	return func(have, want string) bool {
+		h, err1 := strconv.ParseFloat(have, 64)
+		w, err2 := strconv.ParseFloat(want, 64)
+		return err1 == nil && err2 == nil && fn(h, w)
+	}
+}
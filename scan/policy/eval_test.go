@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		fold, want bool
+	}{
+		{"*", "", false, true},
+		{"s3:*", "s3:GetObject", false, true},
+		{"s3:get*", "s3:GetObject", true, true},
+		{"s3:get*", "s3:GetObject", false, false},
+		{"s3:Get*Acl", "s3:GetBucketAcl", false, true},
+		{"s3:Get*Acl", "s3:GetBucketPolicy", false, false},
+		{"arn:aws:s3:::b/?", "arn:aws:s3:::b/k", false, true},
+		{"arn:aws:s3:::b/?", "arn:aws:s3:::b/kk", false, false},
+		{"a*b*c", "aXbYbZc", false, true},
+		{"a*b*c", "aXbYbZ", false, false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, Match(tc.pattern, tc.s, tc.fold), "%+v", tc)
+	}
+}
+
+func TestEval(t *testing.T) {
+	doc, err := Parse(`{
+		"Statement": [{
+			"Sid": "S3",
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": "*"
+		}, {
+			"Sid": "NoDelete",
+			"Effect": "Deny",
+			"Action": "s3:Delete*",
+			"Resource": "arn:aws:s3:::prod/*"
+		}, {
+			"Sid": "Home",
+			"Effect": "Allow",
+			"NotAction": "iam:*",
+			"NotResource": "arn:aws:s3:::prod/*",
+			"Condition": {"StringLike": {"aws:PrincipalArn": "arn:aws:iam::*:user/${aws:username}"}}
+		}, {
+			"Sid": "MFA",
+			"Effect": "Deny",
+			"Action": "ec2:TerminateInstances",
+			"Resource": "*",
+			"Condition": {"BoolIfExists": {"aws:MultiFactorAuthPresent": "false"}}
+		}]
+	}`)
+	require.NoError(t, err)
+	ctx := map[string][]string{
+		"aws:PrincipalArn": {"arn:aws:iam::1:user/alice"},
+		"aws:username":     {"alice"},
+	}
+	partial := false
+	eval := func(action, resource string) (Decision, []string) {
+		req := &Request{Action: action, Resource: resource, Context: ctx, Partial: partial}
+		d, stmts := doc.Eval(req)
+		var sids []string
+		for _, s := range stmts {
+			sids = append(sids, s.Sid)
+		}
+		return d, sids
+	}
+	d, sids := eval("s3:GetObject", "arn:aws:s3:::prod/k")
+	assert.Equal(t, Allowed, d)
+	assert.Equal(t, []string{"S3"}, sids)
+
+	d, sids = eval("s3:DeleteObject", "arn:aws:s3:::prod/k")
+	assert.Equal(t, ExplicitDeny, d)
+	assert.Equal(t, []string{"NoDelete"}, sids)
+
+	d, sids = eval("ec2:DescribeVpcs", "*")
+	assert.Equal(t, Allowed, d)
+	assert.Equal(t, []string{"Home"}, sids)
+
+	d, _ = eval("iam:ListUsers", "*")
+	assert.Equal(t, ImplicitDeny, d)
+
+	d, sids = eval("ec2:TerminateInstances", "*")
+	assert.Equal(t, ExplicitDeny, d)
+	assert.Equal(t, []string{"MFA"}, sids)
+
+	// Unknown keys make conditional statements undetermined
+	partial = true
+	d, sids = eval("ec2:TerminateInstances", "*")
+	assert.Equal(t, Conditional, d)
+	assert.Equal(t, []string{"MFA"}, sids)
+	d, sids = eval("iam:ListUsers", "*")
+	assert.Equal(t, ImplicitDeny, d)
+	assert.Empty(t, sids)
+	partial = false
+
+	ctx["aws:MultiFactorAuthPresent"] = []string{"true"}
+	d, _ = eval("ec2:TerminateInstances", "*")
+	assert.Equal(t, Allowed, d)
+
+	ctx["aws:username"] = []string{"bob"}
+	d, _ = eval("ec2:DescribeVpcs", "*")
+	assert.Equal(t, ImplicitDeny, d)
+	assert.Equal(t, "explicitDeny", ExplicitDeny.String())
+
+	// Conditional allow and an unsupported operator
+	doc, err = Parse(`{
+		"Statement": [{
+			"Sid": "Office",
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::home/${aws:username}/*",
+			"Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+		}, {
+			"Sid": "Dev",
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::dev/*"
+		}, {
+			"Sid": "Tag",
+			"Effect": "Deny",
+			"Action": "s3:*",
+			"Resource": "*",
+			"Condition": {"ForSomeValues:StringEquals": {"aws:PrincipalTag/team": "x"}}
+		}]
+	}`)
+	require.NoError(t, err)
+	ctx = map[string][]string{"aws:SourceIp": {"10.0.0.1"}}
+	d, sids = eval("s3:GetObject", "arn:aws:s3:::dev/k")
+	assert.Equal(t, Conditional, d)
+	assert.Equal(t, []string{"Tag"}, sids)
+	d, sids = eval("s3:GetObject", "arn:aws:s3:::home/bob/k")
+	assert.Equal(t, ImplicitDeny, d)
+	assert.Empty(t, sids)
+	partial = true
+	d, sids = eval("s3:GetObject", "arn:aws:s3:::home/bob/k")
+	assert.Equal(t, Conditional, d)
+	assert.Equal(t, []string{"Tag", "Office"}, sids)
+	d, _ = eval("s3:GetObject", "arn:aws:s3:::prod/k")
+	assert.Equal(t, ImplicitDeny, d)
+	assert.Equal(t, "conditional", Conditional.String())
+}
+
+func TestCondition(t *testing.T) {
+	tests := []struct {
+		op         string
+		have, want Value
+		ok, known  bool
+	}{
+		{"StringEquals", Value{"a"}, Value{"b", "a"}, true, true},
+		{"StringEquals", nil, Value{"a"}, false, true},
+		{"StringNotEquals", Value{"a"}, Value{"b"}, true, true},
+		{"StringNotEquals", nil, Value{"b"}, true, true},
+		{"StringEqualsIgnoreCase", Value{"A"}, Value{"a"}, true, true},
+		{"StringNotLike", Value{"abc"}, Value{"a*"}, false, true},
+		{"ArnLike", Value{"arn:aws:iam::1:role/x"}, Value{"arn:aws:iam::*:role/*"}, true, true},
+		{"NumericLessThan", Value{"5"}, Value{"10"}, true, true},
+		{"NumericGreaterThanEquals", Value{"5"}, Value{"10"}, false, true},
+		{"Null", nil, Value{"true"}, true, true},
+		{"Null", Value{"x"}, Value{"true"}, false, true},
+		{"ForAnyValue:StringEquals", Value{"a", "b"}, Value{"b"}, true, true},
+		{"ForAllValues:StringEquals", Value{"a", "b"}, Value{"b"}, false, true},
+		{"ForAllValues:StringEquals", nil, Value{"b"}, true, true},
+		{"ForSomeValues:StringEquals", Value{"a"}, Value{"a"}, false, false},
+		{"IpAddress", Value{"10.0.0.1"}, Value{"10.0.0.0/8"}, false, false},
+		{"StringEquals", Value{"a"}, Value{"${v}"}, false, true},
+	}
+	for _, tc := range tests {
+		req := &Request{Context: map[string][]string{"k": tc.have}}
+		ok, known := condition(tc.op, "k", tc.want, req)
+		assert.Equal(t, tc.ok, ok && known, "%+v", tc)
+		assert.Equal(t, tc.known, known, "%+v", tc)
+	}
+
+	// Partial requests do not know missing keys and variables
+	partial := []struct {
+		op         string
+		have, want Value
+		ok, known  bool
+	}{
+		{"StringNotEquals", nil, Value{"b"}, false, false},
+		{"Null", nil, Value{"true"}, false, false},
+		{"BoolIfExists", nil, Value{"false"}, false, false},
+		{"StringEquals", Value{"a"}, Value{"${v}"}, false, false},
+		{"StringEquals", Value{"a"}, Value{"${v}", "a"}, true, true},
+		{"StringNotEquals", Value{"a"}, Value{"a", "${v}"}, false, true},
+		{"ForAllValues:StringEquals", Value{"a", "b"}, Value{"${v}"}, false, false},
+		{"ForAllValues:StringEquals", Value{"a", "b"}, Value{"a", "${v}"}, false, false},
+		{"ForAllValues:StringEquals", Value{"a", "b"}, Value{"a", "b", "${v}"}, true, true},
+	}
+	for _, tc := range partial {
+		req := &Request{Context: map[string][]string{"k": tc.have}, Partial: true}
+		ok, known := condition(tc.op, "k", tc.want, req)
+		assert.Equal(t, tc.ok, ok && known, "%+v", tc)
+		assert.Equal(t, tc.known, known, "%+v", tc)
+	}
+}
@@ -0,0 +1,182 @@
+// Package policy decodes IAM and resource-based policy documents.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Effects of policy statements.
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
+// Doc is a policy document.
+type Doc struct {
+	Version   string       `json:",omitempty"`
+	ID        string       `json:"Id,omitempty"`
+	Statement []*Statement `json:",omitempty"`
+}
+
+// Statement is one policy statement.
+type Statement struct {
+	Sid          string     `json:",omitempty"`
+	Effect       string     `json:",omitempty"`
+	Principal    Principal  `json:",omitempty"`
+	NotPrincipal Principal  `json:",omitempty"`
+	Action       Value      `json:",omitempty"`
+	NotAction    Value      `json:",omitempty"`
+	Resource     Value      `json:",omitempty"`
+	NotResource  Value      `json:",omitempty"`
+	Condition    Conditions `json:",omitempty"`
+}
+
+// Conditions maps condition operators to condition keys and values.
+type Conditions map[string]map[string]Value
+
+// Parse decodes a policy document. URL-encoded documents returned by IAM APIs
+// are decoded automatically.
+func Parse(doc string) (*Doc, error) {
+	doc = strings.TrimSpace(doc)
+	if doc != "" && doc[0] != '{' {
+		dec, err := url.QueryUnescape(doc)
+		if err != nil {
+			return nil, err
+		}
+		doc = strings.TrimSpace(dec)
+	}
+	d := new(Doc)
+	if err := json.Unmarshal([]byte(doc), d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts a single statement
+// object in place of an array.
+func (d *Doc) UnmarshalJSON(b []byte) error {
+	var doc struct {
+		Version   string
+		ID        string `json:"Id"`
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	d.Version, d.ID, d.Statement = doc.Version, doc.ID, nil
+	s := bytes.TrimSpace(doc.Statement)
+	if len(s) == 0 || bytes.Equal(s, []byte("null")) {
+		return nil
+	}
+	if s[0] == '{' {
+		st := new(Statement)
+		if err := json.Unmarshal(s, st); err != nil {
+			return err
+		}
+		d.Statement = []*Statement{st}
+		return nil
+	}
+	return json.Unmarshal(s, &d.Statement)
+}
+
+// Public returns true if the statement allows access to anonymous principals
+// without any conditions.
+func (s *Statement) Public() bool {
+	return s.Effect == Allow && s.Principal.Any() && len(s.Condition) == 0
+}
+
+// Value is a list of strings that may be encoded as a single JSON string.
+type Value []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*v = nil
+		return nil
+	case len(b) > 0 && b[0] == '[':
+		var raw []interface{}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return err
+		}
+		out := make(Value, len(raw))
+		for i, r := range raw {
+			out[i] = scalar(r)
+		}
+		*v = out
+		return nil
+	}
+	var raw interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*v = Value{scalar(raw)}
+	return nil
+}
+
+// Contains returns true if v contains s.
+func (v Value) Contains(s string) bool {
+	for _, x := range v {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scalar converts a decoded JSON scalar value into a string.
+func scalar(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Principal maps principal types ("AWS", "Service", "Federated", etc.) to
+// principal identifiers. The anonymous principal "*" is stored under the "*"
+// key.
+type Principal map[string]Value
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Principal) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = Principal{s: Value{s}}
+		return nil
+	}
+	var m map[string]Value
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*p = m
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if len(p) == 1 && p["*"] != nil {
+		return []byte(`"*"`), nil
+	}
+	return json.Marshal(map[string]Value(p))
+}
+
+// Any returns true if p matches any principal.
+func (p Principal) Any() bool {
+	return p["*"] != nil || p["AWS"].Contains("*")
+}
+
+// AWS returns all AWS account and IAM principals in sorted order.
+func (p Principal) AWS() []string {
+	all := append([]string(nil), p["AWS"]...)
+	sort.Strings(all)
+	return all
+}
@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	const doc = `{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": "s3:GetObject",
+			"Resource": ["arn:aws:s3:::bucket/*"]
+		}
+	}`
+	want := &Doc{
+		Version: "2012-10-17",
+		Statement: []*Statement{{
+			Effect:    Allow,
+			Principal: Principal{"*": {"*"}},
+			Action:    Value{"s3:GetObject"},
+			Resource:  Value{"arn:aws:s3:::bucket/*"},
+		}},
+	}
+	d, err := Parse(doc)
+	require.NoError(t, err)
+	assert.Equal(t, want, d)
+	assert.True(t, d.Statement[0].Public())
+
+	d, err = Parse(url.QueryEscape(doc))
+	require.NoError(t, err)
+	assert.Equal(t, want, d)
+
+	_, err = Parse("%7B")
+	assert.Error(t, err)
+}
+
+func TestStatement(t *testing.T) {
+	const doc = `{
+		"Statement": [{
+			"Sid": "1",
+			"Effect": "Allow",
+			"Principal": {"AWS": ["arn:aws:iam::111122223333:root", "444455556666"]},
+			"NotAction": "iam:*",
+			"NotResource": "*",
+			"Condition": {"Bool": {"aws:SecureTransport": true}}
+		}, {
+			"Effect": "Deny",
+			"Principal": {"Service": "ec2.amazonaws.com"},
+			"Action": ["sts:AssumeRole"]
+		}]
+	}`
+	d, err := Parse(doc)
+	require.NoError(t, err)
+	require.Len(t, d.Statement, 2)
+
+	s := d.Statement[0]
+	assert.Equal(t, "1", s.Sid)
+	assert.Equal(t, []string{"444455556666", "arn:aws:iam::111122223333:root"}, s.Principal.AWS())
+	assert.Equal(t, Value{"iam:*"}, s.NotAction)
+	assert.Equal(t, Value{"*"}, s.NotResource)
+	assert.Equal(t, Conditions{"Bool": {"aws:SecureTransport": {"true"}}}, s.Condition)
+	assert.False(t, s.Public())
+
+	s = d.Statement[1]
+	assert.Equal(t, Deny, s.Effect)
+	assert.Equal(t, Value{"ec2.amazonaws.com"}, s.Principal["Service"])
+	assert.False(t, s.Principal.Any())
+}
+
+func TestPrincipal(t *testing.T) {
+	b, err := json.Marshal(Principal{"*": {"*"}})
+	require.NoError(t, err)
+	assert.Equal(t, `"*"`, string(b))
+	b, err = json.Marshal(Principal{"AWS": {"*"}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"AWS":["*"]}`, string(b))
+	assert.True(t, Principal{"AWS": {"*"}}.Any())
+}
@@ -0,0 +1,100 @@
+package scan
+
+import (
+	"sort"
+	"time"
+)
+
+// Progress configures periodic scan progress reports.
+type Progress struct {
+	Interval time.Duration   // Time between reports (default 1s)
+	Detail   <-chan struct{} // Requests a report with per-service breakdown
+	Report   func(*Status)   // Report function called by the scanner
+}
+
+// Status is a snapshot of scan progress. Report functions are called from the
+// scanner goroutine and should return quickly to avoid delaying the scan. The
+// final report has Final set to true. All times are in seconds.
+type Status struct {
+	Elapsed   float64      `json:"elapsed"`   // Time since scan start
+	Contexts  int          `json:"contexts"`  // Service/region contexts remaining
+	Total     int          `json:"total"`     // Calls issued
+	Ready     int          `json:"ready"`     // Calls ready for execution
+	Running   int          `json:"running"`   // Calls being executed
+	Done      int          `json:"done"`      // Calls completed
+	Errors    int          `json:"errors"`    // Calls that returned an error
+	Throttles int          `json:"throttles"` // Throttled requests
+	Rate      float64      `json:"rate"`      // Calls/sec since last report
+	Final     bool         `json:"final,omitempty"`
+	Services  []*CtxStatus `json:"services,omitempty"` // Per-service breakdown
+}
+
+// CtxStatus is the progress of one active service/region context.
+type CtxStatus struct {
+	Region  string `json:"region"`
+	Service string `json:"service"`
+	Total   int    `json:"total"`
+	Ready   int    `json:"ready"`
+	Running int    `json:"running"`
+}
+
+// progress contains scanner state used for progress reports.
+type progress struct {
+	*Progress
+	start     time.Time     // Scan start time
+	last      time.Duration // Elapsed time at the last report
+	lastDone  int           // Completed calls at the last report
+	running   int           // Calls being executed
+	done      int           // Calls completed
+	errors    int           // Calls that returned an error
+	throttles int           // Throttled requests
+}
+
+// report calls the Report function with the current scanner status.
+func (s *scanner) report(detail, final bool) {
+	p := &s.prog
+	now := time.Since(p.start)
+	st := &Status{
+		Elapsed:   now.Seconds(),
+		Contexts:  len(s.heap),
+		Total:     s.calls,
+		Running:   p.running,
+		Done:      p.done,
+		Errors:    p.errors,
+		Throttles: p.throttles,
+		Final:     final,
+	}
+	for _, ctx := range s.heap {
+		st.Ready += ctx.readyCalls
+	}
+	if d := now - p.last; d > 0 {
+		st.Rate = float64(p.done-p.lastDone) / d.Seconds()
+	}
+	p.last, p.lastDone = now, p.done
+	if detail {
+		st.Services = make([]*CtxStatus, 0, len(s.heap))
+		for _, ctx := range s.heap {
+			cs := &CtxStatus{
+				Region:  ctx.Region,
+				Service: ctx.Service,
+				Total:   ctx.totalCalls,
+				Ready:   ctx.readyCalls,
+			}
+			for _, b := range ctx.run {
+				cs.Running += b.wait
+			}
+			st.Services = append(st.Services, cs)
+		}
+		sort.Slice(st.Services, func(i, j int) bool {
+			a, b := st.Services[i], st.Services[j]
+			if a.Running != b.Running {
+				return a.Running > b.Running
+			}
+			if a.Service != b.Service {
+				return a.Service < b.Service
+			}
+			return a.Region < b.Region
+		})
+	}
+	p.Report(st)
+}
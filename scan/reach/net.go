@@ -0,0 +1,213 @@
+package reach
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// portRange is an inclusive range of ports.
+type portRange struct{ from, to int }
+
+// portSet is a sorted list of non-overlapping port ranges.
+type portSet []portRange
+
+// allPorts contains all ports. It is also used for protocols without ports.
+var allPorts = portSet{{0, 65535}}
+
+// intersect returns ports contained in both s and t.
+func (s portSet) intersect(t portSet) portSet {
+	var out portSet
+	for _, a := range s {
+		for _, b := range t {
+			from, to := a.from, a.to
+			if b.from > from {
+				from = b.from
+			}
+			if b.to < to {
+				to = b.to
+			}
+			if from <= to {
+				out = append(out, portRange{from, to})
+			}
+		}
+	}
+	return out
+}
+
+// subtract returns ports contained in s, but not in t.
+func (s portSet) subtract(t portSet) portSet {
+	out := append(portSet(nil), s...)
+	for _, b := range t {
+		var next portSet
+		for _, a := range out {
+			if b.to < a.from || a.to < b.from {
+				next = append(next, a)
+				continue
+			}
+			if a.from < b.from {
+				next = append(next, portRange{a.from, b.from - 1})
+			}
+			if b.to < a.to {
+				next = append(next, portRange{b.to + 1, a.to})
+			}
+		}
+		out = next
+	}
+	return out
+}
+
+// describe returns a description of the ports in s for protocol p. It returns
+// an empty string for protocols without ports.
+func (s portSet) describe(p string) string {
+	if !hasPorts(p) {
+		return ""
+	}
+	parts := make([]string, len(s))
+	for i, r := range s {
+		if r.from == r.to {
+			parts[i] = strconv.Itoa(r.from)
+		} else {
+			parts[i] = strconv.Itoa(r.from) + "-" + strconv.Itoa(r.to)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ephemeralPorts is the port range used by return traffic.
+var ephemeralPorts = portSet{{1024, 65535}}
+
+// returnPorts returns the ports used by return traffic of protocol p.
+func returnPorts(p string) portSet {
+	if hasPorts(p) {
+		return ephemeralPorts
+	}
+	return allPorts
+}
+
+// Protocol numbers.
+const (
+	tcp    = "6"
+	udp    = "17"
+	icmp   = "1"
+	icmpv6 = "58"
+)
+
+// protocol returns the protocol number for a security group or network ACL
+// protocol name or number. All protocols are represented as "-1".
+func protocol(p string) string {
+	switch strings.ToLower(p) {
+	case "tcp":
+		return tcp
+	case "udp":
+		return udp
+	case "icmp":
+		return icmp
+	case "icmpv6":
+		return icmpv6
+	case "all":
+		return "-1"
+	}
+	return p
+}
+
+// protocolName returns the name of protocol number p.
+func protocolName(p string) string {
+	switch p {
+	case tcp:
+		return "tcp"
+	case udp:
+		return "udp"
+	case icmp:
+		return "icmp"
+	case icmpv6:
+		return "icmpv6"
+	case "-1":
+		return "all"
+	}
+	return p
+}
+
+// hasPorts returns true if protocol p uses ports.
+func hasPorts(p string) bool { return p == tcp || p == udp }
+
+// protocols returns the protocols allowed by both a and b. Rules that allow
+// all protocols are evaluated for TCP, UDP, and ICMP (or ICMPv6 for IPv6
+// peers).
+func protocols(a, b *string, peer *net.IPNet) []string {
+	pa, pb := protocol(aws.StringValue(a)), protocol(aws.StringValue(b))
+	switch {
+	case pa == "-1" && pb == "-1":
+		if peer.IP.To4() == nil {
+			return []string{tcp, udp, icmpv6}
+		}
+		return []string{tcp, udp, icmp}
+	case pa == "-1":
+		return []string{pb}
+	case pb == "-1", pa == pb:
+		return []string{pa}
+	}
+	return nil
+}
+
+// privateNets contains address ranges that are not reachable from the
+// internet.
+var privateNets = func() []*net.IPNet {
+	cidrs := []string{
+		"10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.168.0.0/16", "fc00::/7", "fe80::/10",
+	}
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		nets[i] = parseCIDR(c)
+	}
+	return nets
+}()
+
+// public returns true if n contains any internet addresses.
+func public(n *net.IPNet) bool {
+	for _, p := range privateNets {
+		if contains(p, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCIDR returns the network for CIDR block s or nil if s is invalid.
+func parseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil
+	}
+	if ip4 := n.IP.To4(); ip4 != nil {
+		n.IP = ip4
+	}
+	return n
+}
+
+// hostNet returns a single-address network for IP address ip.
+func hostNet(ip *string) *net.IPNet {
+	addr := net.ParseIP(aws.StringValue(ip))
+	if addr == nil {
+		return nil
+	}
+	if ip4 := addr.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(128, 128)}
+}
+
+// contains returns true if network a contains all addresses in b.
+func contains(a, b *net.IPNet) bool {
+	ao, abits := a.Mask.Size()
+	bo, bbits := b.Mask.Size()
+	return abits == bbits && ao <= bo && a.Contains(b.IP)
+}
+
+// overlaps returns true if networks a and b have any addresses in common.
+func overlaps(a, b *net.IPNet) bool {
+	return contains(a, b) || contains(b, a)
+}
@@ -0,0 +1,553 @@
+// Package reach analyzes network reachability of scanned VPC resources offline.
+package reach
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/mxk/awsscan/scan"
+)
+
+// Endpoint is the source or destination of a network path. Internet sources
+// only have the IP field set to a CIDR block.
+type Endpoint struct {
+	ENI      string `json:"eni,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	IP       string `json:"ip"`
+}
+
+// Hop is one route, network ACL entry, or security group rule that allows
+// traffic along a path.
+type Hop struct {
+	Type string `json:"type"` // "route", "network-acl", or "security-group"
+	ID   string `json:"id"`   // Route table, network ACL, or security group ID
+	Rule string `json:"rule"` // Description of the route or rule
+}
+
+// Path is a set of ports that are reachable from Src to Dst.
+type Path struct {
+	Src      Endpoint `json:"src"`
+	Dst      Endpoint `json:"dst"`
+	Protocol string   `json:"protocol"`
+	Ports    string   `json:"ports,omitempty"`
+	Hops     []*Hop   `json:"hops"`
+}
+
+// Model contains the network configuration of all scanned VPCs.
+type Model struct {
+	enis  map[string]*ec2.NetworkInterface
+	sgs   map[string]*ec2.SecurityGroup
+	acls  map[string]*acl            // Subnet ID -> network ACL
+	rtbs  map[string]*ec2.RouteTable // Subnet or VPC ID -> route table
+	peers map[string]*ec2.VpcPeeringConnection
+}
+
+// New creates a model from ec2 calls in maps, which must not be compacted.
+func New(maps []*scan.Map) *Model {
+	m := &Model{
+		enis:  make(map[string]*ec2.NetworkInterface),
+		sgs:   make(map[string]*ec2.SecurityGroup),
+		acls:  make(map[string]*acl),
+		rtbs:  make(map[string]*ec2.RouteTable),
+		peers: make(map[string]*ec2.VpcPeeringConnection),
+	}
+	scan.Walk(maps, func(sm *scan.Map, _ string, c *scan.Call) error {
+		if sm.Service != ec2.EndpointsID {
+			return nil
+		}
+		for _, out := range c.Out {
+			switch out := out.(type) {
+			case *ec2.DescribeNetworkInterfacesOutput:
+				for i := range out.NetworkInterfaces {
+					ni := &out.NetworkInterfaces[i]
+					m.enis[aws.StringValue(ni.NetworkInterfaceId)] = ni
+				}
+			case *ec2.DescribeSecurityGroupsOutput:
+				for i := range out.SecurityGroups {
+					sg := &out.SecurityGroups[i]
+					m.sgs[aws.StringValue(sg.GroupId)] = sg
+				}
+			case *ec2.DescribeNetworkAclsOutput:
+				for i := range out.NetworkAcls {
+					a := newACL(&out.NetworkAcls[i])
+					for _, as := range a.Associations {
+						m.acls[aws.StringValue(as.SubnetId)] = a
+					}
+				}
+			case *ec2.DescribeRouteTablesOutput:
+				for i := range out.RouteTables {
+					rt := &out.RouteTables[i]
+					for _, as := range rt.Associations {
+						if aws.BoolValue(as.Main) {
+							m.rtbs[aws.StringValue(rt.VpcId)] = rt
+						} else if as.SubnetId != nil {
+							m.rtbs[*as.SubnetId] = rt
+						}
+					}
+				}
+			case *ec2.DescribeVpcPeeringConnectionsOutput:
+				for i := range out.VpcPeeringConnections {
+					pcx := &out.VpcPeeringConnections[i]
+					m.peers[aws.StringValue(pcx.VpcPeeringConnectionId)] = pcx
+				}
+			}
+		}
+		return nil
+	})
+	return m
+}
+
+// Internet returns all paths that allow traffic from the internet to network
+// interfaces with public IP addresses, sorted by interface ID. Only security
+// group rules that allow sources outside of private address ranges are
+// considered.
+func (m *Model) Internet() []*Path {
+	var all []*Path
+	for _, id := range m.eniIDs() {
+		ni := m.enis[id]
+		subnet := aws.StringValue(ni.SubnetId)
+		rt, nacl := m.routeTable(ni), m.acls[subnet]
+		if rt == nil || nacl == nil {
+			continue
+		}
+		for _, r := range m.sgRules(ni, false, nil) {
+			src := r.cidr
+			if src == nil || !public(src) {
+				continue
+			}
+			dst := Endpoint{ENI: id, Instance: instanceID(ni)}
+			if src.IP.To4() != nil {
+				dst.IP = publicIP(ni)
+			} else if len(ni.Ipv6Addresses) > 0 {
+				dst.IP = aws.StringValue(ni.Ipv6Addresses[0].Ipv6Address)
+			}
+			route := lookup(rt, src)
+			if dst.IP == "" || route == nil ||
+				!strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+				continue
+			}
+			for _, p := range protocols(r.perm.IpProtocol, aws.String("-1"), src) {
+				for _, in := range nacl.allow(false, p, r.ports(p), src) {
+					out := nacl.allow(true, p, returnPorts(p), src)
+					if len(out) == 0 {
+						continue
+					}
+					all = append(all, &Path{
+						Src:      Endpoint{IP: src.String()},
+						Dst:      dst,
+						Protocol: protocolName(p),
+						Ports:    in.ports.describe(p),
+						Hops: []*Hop{
+							routeHop(rt, route),
+							nacl.hop(in.e),
+							r.hop(),
+							nacl.hop(out[0].e),
+						},
+					})
+				}
+			}
+		}
+	}
+	return all
+}
+
+// Reach returns all paths that allow traffic from src to dst. Both endpoints
+// may be specified as network interface IDs, instance IDs, or private IPv4
+// addresses. Traffic is sent from and to the primary private IPv4 address of
+// each interface.
+func (m *Model) Reach(src, dst string) []*Path {
+	var all []*Path
+	for _, s := range m.find(src) {
+		for _, d := range m.find(dst) {
+			if s != d {
+				all = append(all, m.reach(s, d)...)
+			}
+		}
+	}
+	return all
+}
+
+// Exists returns true if q matches at least one network interface ID, instance
+// ID, or private IP address.
+func (m *Model) Exists(q string) bool { return len(m.find(q)) > 0 }
+
+// reach returns all paths from interface s to interface d.
+func (m *Model) reach(s, d *ec2.NetworkInterface) []*Path {
+	sIP, dIP := hostNet(s.PrivateIpAddress), hostNet(d.PrivateIpAddress)
+	sSub, dSub := aws.StringValue(s.SubnetId), aws.StringValue(d.SubnetId)
+	sRT, dRT := m.routeTable(s), m.routeTable(d)
+	sACL, dACL := m.acls[sSub], m.acls[dSub]
+	if sIP == nil || dIP == nil || sRT == nil || dRT == nil ||
+		sACL == nil || dACL == nil {
+		return nil
+	}
+
+	// Routes must be symmetric for return traffic
+	fwd, ret := lookup(sRT, dIP), lookup(dRT, sIP)
+	if !m.connects(fwd, s, d) || !m.connects(ret, d, s) {
+		return nil
+	}
+
+	// Traffic within a subnet is not evaluated by network ACLs
+	sameSubnet := sSub == dSub
+	var all []*Path
+	for _, e := range m.sgRules(s, true, d) {
+		for _, i := range m.sgRules(d, false, s) {
+			for _, p := range protocols(e.perm.IpProtocol, i.perm.IpProtocol, dIP) {
+				ports := e.ports(p).intersect(i.ports(p))
+				if len(ports) == 0 {
+					continue
+				}
+				newPath := func(ports portSet, acls ...*Hop) *Path {
+					// Hops are listed in the order that traffic traverses them
+					hops := []*Hop{routeHop(sRT, fwd), e.hop()}
+					if len(acls) == 4 {
+						hops = append(hops, acls[0], acls[1])
+					}
+					hops = append(hops, i.hop(), routeHop(dRT, ret))
+					if len(acls) == 4 {
+						hops = append(hops, acls[2], acls[3])
+					}
+					return &Path{
+						Src:      Endpoint{ENI: eniID(s), Instance: instanceID(s), IP: sIP.IP.String()},
+						Dst:      Endpoint{ENI: eniID(d), Instance: instanceID(d), IP: dIP.IP.String()},
+						Protocol: protocolName(p),
+						Ports:    ports.describe(p),
+						Hops:     hops,
+					}
+				}
+				if sameSubnet {
+					all = append(all, newPath(ports))
+					continue
+				}
+				for _, out := range sACL.allow(true, p, ports, dIP) {
+					for _, in := range dACL.allow(false, p, out.ports, sIP) {
+						rout := dACL.allow(true, p, returnPorts(p), sIP)
+						rin := sACL.allow(false, p, returnPorts(p), dIP)
+						if len(rout) == 0 || len(rin) == 0 {
+							continue
+						}
+						all = append(all, newPath(in.ports,
+							sACL.hop(out.e), dACL.hop(in.e),
+							dACL.hop(rout[0].e), sACL.hop(rin[0].e)))
+					}
+				}
+			}
+		}
+	}
+	return all
+}
+
+// connects returns true if route r carries traffic from interface a to b.
+func (m *Model) connects(r *ec2.Route, a, b *ec2.NetworkInterface) bool {
+	if r == nil {
+		return false
+	}
+	av, bv := aws.StringValue(a.VpcId), aws.StringValue(b.VpcId)
+	if aws.StringValue(r.GatewayId) == "local" {
+		return av == bv
+	}
+	pcx := m.peers[aws.StringValue(r.VpcPeeringConnectionId)]
+	if pcx == nil || pcx.Status == nil ||
+		pcx.Status.Code != ec2.VpcPeeringConnectionStateReasonCodeActive ||
+		pcx.RequesterVpcInfo == nil || pcx.AccepterVpcInfo == nil {
+		return false
+	}
+	rv := aws.StringValue(pcx.RequesterVpcInfo.VpcId)
+	xv := aws.StringValue(pcx.AccepterVpcInfo.VpcId)
+	return (av == rv && bv == xv) || (av == xv && bv == rv)
+}
+
+// find returns all interfaces matching an interface ID, instance ID, or
+// private IP address.
+func (m *Model) find(q string) []*ec2.NetworkInterface {
+	var out []*ec2.NetworkInterface
+	for _, id := range m.eniIDs() {
+		ni := m.enis[id]
+		if id == q || instanceID(ni) == q || aws.StringValue(ni.PrivateIpAddress) == q {
+			out = append(out, ni)
+			continue
+		}
+		for _, ip := range ni.PrivateIpAddresses {
+			if aws.StringValue(ip.PrivateIpAddress) == q {
+				out = append(out, ni)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// eniIDs returns all interface IDs in sorted order.
+func (m *Model) eniIDs() []string {
+	ids := make([]string, 0, len(m.enis))
+	for id := range m.enis {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// routeTable returns the route table of the interface subnet.
+func (m *Model) routeTable(ni *ec2.NetworkInterface) *ec2.RouteTable {
+	if rt := m.rtbs[aws.StringValue(ni.SubnetId)]; rt != nil {
+		return rt
+	}
+	return m.rtbs[aws.StringValue(ni.VpcId)]
+}
+
+// lookup returns the most specific active route in rt that contains all
+// addresses in dst.
+func lookup(rt *ec2.RouteTable, dst *net.IPNet) *ec2.Route {
+	var best *ec2.Route
+	bestLen := -1
+	for i := range rt.Routes {
+		r := &rt.Routes[i]
+		if r.State == ec2.RouteStateBlackhole {
+			continue
+		}
+		cidr := r.DestinationCidrBlock
+		if dst.IP.To4() == nil {
+			cidr = r.DestinationIpv6CidrBlock
+		}
+		n := parseCIDR(aws.StringValue(cidr))
+		if n == nil || !contains(n, dst) {
+			continue
+		}
+		if ones, _ := n.Mask.Size(); ones > bestLen {
+			best, bestLen = r, ones
+		}
+	}
+	return best
+}
+
+// routeHop returns the hop for route r in table rt.
+func routeHop(rt *ec2.RouteTable, r *ec2.Route) *Hop {
+	dst := aws.StringValue(r.DestinationCidrBlock)
+	if dst == "" {
+		dst = aws.StringValue(r.DestinationIpv6CidrBlock)
+	}
+	var target string
+	for _, t := range []*string{
+		r.GatewayId, r.VpcPeeringConnectionId, r.NatGatewayId,
+		r.EgressOnlyInternetGatewayId, r.TransitGatewayId,
+		r.NetworkInterfaceId, r.InstanceId,
+	} {
+		if t != nil {
+			target = *t
+			break
+		}
+	}
+	return &Hop{
+		Type: "route",
+		ID:   aws.StringValue(rt.RouteTableId),
+		Rule: dst + " -> " + target,
+	}
+}
+
+// sgRule is one security group permission that matched a peer.
+type sgRule struct {
+	sg     string
+	egress bool
+	perm   *ec2.IpPermission
+	peer   string     // Matched CIDR block or group ID
+	cidr   *net.IPNet // Matched CIDR block
+}
+
+// sgRules returns all ingress or egress permissions of interface ni that match
+// the primary private IP address or security groups of peer. All CIDR-based
+// permissions are returned if peer is nil.
+func (m *Model) sgRules(ni *ec2.NetworkInterface, egress bool, peer *ec2.NetworkInterface) []*sgRule {
+	var peerIP *net.IPNet
+	peerSGs := make(map[string]bool)
+	if peer != nil {
+		peerIP = hostNet(peer.PrivateIpAddress)
+		for _, g := range peer.Groups {
+			peerSGs[aws.StringValue(g.GroupId)] = true
+		}
+	}
+	var out []*sgRule
+	for _, g := range ni.Groups {
+		sg := m.sgs[aws.StringValue(g.GroupId)]
+		if sg == nil {
+			continue
+		}
+		perms := sg.IpPermissions
+		if egress {
+			perms = sg.IpPermissionsEgress
+		}
+		for i := range perms {
+			p := &perms[i]
+			add := func(peer string, cidr *net.IPNet) {
+				out = append(out, &sgRule{
+					sg:     aws.StringValue(sg.GroupId),
+					egress: egress,
+					perm:   p,
+					peer:   peer,
+					cidr:   cidr,
+				})
+			}
+			cidrs := make([]string, 0, len(p.IpRanges)+len(p.Ipv6Ranges))
+			for _, r := range p.IpRanges {
+				cidrs = append(cidrs, aws.StringValue(r.CidrIp))
+			}
+			for _, r := range p.Ipv6Ranges {
+				cidrs = append(cidrs, aws.StringValue(r.CidrIpv6))
+			}
+			for _, c := range cidrs {
+				if n := parseCIDR(c); n != nil && (peer == nil || contains(n, peerIP)) {
+					add(c, n)
+				}
+			}
+			if peer != nil {
+				for _, pair := range p.UserIdGroupPairs {
+					if id := aws.StringValue(pair.GroupId); peerSGs[id] {
+						add(id, nil)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// ports returns the ports of protocol p allowed by r.
+func (r *sgRule) ports(p string) portSet {
+	if !hasPorts(p) || protocol(aws.StringValue(r.perm.IpProtocol)) == "-1" {
+		return allPorts
+	}
+	from, to := aws.Int64Value(r.perm.FromPort), aws.Int64Value(r.perm.ToPort)
+	if from < 0 || to < 0 {
+		return allPorts
+	}
+	return portSet{{int(from), int(to)}}
+}
+
+// hop returns the hop for security group rule r.
+func (r *sgRule) hop() *Hop {
+	dir, rel := "inbound", "from"
+	if r.egress {
+		dir, rel = "outbound", "to"
+	}
+	p := protocol(aws.StringValue(r.perm.IpProtocol))
+	desc := protocolName(p)
+	if s := r.ports(p).describe(p); s != "" {
+		desc += " " + s
+	}
+	return &Hop{
+		Type: "security-group",
+		ID:   r.sg,
+		Rule: fmt.Sprintf("%s %s %s %s", dir, desc, rel, r.peer),
+	}
+}
+
+// acl is a network ACL with entries sorted by rule number.
+type acl struct{ *ec2.NetworkAcl }
+
+// newACL returns a copy of a with sorted entries.
+func newACL(a *ec2.NetworkAcl) *acl {
+	cp := *a
+	cp.Entries = append([]ec2.NetworkAclEntry(nil), a.Entries...)
+	sort.SliceStable(cp.Entries, func(i, j int) bool {
+		return aws.Int64Value(cp.Entries[i].RuleNumber) <
+			aws.Int64Value(cp.Entries[j].RuleNumber)
+	})
+	return &acl{&cp}
+}
+
+// aclMatch is a network ACL entry that allows some of the evaluated ports.
+type aclMatch struct {
+	e     *ec2.NetworkAclEntry
+	ports portSet
+}
+
+// allow evaluates inbound or outbound traffic of protocol p on the specified
+// ports to or from peer. It returns all allow entries that apply, with the
+// ports allowed by each one. Entries that only partially overlap peer allow
+// traffic, but do not deny it, since some peer addresses may still be allowed
+// by later entries.
+func (a *acl) allow(egress bool, p string, ports portSet, peer *net.IPNet) []aclMatch {
+	var out []aclMatch
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		if aws.BoolValue(e.Egress) != egress || len(ports) == 0 {
+			continue
+		}
+		if ep := protocol(aws.StringValue(e.Protocol)); ep != "-1" && ep != p {
+			continue
+		}
+		cidr := e.CidrBlock
+		if peer.IP.To4() == nil {
+			cidr = e.Ipv6CidrBlock
+		}
+		n := parseCIDR(aws.StringValue(cidr))
+		if n == nil || !overlaps(n, peer) {
+			continue
+		}
+		match := ports.intersect(entryPorts(e, p))
+		if len(match) == 0 {
+			continue
+		}
+		if e.RuleAction == ec2.RuleActionAllow {
+			out = append(out, aclMatch{e, match})
+		}
+		if contains(n, peer) {
+			ports = ports.subtract(match)
+		}
+	}
+	return out
+}
+
+// hop returns the hop for network ACL entry e.
+func (a *acl) hop(e *ec2.NetworkAclEntry) *Hop {
+	dir, rel := "inbound", "from"
+	if aws.BoolValue(e.Egress) {
+		dir, rel = "outbound", "to"
+	}
+	p := protocol(aws.StringValue(e.Protocol))
+	desc := protocolName(p)
+	if s := entryPorts(e, p).describe(p); s != "" {
+		desc += " " + s
+	}
+	cidr := aws.StringValue(e.CidrBlock)
+	if cidr == "" {
+		cidr = aws.StringValue(e.Ipv6CidrBlock)
+	}
+	return &Hop{
+		Type: "network-acl",
+		ID:   aws.StringValue(a.NetworkAclId),
+		Rule: fmt.Sprintf("%s rule %d %s %s %s %s", dir, aws.Int64Value(e.RuleNumber),
+			e.RuleAction, desc, rel, cidr),
+	}
+}
+
+// entryPorts returns the ports of protocol p matched by network ACL entry e.
+func entryPorts(e *ec2.NetworkAclEntry, p string) portSet {
+	if !hasPorts(p) || e.PortRange == nil {
+		return allPorts
+	}
+	return portSet{{int(aws.Int64Value(e.PortRange.From)), int(aws.Int64Value(e.PortRange.To))}}
+}
+
+// eniID returns the interface ID.
+func eniID(ni *ec2.NetworkInterface) string { return aws.StringValue(ni.NetworkInterfaceId) }
+
+// instanceID returns the ID of the instance that ni is attached to.
+func instanceID(ni *ec2.NetworkInterface) string {
+	if ni.Attachment != nil {
+		return aws.StringValue(ni.Attachment.InstanceId)
+	}
+	return ""
+}
+
+// publicIP returns the public IPv4 address of ni.
+func publicIP(ni *ec2.NetworkInterface) string {
+	if ni.Association != nil {
+		return aws.StringValue(ni.Association.PublicIp)
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package reach
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInternet(t *testing.T) {
+	m := New(testMaps())
+	all := m.Internet()
+	require.Len(t, all, 1)
+	assert.Equal(t, &Path{
+		Src:      Endpoint{IP: "0.0.0.0/0"},
+		Dst:      Endpoint{ENI: "eni-1", Instance: "i-1", IP: "203.0.113.10"},
+		Protocol: "tcp",
+		Ports:    "80",
+		Hops: []*Hop{
+			{"route", "rtb-2", "0.0.0.0/0 -> igw-1"},
+			{"network-acl", "acl-1", "inbound rule 100 allow tcp 0-65535 from 0.0.0.0/0"},
+			{"security-group", "sg-web", "inbound tcp 80 from 0.0.0.0/0"},
+			{"network-acl", "acl-1", "outbound rule 100 allow all to 0.0.0.0/0"},
+		},
+	}, all[0])
+}
+
+func TestReach(t *testing.T) {
+	m := New(testMaps())
+
+	all := m.Reach("i-1", "10.0.1.10")
+	require.Len(t, all, 1)
+	assert.Equal(t, &Path{
+		Src:      Endpoint{ENI: "eni-1", Instance: "i-1", IP: "10.0.0.10"},
+		Dst:      Endpoint{ENI: "eni-2", IP: "10.0.1.10"},
+		Protocol: "tcp",
+		Ports:    "5432",
+		Hops: []*Hop{
+			{"route", "rtb-2", "10.0.0.0/16 -> local"},
+			{"security-group", "sg-web", "outbound all to 0.0.0.0/0"},
+			{"network-acl", "acl-1", "outbound rule 100 allow all to 0.0.0.0/0"},
+			{"network-acl", "acl-2", "inbound rule 100 allow all from 0.0.0.0/0"},
+			{"security-group", "sg-db", "inbound tcp 5432 from sg-web"},
+			{"route", "rtb-1", "10.0.0.0/16 -> local"},
+			{"network-acl", "acl-2", "outbound rule 100 allow all to 0.0.0.0/0"},
+			{"network-acl", "acl-1", "inbound rule 100 allow tcp 0-65535 from 0.0.0.0/0"},
+		},
+	}, all[0])
+
+	// Peering connection
+	all = m.Reach("eni-1", "eni-3")
+	require.Len(t, all, 1)
+	assert.Equal(t, "5432", all[0].Ports)
+	assert.Equal(t, &Hop{"route", "rtb-2", "10.1.0.0/16 -> pcx-1"}, all[0].Hops[0])
+	assert.Equal(t, &Hop{"route", "rtb-3", "10.0.0.0/16 -> pcx-1"}, all[0].Hops[5])
+
+	// Network ACL denies port 22
+	var ports []string
+	for _, p := range m.Reach("eni-2", "eni-1") {
+		ports = append(ports, p.Ports)
+	}
+	assert.Equal(t, []string{"80", "443"}, ports)
+
+	// No route from the peer VPC to the private subnet
+	assert.Empty(t, m.Reach("eni-3", "eni-2"))
+	assert.Empty(t, m.Reach("eni-1", "eni-1"))
+	assert.Empty(t, m.Reach("eni-1", "i-404"))
+}
+
+func TestPortSet(t *testing.T) {
+	s := portSet{{0, 65535}}.subtract(portSet{{22, 22}, {1000, 2000}})
+	assert.Equal(t, portSet{{0, 21}, {23, 999}, {2001, 65535}}, s)
+	assert.Equal(t, "0-21,23-999,2001-65535", s.describe(tcp))
+	assert.Equal(t, "", s.describe(icmp))
+	assert.Equal(t, portSet{{20, 21}, {23, 80}}, s.intersect(portSet{{20, 80}}))
+	assert.Empty(t, s.intersect(portSet{{22, 22}}))
+}
+
+func testMaps() []*scan.Map {
+	s := aws.String
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	out := func(v ...interface{}) []interface{} { return v }
+	eni := func(id, instance, subnet, vpc, ip, sg string) ec2.NetworkInterface {
+		ni := ec2.NetworkInterface{
+			NetworkInterfaceId: s(id),
+			SubnetId:           s(subnet),
+			VpcId:              s(vpc),
+			PrivateIpAddress:   s(ip),
+			Groups:             []ec2.GroupIdentifier{{GroupId: s(sg)}},
+		}
+		if instance != "" {
+			ni.Attachment = &ec2.NetworkInterfaceAttachment{InstanceId: s(instance)}
+		}
+		return ni
+	}
+	public := eni("eni-1", "i-1", "subnet-1", "vpc-1", "10.0.0.10", "sg-web")
+	public.Association = &ec2.NetworkInterfaceAssociation{PublicIp: s("203.0.113.10")}
+	tcpPerm := func(port int64, cidr string) ec2.IpPermission {
+		return ec2.IpPermission{
+			IpProtocol: s("tcp"),
+			FromPort:   aws.Int64(port),
+			ToPort:     aws.Int64(port),
+			IpRanges:   []ec2.IpRange{{CidrIp: s(cidr)}},
+		}
+	}
+	allEgress := []ec2.IpPermission{{
+		IpProtocol: s("-1"),
+		IpRanges:   []ec2.IpRange{{CidrIp: s("0.0.0.0/0")}},
+	}}
+	entry := func(n int64, egress bool, proto string, action ec2.RuleAction, pr *ec2.PortRange) ec2.NetworkAclEntry {
+		return ec2.NetworkAclEntry{
+			RuleNumber: aws.Int64(n),
+			Egress:     aws.Bool(egress),
+			Protocol:   s(proto),
+			RuleAction: action,
+			CidrBlock:  s("0.0.0.0/0"),
+			PortRange:  pr,
+		}
+	}
+	route := func(cidr, target string) ec2.Route {
+		r := ec2.Route{DestinationCidrBlock: s(cidr), State: ec2.RouteStateActive}
+		if target[:4] == "pcx-" {
+			r.VpcPeeringConnectionId = s(target)
+		} else {
+			r.GatewayId = s(target)
+		}
+		return r
+	}
+	return []*scan.Map{{Ctx: ac, Service: "ec2", Calls: map[string][]*scan.Call{
+		"DescribeNetworkInterfaces": {{ID: "eni", Out: out(&ec2.DescribeNetworkInterfacesOutput{
+			NetworkInterfaces: []ec2.NetworkInterface{
+				public,
+				eni("eni-2", "", "subnet-2", "vpc-1", "10.0.1.10", "sg-db"),
+				eni("eni-3", "", "subnet-3", "vpc-2", "10.1.0.10", "sg-db"),
+			},
+		})}},
+		"DescribeSecurityGroups": {{ID: "sg", Out: out(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []ec2.SecurityGroup{{
+				GroupId: s("sg-web"),
+				IpPermissions: []ec2.IpPermission{
+					tcpPerm(22, "0.0.0.0/0"),
+					tcpPerm(80, "0.0.0.0/0"),
+					tcpPerm(443, "10.0.0.0/8"),
+				},
+				IpPermissionsEgress: allEgress,
+			}, {
+				GroupId: s("sg-db"),
+				IpPermissions: []ec2.IpPermission{{
+					IpProtocol:       s("tcp"),
+					FromPort:         aws.Int64(5432),
+					ToPort:           aws.Int64(5432),
+					UserIdGroupPairs: []ec2.UserIdGroupPair{{GroupId: s("sg-web")}},
+				}},
+				IpPermissionsEgress: allEgress,
+			}},
+		})}},
+		"DescribeNetworkAcls": {{ID: "acl", Out: out(&ec2.DescribeNetworkAclsOutput{
+			NetworkAcls: []ec2.NetworkAcl{{
+				NetworkAclId: s("acl-1"),
+				Associations: []ec2.NetworkAclAssociation{{SubnetId: s("subnet-1")}},
+				Entries: []ec2.NetworkAclEntry{
+					entry(32767, false, "-1", ec2.RuleActionDeny, nil),
+					entry(100, false, "6", ec2.RuleActionAllow, &ec2.PortRange{
+						From: aws.Int64(0), To: aws.Int64(65535)}),
+					entry(90, false, "6", ec2.RuleActionDeny, &ec2.PortRange{
+						From: aws.Int64(22), To: aws.Int64(22)}),
+					entry(100, true, "-1", ec2.RuleActionAllow, nil),
+				},
+			}, {
+				NetworkAclId: s("acl-2"),
+				Associations: []ec2.NetworkAclAssociation{
+					{SubnetId: s("subnet-2")},
+					{SubnetId: s("subnet-3")},
+				},
+				Entries: []ec2.NetworkAclEntry{
+					entry(100, false, "-1", ec2.RuleActionAllow, nil),
+					entry(100, true, "-1", ec2.RuleActionAllow, nil),
+				},
+			}},
+		})}},
+		"DescribeRouteTables": {{ID: "rtb", Out: out(&ec2.DescribeRouteTablesOutput{
+			RouteTables: []ec2.RouteTable{{
+				RouteTableId: s("rtb-1"),
+				VpcId:        s("vpc-1"),
+				Associations: []ec2.RouteTableAssociation{{Main: aws.Bool(true)}},
+				Routes:       []ec2.Route{route("10.0.0.0/16", "local")},
+			}, {
+				RouteTableId: s("rtb-2"),
+				VpcId:        s("vpc-1"),
+				Associations: []ec2.RouteTableAssociation{{SubnetId: s("subnet-1")}},
+				Routes: []ec2.Route{
+					route("10.0.0.0/16", "local"),
+					route("10.1.0.0/16", "pcx-1"),
+					route("0.0.0.0/0", "igw-1"),
+				},
+			}, {
+				RouteTableId: s("rtb-3"),
+				VpcId:        s("vpc-2"),
+				Associations: []ec2.RouteTableAssociation{{Main: aws.Bool(true)}},
+				Routes: []ec2.Route{
+					route("10.1.0.0/16", "local"),
+					route("10.0.0.0/16", "pcx-1"),
+				},
+			}},
+		})}},
+		"DescribeVpcPeeringConnections": {{ID: "pcx", Out: out(&ec2.DescribeVpcPeeringConnectionsOutput{
+			VpcPeeringConnections: []ec2.VpcPeeringConnection{{
+				VpcPeeringConnectionId: s("pcx-1"),
+				RequesterVpcInfo:       &ec2.VpcPeeringConnectionVpcInfo{VpcId: s("vpc-1")},
+				AccepterVpcInfo:        &ec2.VpcPeeringConnectionVpcInfo{VpcId: s("vpc-2")},
+				Status: &ec2.VpcPeeringConnectionStateReason{
+					Code: ec2.VpcPeeringConnectionStateReasonCodeActive,
+				},
+			}},
+		})}},
+	}}}
+}
@@ -0,0 +1,246 @@
+// Package redact removes sensitive values from scan results and Terraform
+// state before they are written.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/policy"
+	"github.com/pkg/errors"
+)
+
+// Mode determines how sensitive values are replaced.
+type Mode string
+
+const (
+	Mask Mode = "mask" // Replace values with Masked
+	Hash Mode = "hash" // Replace values with their HMAC-SHA256
+)
+
+// Masked replaces values redacted in Mask mode.
+const Masked = "REDACTED"
+
+// Rule identifies sensitive fields in API outputs or Terraform resources.
+// Output rules specify Service and/or API patterns, and a Path of
+// dot-separated struct field names, map keys, or slice indices, where '*'
+// matches all elements. Terraform rules specify a Resource type pattern and a
+// Path pattern that is matched against flatmap attribute keys. Service, API,
+// Resource, and Terraform Path patterns may contain '*' and '?' wildcards. All
+// strings under a matching field are redacted.
+type Rule struct {
+	Service  string `json:"service,omitempty"`  // Service name pattern
+	API      string `json:"api,omitempty"`      // API name pattern
+	Resource string `json:"resource,omitempty"` // Terraform resource type pattern
+	Path     string `json:"path"`               // Field path or attribute pattern
+	Mode     Mode   `json:"mode,omitempty"`     // Overrides Redactor mode
+}
+
+// Defaults contains rules for known sensitive fields.
+var Defaults = []*Rule{
+	// API outputs
+	{Service: "apigateway", API: "GetApiKeys", Path: "Items.*.Value"},
+	{Service: "autoscaling", API: "DescribeLaunchConfigurations", Path: "LaunchConfigurations.*.UserData"},
+	{Service: "cloudformation", API: "DescribeStacks", Path: "Stacks.*.Parameters.*.ParameterValue"},
+	{Service: "cloudformation", API: "DescribeStacks", Path: "Stacks.*.Parameters.*.ResolvedValue"},
+	{Service: "ec2", API: "DescribeInstanceAttribute", Path: "UserData"},
+	{Service: "ecs", API: "DescribeTaskDefinition", Path: "TaskDefinition.ContainerDefinitions.*.Environment.*.Value"},
+	{Service: "events", API: "ListTargetsByRule", Path: "Targets.*.Input"},
+	{Service: "lambda", API: "ListFunctions", Path: "Functions.*.Environment.Variables"},
+
+	// Terraform state
+	{Resource: "aws_api_gateway_api_key", Path: "value"},
+	{Resource: "aws_cloudformation_stack", Path: "parameters.*"},
+	{Resource: "aws_cloudwatch_event_target", Path: "input"},
+	{Resource: "aws_ecs_task_definition", Path: "container_definitions"},
+	{Resource: "aws_instance", Path: "user_data*"},
+	{Resource: "aws_lambda_function", Path: "environment.*.variables.*"},
+	{Resource: "aws_launch_configuration", Path: "user_data*"},
+	{Resource: "aws_launch_template", Path: "user_data"},
+}
+
+// LoadRules reads a JSON array of rules from file.
+func LoadRules(file string) ([]*Rule, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var all []*Rule
+	if err = json.Unmarshal(b, &all); err != nil {
+		return nil, errors.Wrapf(err, "invalid redaction rule file %q", file)
+	}
+	for i, r := range all {
+		output := r.Service != "" || r.API != ""
+		switch {
+		case r.Path == "":
+			err = errors.New("missing path")
+		case output == (r.Resource != ""):
+			err = errors.New("rule must specify either service/api or resource")
+		case r.Mode != "" && r.Mode != Mask && r.Mode != Hash:
+			err = errors.Errorf("invalid mode %q", r.Mode)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redaction rule %d in %q", i, file)
+		}
+	}
+	return all, nil
+}
+
+// Redactor applies redaction rules.
+type Redactor struct {
+	Mode  Mode   // Default mode
+	Key   []byte // HMAC key for Hash mode
+	Rules []*Rule
+}
+
+// Validate returns an error if any rule uses Hash mode without a key. Values
+// that cannot be hashed are masked.
+func (r *Redactor) Validate() error {
+	if len(r.Key) > 0 {
+		return nil
+	}
+	for _, rule := range r.Rules {
+		if rule.Mode == Hash || rule.Mode == "" && r.Mode == Hash {
+			return errors.New("hash redaction requires a key")
+		}
+	}
+	return nil
+}
+
+// Maps redacts API outputs in maps.
+func (r *Redactor) Maps(maps []*scan.Map) {
+	scan.Walk(maps, func(m *scan.Map, api string, c *scan.Call) error {
+		for _, rule := range r.Rules {
+			if rule.Resource != "" ||
+				rule.Service != "" && !policy.Match(rule.Service, m.Service, false) ||
+				rule.API != "" && !policy.Match(rule.API, api, false) {
+				continue
+			}
+			path := strings.Split(rule.Path, ".")
+			fn := r.replacer(rule)
+			for _, out := range c.Out {
+				redactPath(reflect.ValueOf(out), path, fn)
+			}
+		}
+		return nil
+	})
+}
+
+// State redacts resource attributes in Terraform state s. Element counts of
+// lists and maps are preserved.
+func (r *Redactor) State(s *tf.State) {
+	for _, mod := range s.Modules {
+		for _, rs := range mod.Resources {
+			if rs.Primary == nil {
+				continue
+			}
+			for _, rule := range r.Rules {
+				if rule.Resource == "" || !policy.Match(rule.Resource, rs.Type, false) {
+					continue
+				}
+				fn := r.replacer(rule)
+				attrs := rs.Primary.Attributes
+				for k, v := range attrs {
+					if !strings.HasSuffix(k, ".#") && !strings.HasSuffix(k, ".%") &&
+						policy.Match(rule.Path, k, false) {
+						attrs[k] = fn(v)
+					}
+				}
+			}
+		}
+	}
+}
+
+// replacer returns the function that replaces sensitive values for rule.
+func (r *Redactor) replacer(rule *Rule) func(string) string {
+	mode := rule.Mode
+	if mode == "" {
+		mode = r.Mode
+	}
+	if mode == Hash && len(r.Key) > 0 {
+		// HMAC prevents dictionary attacks on low-entropy values
+		mac := hmac.New(sha256.New, r.Key)
+		return func(v string) string {
+			if v == "" {
+				return v
+			}
+			mac.Reset()
+			mac.Write([]byte(v))
+			return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+		}
+	}
+	return func(v string) string {
+		if v == "" {
+			return v
+		}
+		return Masked
+	}
+}
+
+// redactPath follows path from v and redacts all strings under the matching
+// values.
+func redactPath(v reflect.Value, path []string, fn func(string) string) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		redactAll(v, fn)
+		return
+	}
+	seg, rest := path[0], path[1:]
+	switch v.Kind() {
+	case reflect.Struct:
+		if seg != "*" {
+			if f := v.FieldByName(seg); f.IsValid() && f.CanSet() {
+				redactPath(f, rest, fn)
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				redactPath(f, rest, fn)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if seg != "*" {
+			if i, err := strconv.Atoi(seg); err == nil && 0 <= i && i < v.Len() {
+				redactPath(v.Index(i), rest, fn)
+			}
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			redactPath(v.Index(i), rest, fn)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		tmp := reflect.New(v.Type().Elem()).Elem()
+		for _, k := range v.MapKeys() {
+			if seg == "*" || k.String() == seg {
+				tmp.Set(v.MapIndex(k))
+				redactPath(tmp, rest, fn)
+				v.SetMapIndex(k, tmp)
+			}
+		}
+	}
+}
+
+// redactAll redacts all strings under v.
+func redactAll(v reflect.Value, fn func(string) string) {
+	redactPath(v, []string{"*"}, fn)
+	if v.Kind() == reflect.String && v.CanSet() {
+		v.SetString(fn(v.String()))
+	}
+}
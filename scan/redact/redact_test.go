@@ -0,0 +1,150 @@
+package redact
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/awsscan/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaps(t *testing.T) {
+	s := aws.String
+	attr := &ec2.DescribeInstanceAttributeOutput{
+		InstanceId: s("i-1"),
+		UserData:   &ec2.AttributeValue{Value: s("c2VjcmV0")},
+	}
+	fn := &lambda.ListFunctionsOutput{
+		Functions: []lambda.UpdateFunctionConfigurationOutput{{
+			FunctionName: s("f"),
+			Environment: &lambda.EnvironmentResponse{
+				Variables: map[string]string{"KEY": "secret", "EMPTY": ""},
+			},
+		}},
+	}
+	stack := &cloudformation.DescribeStacksOutput{
+		Stacks: []cloudformation.Stack{{
+			StackName: s("stack"),
+			Parameters: []cloudformation.Parameter{{
+				ParameterKey:   s("Password"),
+				ParameterValue: s("secret"),
+			}},
+		}},
+	}
+	maps := []*scan.Map{{Service: "ec2", Calls: map[string][]*scan.Call{
+		"DescribeInstanceAttribute": {{Out: []interface{}{attr}}},
+	}}, {Service: "lambda", Calls: map[string][]*scan.Call{
+		"ListFunctions": {{Out: []interface{}{fn}}},
+	}}, {Service: "cloudformation", Calls: map[string][]*scan.Call{
+		"DescribeStacks": {{Out: []interface{}{stack}}},
+	}}}
+
+	r := &Redactor{Mode: Mask, Rules: Defaults}
+	r.Maps(maps)
+	assert.Equal(t, Masked, *attr.UserData.Value)
+	assert.Equal(t, "i-1", *attr.InstanceId)
+	assert.Equal(t, map[string]string{"KEY": Masked, "EMPTY": ""},
+		fn.Functions[0].Environment.Variables)
+	assert.Equal(t, "f", *fn.Functions[0].FunctionName)
+	assert.Equal(t, Masked, *stack.Stacks[0].Parameters[0].ParameterValue)
+	assert.Equal(t, "Password", *stack.Stacks[0].Parameters[0].ParameterKey)
+
+	// Hash mode is stable and only applies to matching services
+	h1 := &lambda.ListFunctionsOutput{Functions: []lambda.UpdateFunctionConfigurationOutput{{
+		Environment: &lambda.EnvironmentResponse{Variables: map[string]string{"KEY": "secret"}},
+	}}}
+	h2 := &lambda.ListFunctionsOutput{Functions: []lambda.UpdateFunctionConfigurationOutput{{
+		Environment: &lambda.EnvironmentResponse{Variables: map[string]string{"KEY": "secret"}},
+	}}}
+	r = &Redactor{Mode: Hash, Key: []byte("key"), Rules: Defaults}
+	r.Maps([]*scan.Map{{Service: "lambda", Calls: map[string][]*scan.Call{
+		"ListFunctions": {{Out: []interface{}{h1, h2}}},
+	}}})
+	want := "hmac-sha256:25cf3c44c8f39313e8cbf7c23e22fe8b2ee8b288ee5206b0a6397583a1f7f0ef"
+	assert.Equal(t, want, h1.Functions[0].Environment.Variables["KEY"])
+	assert.Equal(t, want, h2.Functions[0].Environment.Variables["KEY"])
+
+	// Hash mode without a key is rejected and falls back to masking
+	r = &Redactor{Mode: Hash, Rules: Defaults}
+	assert.Error(t, r.Validate())
+	h1.Functions[0].Environment.Variables["KEY"] = "secret"
+	r.Maps([]*scan.Map{{Service: "lambda", Calls: map[string][]*scan.Call{
+		"ListFunctions": {{Out: []interface{}{h1}}},
+	}}})
+	assert.Equal(t, Masked, h1.Functions[0].Environment.Variables["KEY"])
+	r = &Redactor{Mode: Mask, Rules: []*Rule{{Resource: "*", Path: "x", Mode: Hash}}}
+	assert.Error(t, r.Validate())
+	r.Key = []byte("key")
+	assert.NoError(t, r.Validate())
+	assert.NoError(t, (&Redactor{Mode: Mask, Rules: Defaults}).Validate())
+}
+
+func TestState(t *testing.T) {
+	res := func(typ string, attrs map[string]string) *tf.ResourceState {
+		return &tf.ResourceState{
+			Type:    typ,
+			Primary: &tf.InstanceState{ID: "id", Attributes: attrs},
+		}
+	}
+	s := &tf.State{Modules: []*tf.ModuleState{{
+		Path: tf.RootModulePath,
+		Resources: map[string]*tf.ResourceState{
+			"aws_lambda_function.f": res("aws_lambda_function", map[string]string{
+				"function_name":                 "f",
+				"environment.#":                 "1",
+				"environment.0.variables.%":     "1",
+				"environment.0.variables.TOKEN": "secret",
+			}),
+			"aws_instance.i": res("aws_instance", map[string]string{
+				"id":        "i-1",
+				"user_data": "abc",
+			}),
+		},
+	}}}
+	r := &Redactor{Mode: Mask, Rules: Defaults}
+	r.State(s)
+	assert.Equal(t, map[string]string{
+		"function_name":                 "f",
+		"environment.#":                 "1",
+		"environment.0.variables.%":     "1",
+		"environment.0.variables.TOKEN": Masked,
+	}, s.RootModule().Resources["aws_lambda_function.f"].Primary.Attributes)
+	assert.Equal(t, map[string]string{
+		"id":        "i-1",
+		"user_data": Masked,
+	}, s.RootModule().Resources["aws_instance.i"].Primary.Attributes)
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	load := func(json string) ([]*Rule, error) {
+		file := filepath.Join(dir, "rules.json")
+		require.NoError(t, ioutil.WriteFile(file, []byte(json), 0666))
+		return LoadRules(file)
+	}
+
+	all, err := load(`[{"service": "rds", "path": "DBInstances.*.MasterUsername"},
+		{"resource": "aws_db_instance", "path": "password", "mode": "hash"}]`)
+	require.NoError(t, err)
+	assert.Equal(t, []*Rule{
+		{Service: "rds", Path: "DBInstances.*.MasterUsername"},
+		{Resource: "aws_db_instance", Path: "password", Mode: Hash},
+	}, all)
+
+	_, err = load(`[{"service": "rds"}]`)
+	assert.Error(t, err)
+	_, err = load(`[{"service": "rds", "resource": "aws_db_instance", "path": "x"}]`)
+	assert.Error(t, err)
+	_, err = load(`[{"resource": "aws_db_instance", "path": "x", "mode": "drop"}]`)
+	assert.Error(t, err)
+}
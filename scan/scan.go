@@ -1,12 +1,14 @@
 package scan
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
@@ -26,23 +28,41 @@ const (
 	KeepStats                    // Maintain call statistics
 	CloudAssert                  // Limit calls to those used by cloudassert
 	TFState                      // Generate skeleton Terraform state
+	CIS                          // Limit calls to those used by CIS benchmark
+	CredReport                   // Generate IAM credential report if needed
 )
 
 // Opts specifies optional scan parameters.
 type Opts struct {
-	Mode     Mode     // Scan mode
-	Regions  []string // AWS regions
-	Services []string // Service names
-	Workers  int      // Maximum number of concurrent API calls
+	Mode     Mode      // Scan mode
+	Regions  []string  // AWS regions
+	Services []string  // Service names
+	Workers  int       // Maximum number of concurrent API calls
+	Progress *Progress // Progress reporting configuration
+	Metrics  *Metrics  // Metrics registry
+	Logger   Logger    // Structured logger
+	Tracer   *Tracer   // Span tracer
+	Prev     []*Map    // Unmodified results of a previous scan (see Clone)
+
+	CallTimeout time.Duration // Maximum time for one call, including all pages
+	ScanTimeout time.Duration // Maximum time for the entire scan
+
+	MaxCalls   int            // Maximum number of calls per dependent link
+	Limits     map[string]int // MaxCalls overrides by "<service>.<api>" pattern
+	MaxItems   int            // Maximum number of inputs per source output
+	ItemLimits map[string]int // MaxItems overrides by "<service>.<api>" pattern
+	Sample     bool           // Select limited calls by input hash, not order
 }
 
 // Map contains all calls for one account/region/service, indexed by API name.
-// Resources are indexed by Terraform state keys.
+// Resources are indexed by Terraform state keys. Truncated is only set if some
+// calls were not made because of Opts call or item limits.
 type Map struct {
 	arn.Ctx
 	Service   string
 	Calls     map[string][]*Call
 	Resources map[string]*tf.ResourceState
+	Truncated map[string]int // Number of calls not made by API due to limits
 }
 
 // Account creates a map of each service in each region using worker goroutines.
@@ -94,6 +114,9 @@ func Account(cfg *aws.Config, op Opts) ([]*Map, error) {
 		if svc == nil {
 			return nil, errors.Errorf("invalid or unsupported service %q", s)
 		}
+		if m := op.Mode & svcRegistry.limits; svc.modes&m != m {
+			continue // Service not needed in this mode
+		}
 		for _, r := range op.Regions {
 			if region.Supports(r, svc.id) {
 				all = append(all, newCtx(cfg, ac.In(r), svc, op))
@@ -103,10 +126,45 @@ func Account(cfg *aws.Config, op Opts) ([]*Map, error) {
 	if len(all) == 0 {
 		return nil, nil
 	}
+	sc := context.Background()
+	if op.ScanTimeout > 0 {
+		var cancel context.CancelFunc
+		sc, cancel = context.WithTimeout(sc, op.ScanTimeout)
+		defer cancel()
+	}
+	for _, ctx := range all {
+		ctx.sc = sc
+	}
+	if len(op.Prev) > 0 {
+		prev := prevCalls(op.Prev)
+		for _, ctx := range all {
+			ctx.prev = prev[ctx.ars]
+		}
+	}
 
 	// Scan and combine results
-	s := newScanner(all, op.Workers)
+	log := func(msg string, f Fields) {
+		if op.Logger != nil && op.Logger.Enabled(LogInfo) {
+			op.Logger.Log(LogInfo, msg, f)
+		}
+	}
+	log("scan start", Fields{"account": ac.Account, "contexts": len(all)})
+	start := time.Now()
+	root := op.Tracer.start(nil, "scan")
+	root.set("aws.account", ac.Account)
+	root.set("scan.contexts", len(all))
+	s := newScanner(all, op)
+	s.root = root
 	s.scan()
+	root.set("scan.calls", s.calls)
+	root.set("scan.timeouts", s.tmo)
+	op.Tracer.end(root)
+	log("scan finish", Fields{
+		"account":  ac.Account,
+		"calls":    s.calls,
+		"timeouts": s.tmo,
+		"duration": time.Since(start).Seconds(),
+	})
 	m := make([]*Map, len(all))
 	for i := range all {
 		m[i] = &all[i].Map
@@ -141,6 +199,41 @@ func Walk(maps []*Map, fn WalkFunc) error {
 	return nil
 }
 
+// Clone returns a deep copy of maps. The original maps can be passed to a later
+// scan as Opts.Prev while the copy is compacted or otherwise modified.
+func Clone(maps []*Map) []*Map {
+	cpy := make([]*Map, len(maps))
+	for i, m := range maps {
+		c := *m
+		c.Calls = make(map[string][]*Call, len(m.Calls))
+		for api, calls := range m.Calls {
+			v := make([]*Call, len(calls))
+			for j, c := range calls {
+				v[j] = deepCopy(reflect.ValueOf(c)).Interface().(*Call)
+			}
+			c.Calls[api] = v
+		}
+		cpy[i] = &c
+	}
+	return cpy
+}
+
+// TimedOut returns the number of calls that were aborted by a timeout, indexed
+// by "<account>/<region>/<service>.<api>".
+func TimedOut(maps []*Map) map[string]int {
+	var n map[string]int
+	Walk(maps, func(m *Map, api string, c *Call) error {
+		if c.Err != nil && c.Err.Code == ErrCodeTimeout {
+			if n == nil {
+				n = make(map[string]int)
+			}
+			n[m.Account+"/"+m.Region+"/"+m.Service+"."+api]++
+		}
+		return nil
+	})
+	return n
+}
+
 // Compact replaces all Input/Output structs in m with IO maps containing only
 // non-zero values.
 func Compact(maps []*Map) []*Map {
@@ -231,6 +324,67 @@ func ident(cfg aws.Config, m Mode) (*sts.GetCallerIdentityOutput, error) {
 	return nil, err.Load().(error)
 }
 
+// prevCalls indexes calls in maps by "<account>/<region>/<service>" and ID.
+func prevCalls(maps []*Map) map[string]map[string]*Call {
+	idx := make(map[string]map[string]*Call, len(maps))
+	for _, m := range maps {
+		ars := strings.Join([]string{m.Account, m.Region, m.Service}, "/")
+		calls := idx[ars]
+		if calls == nil {
+			calls = make(map[string]*Call)
+			idx[ars] = calls
+		}
+		for _, v := range m.Calls {
+			for _, c := range v {
+				calls[c.ID] = c
+			}
+		}
+	}
+	return idx
+}
+
+// deepCopy returns a copy of v that does not share any pointers, maps, or
+// slices reachable through exported fields. Unexported fields, such as SDK
+// response metadata, are copied by value.
+func deepCopy(v reflect.Value) reflect.Value {
+	cpy := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			cpy.Set(reflect.New(v.Type().Elem()))
+			cpy.Elem().Set(deepCopy(v.Elem()))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			cpy.Set(deepCopy(v.Elem()))
+		}
+	case reflect.Struct:
+		cpy.Set(v)
+		for i := cpy.NumField() - 1; i >= 0; i-- {
+			if f := cpy.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i)))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			cpy.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := v.Len() - 1; i >= 0; i-- {
+				cpy.Index(i).Set(deepCopy(v.Index(i)))
+			}
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			cpy.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			for _, k := range v.MapKeys() {
+				cpy.SetMapIndex(k, deepCopy(v.MapIndex(k)))
+			}
+		}
+	default:
+		cpy.Set(v)
+	}
+	return cpy
+}
+
 // compactIO converts an Input/Output struct pointer to an IO map, keeping only
 // those fields that have valid data. It returns nil if all fields are empty.
 func compactIO(io interface{}, skipFields typeBitSet, in bool) interface{} {
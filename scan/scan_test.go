@@ -1,9 +1,14 @@
 package scan
 
 import (
+	"bytes"
+	"encoding/json"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/awserr"
@@ -172,13 +177,46 @@ func TestScan(t *testing.T) {
 	svcRegistry.register("iam", iam.EndpointsID, iam.New, iamSvc{}, []interface{}{
 		[]iam.ListUsersInput{},
 	})
+	var final *Status
+	mt := NewMetrics()
+	log := new(testLogger)
+	var spans bytes.Buffer
+	tr := NewTracer(&spans)
 	m, err := Account(&cfg, Opts{
 		Regions:  []string{"aws-global"},
 		Services: []string{"iam"},
 		Workers:  1,
+		Metrics:  mt,
+		Logger:   log,
+		Tracer:   tr,
+		Progress: &Progress{Report: func(st *Status) {
+			if st.Final {
+				final = st
+			}
+		}},
 	})
 	require.NoError(t, err)
 	require.Len(t, m, 1)
+	require.NotNil(t, final)
+	assert.Equal(t, 7, final.Total)
+	assert.Equal(t, 7, final.Done)
+	assert.Equal(t, 0, final.Running+final.Ready+final.Contexts+final.Errors)
+	assert.Equal(t, map[string]int{
+		"scan start":     1,
+		"link scheduled": 3,
+		"call start":     7,
+		"call finish":    7,
+		"scan finish":    1,
+	}, log.msgs)
+	require.NoError(t, tr.Err())
+	checkSpans(t, &spans)
+	var b strings.Builder
+	mt.WriteTo(&b)
+	assert.Contains(t, b.String(), `awsscan_calls_total{service="iam",`+
+		`region="aws-global",api="GetUserPolicy",status="ok"} 3`+"\n")
+	assert.Contains(t, b.String(), "awsscan_requests_total{service=\"iam\","+
+		"region=\"aws-global\",api=\"ListUsers\"} 3\n")
+	assert.Contains(t, b.String(), "awsscan_scans_total 1\n")
 	want.Ctx = arn.Ctx{"aws", "aws-global", "000000000000"}
 	want.Service = "iam"
 	require.Equal(t, &want, m[0])
@@ -263,6 +301,352 @@ func TestScan(t *testing.T) {
 	assert.Equal(t, &want, m[0])
 }
 
+func TestIncremental(t *testing.T) {
+	pages := [][]string{{"alice", "bob"}, {"carol"}}
+	policies := map[string][]string{"alice": {"policy0", "policy1"}, "bob": {"policy2"}}
+	reqs := make(map[string]int)
+	cfg := awsmock.Config(func(r *aws.Request) {
+		reqs[r.Operation.Name]++
+		switch in := r.Params.(type) {
+		case *sts.GetCallerIdentityInput:
+			out := r.Data.(*sts.GetCallerIdentityOutput)
+			out.Account = aws.String("000000000000")
+			out.Arn = aws.String("arn:aws:iam::000000000000:user/alice")
+		case *iam.ListUsersInput:
+			i, _ := strconv.Atoi(aws.StringValue(in.Marker))
+			out := r.Data.(*iam.ListUsersOutput)
+			for _, name := range pages[i] {
+				out.Users = append(out.Users, iam.User{UserName: aws.String(name)})
+			}
+			if i++; i < len(pages) {
+				out.IsTruncated = aws.Bool(true)
+				out.Marker = aws.String(strconv.Itoa(i))
+			}
+		case *iam.ListUserPoliciesInput:
+			out := r.Data.(*iam.ListUserPoliciesOutput)
+			out.PolicyNames = policies[aws.StringValue(in.UserName)]
+		case *iam.GetUserPolicyInput:
+			out := r.Data.(*iam.GetUserPolicyOutput)
+			out.PolicyName = in.PolicyName
+			out.UserName = in.UserName
+		}
+	})
+
+	orig := svcRegistry
+	defer func() { svcRegistry = orig }()
+	svcRegistry = registry{}
+	svcRegistry.register("iam", iam.EndpointsID, iam.New, iamSvc{}, []interface{}{
+		[]iam.ListUsersInput{},
+	})
+	scan := func(prev []*Map) []*Map {
+		for k := range reqs {
+			delete(reqs, k)
+		}
+		m, err := Account(&cfg, Opts{
+			Mode:     KeepStats,
+			Regions:  []string{"aws-global"},
+			Services: []string{"iam"},
+			Workers:  1,
+			Prev:     prev,
+		})
+		require.NoError(t, err)
+		require.Len(t, m, 1)
+		return m
+	}
+	outs := func(m []*Map) map[string][]interface{} {
+		v := make(map[string][]interface{})
+		Walk(Compact(Clone(m)), func(_ *Map, _ string, c *Call) error {
+			v[c.ID] = c.Out
+			return nil
+		})
+		return v
+	}
+	reused := func(m []*Map, api string) (n int) {
+		for _, c := range m[0].Calls[api] {
+			n += c.Stats.Reused
+		}
+		return
+	}
+
+	// Full scan
+	m1 := scan(nil)
+	assert.Equal(t, 3, reqs["GetUserPolicy"])
+	cpy := Compact(Clone(m1))
+	require.Len(t, cpy, 1)
+	assert.IsType(t, IO{}, cpy[0].Calls["ListUsers"][0].Out[0])
+	assert.IsType(t, &iam.ListUsersOutput{}, m1[0].Calls["ListUsers"][0].Out[0])
+
+	// Nothing changed
+	m2 := scan(m1)
+	assert.Equal(t, map[string]int{
+		"GetCallerIdentity": 1,
+		"ListUsers":         2,
+	}, reqs)
+	assert.Equal(t, 3, reused(m2, "ListUserPolicies"))
+	assert.Equal(t, 3, reused(m2, "GetUserPolicy"))
+	assert.Equal(t, outs(m1), outs(m2))
+
+	// Second page changed
+	pages[1] = []string{"dave"}
+	policies["dave"] = []string{"policy3"}
+	m3 := scan(m2)
+	assert.Equal(t, map[string]int{
+		"GetCallerIdentity": 1,
+		"ListUsers":         2,
+		"ListUserPolicies":  1,
+		"GetUserPolicy":     1,
+	}, reqs)
+	assert.Equal(t, 2, reused(m3, "ListUserPolicies"))
+	assert.Equal(t, 3, reused(m3, "GetUserPolicy"))
+	require.Len(t, m3[0].Calls["GetUserPolicy"], 4)
+
+	// Saved scan
+	saved := []*Map{{Ctx: m3[0].Ctx, Service: "iam", Calls: make(map[string][]*Call)}}
+	Walk(m3, func(_ *Map, api string, c *Call) error {
+		b, err := json.Marshal(c)
+		require.NoError(t, err)
+		d, err := DecodeCall("iam", api, b)
+		require.NoError(t, err)
+		d.ID = c.ID
+		saved[0].Calls[api] = append(saved[0].Calls[api], d)
+		return nil
+	})
+	assert.IsType(t, &iam.ListUsersOutput{}, saved[0].Calls["ListUsers"][0].Out[0])
+	m4 := scan(saved)
+	assert.Equal(t, map[string]int{
+		"GetCallerIdentity": 1,
+		"ListUsers":         2,
+	}, reqs)
+	assert.Equal(t, 3, reused(m4, "ListUserPolicies"))
+	assert.Equal(t, 4, reused(m4, "GetUserPolicy"))
+	assert.Equal(t, outs(m3), outs(m4))
+	_, err := DecodeCall("iam", "GetUser", []byte("{}"))
+	assert.Error(t, err)
+
+	// Volatile API
+	for _, lnk := range svcRegistry.get()["iam"].api["GetUserPolicy"] {
+		lnk.volatile = true
+	}
+	m5 := scan(m4)
+	assert.Equal(t, 4, reqs["GetUserPolicy"])
+	assert.Equal(t, 3, reused(m5, "ListUserPolicies"))
+	assert.Equal(t, 0, reused(m5, "GetUserPolicy"))
+}
+
+func TestClearEmpty(t *testing.T) {
+	type T struct {
+		A []string
+		B map[string][]int
+		C []*T
+		d []int
+	}
+	v := &T{
+		A: []string{},
+		B: map[string][]int{"x": {}, "y": {1}},
+		C: []*T{{A: []string{}}},
+		d: []int{},
+	}
+	clearEmpty(reflect.ValueOf(v))
+	assert.Equal(t, &T{
+		B: map[string][]int{"x": nil, "y": {1}},
+		C: []*T{{}},
+		d: []int{},
+	}, v)
+}
+
+func TestTimeout(t *testing.T) {
+	hang := func(r *aws.Request) {
+		<-r.Context().Done()
+		r.Error = awserr.New(aws.ErrCodeRequestCanceled, "request context canceled",
+			r.Context().Err())
+	}
+	cfg := awsmock.Config(func(r *aws.Request) {
+		switch in := r.Params.(type) {
+		case *sts.GetCallerIdentityInput:
+			out := r.Data.(*sts.GetCallerIdentityOutput)
+			out.Account = aws.String("000000000000")
+			out.Arn = aws.String("arn:aws:iam::000000000000:user/alice")
+		case *iam.ListUsersInput:
+			if in.Marker != nil {
+				hang(r)
+				return
+			}
+			out := r.Data.(*iam.ListUsersOutput)
+			out.Users = []iam.User{{UserName: aws.String("alice")}, {UserName: aws.String("bob")}}
+			out.IsTruncated = aws.Bool(true)
+			out.Marker = aws.String("1")
+		case *iam.ListUserPoliciesInput:
+			out := r.Data.(*iam.ListUserPoliciesOutput)
+			out.PolicyNames = []string{"policy0", "policy2"}
+		case *iam.GetUserPolicyInput:
+			if aws.StringValue(in.UserName) == "bob" {
+				hang(r)
+			}
+		}
+	})
+
+	orig := svcRegistry
+	defer func() { svcRegistry = orig }()
+	svcRegistry = registry{}
+	svcRegistry.register("iam", iam.EndpointsID, iam.New, iamSvc{}, []interface{}{
+		[]iam.ListUsersInput{},
+	})
+	op := Opts{
+		Regions:     []string{"aws-global"},
+		Services:    []string{"iam"},
+		Workers:     1,
+		CallTimeout: 50 * time.Millisecond,
+	}
+
+	// Call timeout keeps partial outputs and lets dependent links proceed
+	m, err := Account(&cfg, op)
+	require.NoError(t, err)
+	require.Len(t, m, 1)
+	lu := m[0].Calls["ListUsers"][0]
+	require.NotNil(t, lu.Err)
+	assert.Equal(t, ErrCodeTimeout, lu.Err.Code)
+	assert.Equal(t, "call timed out after 50ms", lu.Err.Message)
+	assert.Equal(t, aws.ErrCodeRequestCanceled, lu.Err.Cause.Code)
+	assert.Len(t, lu.Out, 1)
+	assert.Len(t, m[0].Calls["ListUserPolicies"], 2)
+	assert.Equal(t, map[string]int{
+		"000000000000/aws-global/iam.ListUsers":     1,
+		"000000000000/aws-global/iam.GetUserPolicy": 2,
+	}, TimedOut(m))
+
+	// Scan timeout aborts the running call and all remaining calls
+	op.CallTimeout, op.ScanTimeout = 0, 50*time.Millisecond
+	m, err = Account(&cfg, op)
+	require.NoError(t, err)
+	require.Len(t, m, 1)
+	lu = m[0].Calls["ListUsers"][0]
+	assert.Equal(t, "scan timed out", lu.Err.Message)
+	for _, c := range m[0].Calls["ListUserPolicies"] {
+		assert.Equal(t, "scan timed out before call was made", c.Err.Message)
+	}
+	assert.Empty(t, m[0].Calls["GetUserPolicy"])
+	assert.Equal(t, map[string]int{
+		"000000000000/aws-global/iam.ListUsers":        1,
+		"000000000000/aws-global/iam.ListUserPolicies": 2,
+	}, TimedOut(m))
+}
+
+func TestLimits(t *testing.T) {
+	reverse := false
+	cfg := awsmock.Config(func(r *aws.Request) {
+		switch in := r.Params.(type) {
+		case *sts.GetCallerIdentityInput:
+			out := r.Data.(*sts.GetCallerIdentityOutput)
+			out.Account = aws.String("000000000000")
+			out.Arn = aws.String("arn:aws:iam::000000000000:user/alice")
+		case *iam.ListUsersInput:
+			out := r.Data.(*iam.ListUsersOutput)
+			for i := 0; i < 5; i++ {
+				j := i
+				if reverse {
+					j = 4 - i
+				}
+				name := aws.String("user" + strconv.Itoa(j))
+				out.Users = append(out.Users, iam.User{UserName: name})
+			}
+		case *iam.ListUserPoliciesInput:
+			out := r.Data.(*iam.ListUserPoliciesOutput)
+			out.PolicyNames = []string{"policy-" + aws.StringValue(in.UserName)}
+		}
+	})
+
+	orig := svcRegistry
+	defer func() { svcRegistry = orig }()
+	svcRegistry = registry{}
+	svcRegistry.register("iam", iam.EndpointsID, iam.New, iamSvc{}, []interface{}{
+		[]iam.ListUsersInput{},
+	})
+	scan := func(op Opts) *Map {
+		op.Regions = []string{"aws-global"}
+		op.Services = []string{"iam"}
+		m, err := Account(&cfg, op)
+		require.NoError(t, err)
+		require.Len(t, m, 1)
+		return m[0]
+	}
+	users := func(m *Map) (v []string) {
+		for _, c := range m.Calls["ListUserPolicies"] {
+			v = append(v, *c.In.(*iam.ListUserPoliciesInput).UserName)
+		}
+		sort.Strings(v)
+		return
+	}
+
+	// Default limit
+	m := scan(Opts{MaxCalls: 2})
+	assert.Len(t, m.Calls["ListUsers"], 1)
+	assert.Equal(t, []string{"user0", "user1"}, users(m))
+	assert.Len(t, m.Calls["GetUserPolicy"], 2)
+	assert.Equal(t, map[string]int{"ListUserPolicies": 3}, m.Truncated)
+
+	// API limits
+	m = scan(Opts{MaxCalls: 2, Limits: map[string]int{
+		"iam.ListUserPolicies": 0,
+		"iam.*":                1,
+	}})
+	assert.Len(t, m.Calls["ListUserPolicies"], 5)
+	assert.Len(t, m.Calls["GetUserPolicy"], 1)
+	assert.Equal(t, map[string]int{"GetUserPolicy": 4}, m.Truncated)
+
+	// Item limits
+	m = scan(Opts{MaxItems: 2, ItemLimits: map[string]int{"iam.GetUserPolicy": 0}})
+	assert.Equal(t, []string{"user0", "user1"}, users(m))
+	assert.Len(t, m.Calls["GetUserPolicy"], 2)
+	assert.Equal(t, map[string]int{"ListUserPolicies": 3}, m.Truncated)
+	m = scan(Opts{MaxItems: 2, ItemLimits: map[string]int{"iam.ListUserPolicies": 0}})
+	assert.Len(t, m.Calls["ListUserPolicies"], 5)
+	assert.Nil(t, m.Truncated)
+
+	// Sampling is stable and does not depend on list order
+	m = scan(Opts{MaxCalls: 2, Sample: true})
+	sample := users(m)
+	assert.Len(t, sample, 2)
+	assert.NotEqual(t, []string{"user0", "user1"}, sample)
+	assert.Equal(t, map[string]int{"ListUserPolicies": 3}, m.Truncated)
+	assert.Equal(t, sample, users(scan(Opts{MaxCalls: 2, Sample: true})))
+	assert.Equal(t, sample, users(scan(Opts{MaxItems: 2, Sample: true})))
+	reverse = true
+	assert.Equal(t, sample, users(scan(Opts{MaxCalls: 2, Sample: true})))
+	assert.Equal(t, sample, users(scan(Opts{MaxItems: 2, Sample: true})))
+}
+
+func checkSpans(t *testing.T, spans *bytes.Buffer) {
+	byName := make(map[string][]*Span)
+	byID := make(map[string]*Span)
+	dec := json.NewDecoder(spans)
+	for dec.More() {
+		var sp Span
+		require.NoError(t, dec.Decode(&sp))
+		byName[sp.Name] = append(byName[sp.Name], &sp)
+		byID[sp.SpanID] = &sp
+	}
+	require.Len(t, byName["scan"], 1)
+	require.Len(t, byName["context"], 1)
+	require.Len(t, byName["iam.ListUsers"], 1)
+	require.Len(t, byName["iam.ListUserPolicies"], 3)
+	require.Len(t, byName["iam.GetUserPolicy"], 3)
+	assert.Len(t, byName["attempt"], 9)
+	scan, ctx := byName["scan"][0], byName["context"][0]
+	assert.Empty(t, scan.ParentID)
+	assert.Equal(t, scan.SpanID, ctx.ParentID)
+	assert.Equal(t, 7.0, scan.Attrs["scan.calls"])
+	assert.Equal(t, ctx.SpanID, byName["iam.ListUsers"][0].ParentID)
+	assert.Equal(t, 3.0, byName["iam.ListUsers"][0].Attrs["call.pages"])
+	for _, sp := range byName["iam.GetUserPolicy"] {
+		assert.Equal(t, scan.TraceID, sp.TraceID)
+		assert.Equal(t, "iam.ListUserPolicies", byID[sp.ParentID].Name)
+	}
+	for _, sp := range byName["attempt"] {
+		assert.True(t, sp.Start <= sp.End)
+		assert.Contains(t, byID[sp.ParentID].Name, "iam.")
+	}
+}
+
 func set(dst, src interface{}) {
 	// This wipes responseMetadata
 	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
@@ -19,6 +19,32 @@ func Register(id string, newFunc interface{}, iface svcIface, roots ...interface
 	return struct{}{}
 }
 
+// Limit restricts the calls made for the specified service in mode m to the
+// listed APIs and their dependencies. Services without any limits for m are not
+// scanned in that mode. It should only be called from package init functions.
+func Limit(m Mode, service string, apis ...string) struct{} {
+	svcRegistry.limit(m, service, apis)
+	return struct{}{}
+}
+
+// Only prevents calls to the listed APIs of the specified service unless all
+// bits of mode m are enabled. APIs that depend on them are also skipped, since
+// their inputs are not available. Unlike Limit, it does not affect other APIs.
+// It should only be called from package init functions.
+func Only(m Mode, service string, apis ...string) struct{} {
+	svcRegistry.only(m, service, apis)
+	return struct{}{}
+}
+
+// Volatile marks the listed APIs of the specified service as returning results
+// that change over time even if their inputs do not, such as last-used times.
+// Their calls are never copied from a previous scan (see Opts.Prev). It should
+// only be called from package init functions.
+func Volatile(service string, apis ...string) struct{} {
+	svcRegistry.volatile(service, apis)
+	return struct{}{}
+}
+
 // ServiceNames returns the names of all scannable services.
 func ServiceNames() []string {
 	all := make([]string, 0, len(svcRegistry.reg))
@@ -82,8 +108,12 @@ func API(service string) map[string][]string {
 
 // registry contains all registered services.
 type registry struct {
-	once sync.Once
-	reg  map[string]*svc
+	once   sync.Once
+	reg    map[string]*svc
+	apis   map[string]map[Mode][]string // Service API limits
+	limits Mode                         // Modes with API limits
+	modeOf map[string]map[Mode][]string // Service APIs that require a mode
+	vol    map[string][]string          // Service APIs with volatile results
 }
 
 // svcIface must be implemented by all services. The base implementation is
@@ -104,6 +134,7 @@ type svc struct {
 	api       map[string][]*link             // API name index
 	next      map[string][]string            // API call graph (key called before values)
 	postProc  map[reflect.Type]reflect.Value // Output post-processing methods
+	modes     Mode                           // Modes with API limits
 }
 
 // register adds a new scannable service to the registry.
@@ -122,6 +153,37 @@ func (r *registry) register(name, id string, newFunc interface{}, iface svcIface
 	}
 }
 
+// limit adds API limits for the named service in mode m.
+func (r *registry) limit(m Mode, name string, apis []string) {
+	if r.apis == nil {
+		r.apis = make(map[string]map[Mode][]string)
+	}
+	if r.apis[name] == nil {
+		r.apis[name] = make(map[Mode][]string)
+	}
+	r.apis[name][m] = append(r.apis[name][m], apis...)
+	r.limits |= m
+}
+
+// only restricts the listed APIs of the named service to mode m.
+func (r *registry) only(m Mode, name string, apis []string) {
+	if r.modeOf == nil {
+		r.modeOf = make(map[string]map[Mode][]string)
+	}
+	if r.modeOf[name] == nil {
+		r.modeOf[name] = make(map[Mode][]string)
+	}
+	r.modeOf[name][m] = append(r.modeOf[name][m], apis...)
+}
+
+// volatile marks the listed APIs of the named service as volatile.
+func (r *registry) volatile(name string, apis []string) {
+	if r.vol == nil {
+		r.vol = make(map[string][]string)
+	}
+	r.vol[name] = append(r.vol[name], apis...)
+}
+
 // get returns service registry after a one-time initialization.
 func (r *registry) get() map[string]*svc {
 	r.once.Do(func() {
@@ -135,6 +197,39 @@ func (r *registry) get() map[string]*svc {
 		for _, s := range r.reg {
 			s.init(ctxMethod)
 		}
+		for name, limits := range r.apis {
+			s := r.reg[name]
+			if s == nil {
+				panic("scan: limits for unregistered service: " + name)
+			}
+			for m, apis := range limits {
+				s.limit(m, apis)
+			}
+		}
+		for name, only := range r.modeOf {
+			s := r.reg[name]
+			if s == nil {
+				panic("scan: mode restrictions for unregistered service: " + name)
+			}
+			for m, apis := range only {
+				s.only(m, apis)
+			}
+		}
+		for name, apis := range r.vol {
+			s := r.reg[name]
+			if s == nil {
+				panic("scan: volatile APIs for unregistered service: " + name)
+			}
+			for _, api := range apis {
+				links := s.api[api]
+				if links == nil {
+					panic("scan: unknown volatile API: " + name + ":" + api)
+				}
+				for _, lnk := range links {
+					lnk.volatile = true
+				}
+			}
+		}
 	})
 	return r.reg
 }
@@ -150,6 +245,9 @@ type link struct {
 	input    reflect.Value // Service method to get input
 	req      reflect.Value // Client method to create request
 	postProc bool          // Is this link needed for post-processing?
+	modes    Mode          // Limited modes in which this link is needed
+	only     Mode          // Modes that must be enabled for this link to run
+	volatile bool          // Results change over time (see Volatile)
 }
 
 func (s *svc) init(ctxMethod map[string]bool) {
@@ -305,6 +403,36 @@ func (s *svc) init(ctxMethod map[string]bool) {
 	}
 }
 
+// limit allows links for the specified APIs and their dependencies to run in
+// mode m.
+func (s *svc) limit(m Mode, apis []string) {
+	s.modes |= m
+	for _, api := range apis {
+		links := s.api[api]
+		if links == nil {
+			panic("scan: limit for unknown API: " + s.name + ":" + api)
+		}
+		for _, lnk := range links {
+			lnk.modes |= m
+			limitDeps(s.api, lnk.deps, m)
+		}
+	}
+}
+
+// only prevents links for the specified APIs from running unless mode m is
+// enabled.
+func (s *svc) only(m Mode, apis []string) {
+	for _, api := range apis {
+		links := s.api[api]
+		if links == nil {
+			panic("scan: mode restriction for unknown API: " + s.name + ":" + api)
+		}
+		for _, lnk := range links {
+			lnk.only |= m
+		}
+	}
+}
+
 // apiName extracts service API name from []XyzInput type.
 func apiName(q reflect.Type) string {
 	if q.Kind() != reflect.Slice {
@@ -330,6 +458,16 @@ func getMethod(t reflect.Type, name string) reflect.Method {
 	panic("scan: method not found: " + t.String() + "." + name)
 }
 
+// limitDeps recursively adds mode m to all links of APIs in deps.
+func limitDeps(api map[string][]*link, deps []string, m Mode) {
+	for _, dep := range deps {
+		for _, lnk := range api[dep] {
+			lnk.modes |= m
+			limitDeps(api, lnk.deps, m)
+		}
+	}
+}
+
 // postProcDeps recursively sets postProc flag for all APIs in deps.
 func postProcDeps(api map[string][]*link, deps []string) {
 	for _, dep := range deps {
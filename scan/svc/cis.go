@@ -0,0 +1,48 @@
+package svc
+
+import "github.com/mxk/awsscan/scan"
+
+// API calls needed to evaluate CIS AWS Foundations Benchmark controls. Calls
+// that are not useful in other modes are only made in CIS mode, and the
+// credential report is only generated with CredReport.
+var _ = []struct{}{
+	scan.Limit(scan.CIS, "cloudtrail",
+		"GetEventSelectors",
+		"GetTrailStatus",
+	),
+	scan.Limit(scan.CIS, "cloudwatch",
+		"DescribeAlarms",
+	),
+	scan.Limit(scan.CIS, "cloudwatchlogs",
+		"DescribeMetricFilters",
+	),
+	scan.Limit(scan.CIS, "ec2",
+		"DescribeFlowLogs",
+		"DescribeSecurityGroups",
+		"DescribeVpcs",
+	),
+	scan.Limit(scan.CIS, "iam",
+		"GetAccountPasswordPolicy",
+		"GetCredentialReport",
+		"GetPolicyVersion",
+		"ListAttachedUserPolicies",
+		"ListUserPolicies",
+		"ListVirtualMFADevices",
+	),
+	scan.Only(scan.CIS, "iam",
+		"GetAccountSummary",
+		"ListVirtualMFADevices",
+	),
+	scan.Only(scan.CIS|scan.CredReport, "iam",
+		"GenerateCredentialReport",
+	),
+	scan.Limit(scan.CIS, "kms",
+		"DescribeKey",
+		"GetKeyRotationStatus",
+	),
+	scan.Limit(scan.CIS, "s3",
+		"GetBucketAcl",
+		"GetBucketLogging",
+		"GetBucketPolicy",
+	),
+}
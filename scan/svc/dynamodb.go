@@ -17,6 +17,13 @@ func (s dynamodbSvc) DescribeTable(lt *dynamodb.ListTablesOutput) (q []dynamodb.
 	return
 }
 
+func (s dynamodbSvc) ListTagsOfResource(dt *dynamodb.DescribeTableOutput) (q []dynamodb.ListTagsOfResourceInput) {
+	if dt.Table != nil && dt.Table.TableArn != nil {
+		q = []dynamodb.ListTagsOfResourceInput{{ResourceArn: dt.Table.TableArn}}
+	}
+	return
+}
+
 //
 // Post-processing
 //
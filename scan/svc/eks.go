@@ -0,0 +1,43 @@
+package svc
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-terraform/tfx"
+)
+
+// eksSvc scans EKS clusters. Node groups and Fargate profiles are not
+// supported by the EKS client in this SDK version.
+type eksSvc struct{ *scan.Ctx }
+
+var _ = scan.Register(eks.EndpointsID, eks.New, eksSvc{},
+	[]eks.ListClustersInput{},
+)
+
+var eksPaginator = aws.Paginator{
+	InputTokens:  []string{"NextToken"},
+	OutputTokens: []string{"NextToken"},
+	LimitToken:   "MaxResults",
+}
+
+func (eksSvc) UpdateRequest(req *aws.Request) {
+	if op := req.Operation; op.Name == "ListClusters" {
+		op.Paginator = &eksPaginator
+	}
+}
+
+func (s eksSvc) DescribeCluster(lc *eks.ListClustersOutput) (q []eks.DescribeClusterInput) {
+	s.Split(&q, "Name", lc.Clusters, "")
+	return
+}
+
+//
+// Post-processing
+//
+
+func (s eksSvc) Clusters(out *eks.ListClustersOutput) error {
+	return s.ImportResources("aws_eks_cluster", tfx.AttrGen{
+		"id": out.Clusters,
+	})
+}
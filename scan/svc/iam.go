@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/mxk/awsscan/scan"
 	"github.com/mxk/go-terraform/tfx"
@@ -12,7 +13,9 @@ import (
 type iamSvc struct{ *scan.Ctx }
 
 var _ = scan.Register(iam.EndpointsID, iam.New, iamSvc{},
+	[]iam.GenerateCredentialReportInput{},
 	[]iam.GetAccountPasswordPolicyInput{},
+	[]iam.GetAccountSummaryInput{},
 	[]iam.ListGroupsInput{},
 	[]iam.ListInstanceProfilesInput{},
 	[]iam.ListOpenIDConnectProvidersInput{},
@@ -20,17 +23,48 @@ var _ = scan.Register(iam.EndpointsID, iam.New, iamSvc{},
 	[]iam.ListRolesInput{},
 	[]iam.ListSAMLProvidersInput{},
 	[]iam.ListUsersInput{},
+	[]iam.ListVirtualMFADevicesInput{},
 )
 
+func (iamSvc) UpdateRequest(req *aws.Request) {
+	if req.Operation.Name == "GetCredentialReport" {
+		// Report generation takes a few seconds
+		req.Handlers.Retry.PushBack(func(r *aws.Request) {
+			if e, ok := r.Error.(awserr.Error); ok &&
+				e.Code() == iam.ErrCodeCredentialReportNotReadyException {
+				r.Retryable = aws.Bool(true)
+			}
+		})
+	}
+}
+
 func (iamSvc) HandleError(req *aws.Request, err *scan.Err) {
-	if err.Status == http.StatusNotFound {
-		switch req.Operation.Name {
-		case "GetAccountPasswordPolicy", "GetLoginProfile":
-			err.Ignore = true
-		}
+	switch req.Operation.Name {
+	case "GetAccountPasswordPolicy", "GetLoginProfile":
+		err.Ignore = err.Status == http.StatusNotFound
+	case "GetCredentialReport":
+		err.Ignore = err.Code == iam.ErrCodeCredentialReportNotPresentException ||
+			err.Code == iam.ErrCodeCredentialReportExpiredException
 	}
 }
 
+func (s iamSvc) GetAccessKeyLastUsed(lak *iam.ListAccessKeysOutput) (q []iam.GetAccessKeyLastUsedInput) {
+	s.Split(&q, "AccessKeyId", lak.AccessKeyMetadata, "AccessKeyId")
+	return
+}
+
+func (s iamSvc) GetCredentialReport(*iam.GetAccountSummaryOutput) (q []iam.GetCredentialReportInput) {
+	// Existing report is used unless a new one is generated
+	if !s.Mode(scan.CredReport) {
+		q = make([]iam.GetCredentialReportInput, 1)
+	}
+	return
+}
+
+func (s iamSvc) GetCredentialReportGenerated(*iam.GenerateCredentialReportOutput) (q []iam.GetCredentialReportInput) {
+	return make([]iam.GetCredentialReportInput, 1)
+}
+
 func (s iamSvc) GetLoginProfile(lu *iam.ListUsersOutput) (q []iam.GetLoginProfileInput) {
 	s.Split(&q, "UserName", lu.Users, "UserName")
 	return
@@ -110,11 +144,21 @@ func (s iamSvc) ListRolePolicies(lr *iam.ListRolesOutput) (q []iam.ListRolePolic
 	return
 }
 
+func (s iamSvc) ListRoleTags(lr *iam.ListRolesOutput) (q []iam.ListRoleTagsInput) {
+	s.Split(&q, "RoleName", lr.Roles, "RoleName")
+	return
+}
+
 func (s iamSvc) ListUserPolicies(lu *iam.ListUsersOutput) (q []iam.ListUserPoliciesInput) {
 	s.Split(&q, "UserName", lu.Users, "UserName")
 	return
 }
 
+func (s iamSvc) ListUserTags(lu *iam.ListUsersOutput) (q []iam.ListUserTagsInput) {
+	s.Split(&q, "UserName", lu.Users, "UserName")
+	return
+}
+
 //
 // Post-processing
 //
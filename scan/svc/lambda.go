@@ -34,3 +34,8 @@ func (s lambdaSvc) GetPolicyForFunction(lf *lambda.ListFunctionsOutput) (q []lam
 	s.Split(&q, "FunctionName", lf.Functions, "FunctionName")
 	return
 }
+
+func (s lambdaSvc) ListTags(lf *lambda.ListFunctionsOutput) (q []lambda.ListTagsInput) {
+	s.Split(&q, "Resource", lf.Functions, "FunctionArn")
+	return
+}
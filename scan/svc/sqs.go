@@ -19,3 +19,8 @@ func (s sqsSvc) GetQueueAttributes(lq *sqs.ListQueuesOutput) (q []sqs.GetQueueAt
 	}
 	return
 }
+
+func (s sqsSvc) ListQueueTags(lq *sqs.ListQueuesOutput) (q []sqs.ListQueueTagsInput) {
+	s.Split(&q, "QueueUrl", lq.QueueUrls, "")
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"unsafe"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
 	"github.com/mxk/awsscan/scan"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,7 +39,7 @@ func TestSvc(t *testing.T) {
 
 	// Call each method of each service in each scan mode. All methods must
 	// return at least one Input struct in at least one mode.
-	modes := []scan.Mode{0, scan.CloudAssert}
+	modes := []scan.Mode{0, scan.CloudAssert, scan.CIS, scan.CIS | scan.CredReport}
 	ctx := reflect.TypeOf((*scan.Ctx)(nil))
 	ctxMethod := make(map[string]bool)
 	for i := ctx.NumMethod() - 1; i >= 0; i-- {
@@ -163,3 +164,12 @@ func apiName(t reflect.Type) string {
 	}
 	panic("not an input or output type: " + t.String())
 }
+
+func TestEKS(t *testing.T) {
+	// Node groups and Fargate profiles require a newer SDK
+	assert.Equal(t, map[string][]string{
+		"ListClusters":    nil,
+		"DescribeCluster": {"ListClusters"},
+	}, scan.API("eks"))
+	assert.Equal(t, []interface{}{[]eks.ListClustersInput{}}, scan.ServiceInfo("eks").Roots)
+}
@@ -0,0 +1,11 @@
+package svc
+
+import "github.com/mxk/awsscan/scan"
+
+// APIs whose results change over time without any changes to their inputs.
+// Incremental scans always repeat these calls.
+var _ = []struct{}{
+	scan.Volatile("cloudtrail", "GetTrailStatus"),
+	scan.Volatile("elbv2", "DescribeTargetHealth"),
+	scan.Volatile("iam", "GetAccessKeyLastUsed", "GetCredentialReport"),
+}
@@ -94,6 +94,45 @@ func TestSvc(t *testing.T) {
 	}
 }
 
+func TestLimit(t *testing.T) {
+	var r registry
+	r.register("diamond", "diamond", newNilClient, diamond{}, nil)
+	r.limit(CIS, "diamond", []string{"Bx"})
+	s := r.get()["diamond"]
+	assert.Equal(t, CIS, r.limits)
+	assert.Equal(t, CIS, s.modes)
+	modes := make(map[string]Mode)
+	for api, links := range s.api {
+		modes[api] = links[0].modes
+	}
+	assert.Equal(t, map[string]Mode{"Ax": CIS, "Bx": CIS, "Cx": 0, "Dx": 0}, modes)
+	assert.PanicsWithValue(t, "scan: limits for unregistered service: none", func() {
+		var r registry
+		r.limit(CIS, "none", nil)
+		r.get()
+	})
+}
+
+func TestOnly(t *testing.T) {
+	var r registry
+	r.register("diamond", "diamond", newNilClient, diamond{}, nil)
+	r.only(CIS, "diamond", []string{"Bx"})
+	r.only(CIS|KeepStats, "diamond", []string{"Bx", "Cx"})
+	s := r.get()["diamond"]
+	assert.Equal(t, Mode(0), r.limits)
+	only := make(map[string]Mode)
+	for api, links := range s.api {
+		only[api] = links[0].only
+	}
+	assert.Equal(t, map[string]Mode{"Ax": 0, "Bx": CIS | KeepStats, "Cx": CIS | KeepStats, "Dx": 0}, only)
+	assert.PanicsWithValue(t, "scan: mode restriction for unknown API: diamond:Ex", func() {
+		var r registry
+		r.register("diamond", "diamond", newNilClient, diamond{}, nil)
+		r.only(CIS, "diamond", []string{"Ex"})
+		r.get()
+	})
+}
+
 type depErr struct{ *Ctx }
 
 func (depErr) B(*AxOutput) []BxInput { return nil }
@@ -0,0 +1,142 @@
+package tfgen
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/terraform-providers/terraform-provider-aws/aws"
+)
+
+// schemas contains resource schemas indexed by resource type.
+var schemas struct {
+	once sync.Once
+	m    map[string]*schema.Resource
+}
+
+// resourceSchema returns the schema for the specified resource type or nil if
+// the type is not supported.
+func resourceSchema(typ string) *schema.Resource {
+	schemas.once.Do(func() {
+		schemas.m = aws.Provider().(*schema.Provider).ResourcesMap
+	})
+	return schemas.m[typ]
+}
+
+// object is a decoded resource or nested block.
+type object map[string]interface{}
+
+// decodeObject converts flatmap attributes with the given key prefix into an
+// object using schema s. Attributes that are not set are omitted.
+func decodeObject(s map[string]*schema.Schema, attrs map[string]string, prefix string) object {
+	obj := make(object, len(s))
+	for name, sch := range s {
+		if v := decodeValue(sch, attrs, prefix+name); v != nil {
+			obj[name] = v
+		}
+	}
+	return obj
+}
+
+// decodeValue converts the flatmap attribute k into a value of schema type s.
+// It returns nil if the attribute is not set.
+func decodeValue(s *schema.Schema, attrs map[string]string, k string) interface{} {
+	switch s.Type {
+	case schema.TypeList, schema.TypeSet:
+		if _, ok := attrs[k+".#"]; !ok {
+			return nil
+		}
+		idx := indexKeys(attrs, k)
+		vs := make([]interface{}, 0, len(idx))
+		for _, i := range idx {
+			var v interface{}
+			switch e := s.Elem.(type) {
+			case *schema.Resource:
+				v = decodeObject(e.Schema, attrs, k+"."+i+".")
+			case *schema.Schema:
+				v = decodeValue(e, attrs, k+"."+i)
+			default:
+				v = attrs[k+"."+i]
+			}
+			if v != nil {
+				vs = append(vs, v)
+			}
+		}
+		return vs
+	case schema.TypeMap:
+		if _, ok := attrs[k+".%"]; !ok {
+			return nil
+		}
+		elem, _ := s.Elem.(*schema.Schema)
+		prefix := k + "."
+		m := make(map[string]interface{})
+		for ak, av := range attrs {
+			if strings.HasPrefix(ak, prefix) && ak != k+".%" {
+				if elem != nil {
+					m[ak[len(prefix):]] = primitive(elem.Type, av)
+				} else {
+					m[ak[len(prefix):]] = av
+				}
+			}
+		}
+		return m
+	}
+	if v, ok := attrs[k]; ok {
+		return primitive(s.Type, v)
+	}
+	return nil
+}
+
+// primitive converts flatmap string v into a value of type t. Values that
+// cannot be converted are returned as strings.
+func primitive(t schema.ValueType, v string) interface{} {
+	switch t {
+	case schema.TypeBool:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	case schema.TypeInt:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	case schema.TypeFloat:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// indexKeys returns sorted list or set indices for the flatmap attribute k.
+// Set indices are element hash codes rather than sequential integers.
+func indexKeys(attrs map[string]string, k string) []string {
+	prefix := k + "."
+	set := make(map[string]struct{})
+	for ak := range attrs {
+		if !strings.HasPrefix(ak, prefix) {
+			continue
+		}
+		i := ak[len(prefix):]
+		if j := strings.IndexByte(i, '.'); j >= 0 {
+			i = i[:j]
+		}
+		if i != "#" {
+			set[i] = struct{}{}
+		}
+	}
+	idx := make([]string, 0, len(set))
+	for i := range set {
+		idx = append(idx, i)
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		a, errA := strconv.Atoi(idx[i])
+		b, errB := strconv.Atoi(idx[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return idx[i] < idx[j]
+	})
+	return idx
+}
@@ -0,0 +1,298 @@
+// Package tfgen generates Terraform configuration from scanned resources.
+package tfgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/awsscan/scan"
+)
+
+// ProvidersFile is the name of the file containing provider configuration.
+const ProvidersFile = "providers.tf"
+
+// defaultRegions contains provider regions for global resources.
+var defaultRegions = map[string]string{
+	"aws":        "us-east-1",
+	"aws-cn":     "cn-north-1",
+	"aws-us-gov": "us-gov-west-1",
+}
+
+// Config generates Terraform configuration for all resources in s. Maps are
+// used to determine the service that created each resource type. Resources are
+// grouped into one file per service and region. The returned map contains file
+// contents indexed by file name.
+func Config(maps []*scan.Map, s *tf.State) (map[string][]byte, error) {
+	svcs := make(map[string]string)
+	partition := "aws"
+	for _, m := range maps {
+		partition = m.Partition
+		for _, r := range m.Resources {
+			svcs[r.Type] = m.Service
+		}
+	}
+	rs := s.RootModule().Resources
+	keys := make([]string, 0, len(rs))
+	for k := range rs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	files := make(map[string]*bytes.Buffer)
+	aliases := make(map[string]bool)
+	for _, k := range keys {
+		r := rs[k]
+		if r.Primary == nil {
+			continue
+		}
+		name := k[strings.IndexByte(k, '.')+1:]
+		_, alias := splitProvider(r.Provider)
+		svc := svcs[r.Type]
+		if svc == "" {
+			svc = "other"
+		}
+		file := svc + "-global.tf"
+		if alias != "" {
+			file = svc + "-" + alias + ".tf"
+			aliases[alias] = true
+		}
+		b := files[file]
+		if b == nil {
+			b = new(bytes.Buffer)
+			files[file] = b
+		} else {
+			b.WriteByte('\n')
+		}
+		if err := writeResource(b, rs, r, name, alias); err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+	}
+	out := make(map[string][]byte, len(files)+1)
+	for name, b := range files {
+		out[name] = b.Bytes()
+	}
+	out[ProvidersFile] = providers(partition, aliases)
+	return out, nil
+}
+
+// splitProvider returns provider name and alias from a resource provider
+// string, such as "provider.aws.us-east-1".
+func splitProvider(p string) (name, alias string) {
+	p = strings.TrimPrefix(p, "provider.")
+	if i := strings.IndexByte(p, '.'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+// providers generates provider configuration for all aliases.
+func providers(partition string, aliases map[string]bool) []byte {
+	var b bytes.Buffer
+	b.WriteString("provider \"aws\" {\n")
+	fmt.Fprintf(&b, "  region = %s\n", quote(defaultRegions[partition]))
+	b.WriteString("}\n")
+	all := make([]string, 0, len(aliases))
+	for a := range aliases {
+		all = append(all, a)
+	}
+	sort.Strings(all)
+	for _, a := range all {
+		b.WriteString("\nprovider \"aws\" {\n")
+		fmt.Fprintf(&b, "  alias  = %s\n", quote(a))
+		fmt.Fprintf(&b, "  region = %s\n", quote(a))
+		b.WriteString("}\n")
+	}
+	return b.Bytes()
+}
+
+// writeResource writes resource block for r to b. Literal values matching the
+// IDs or ARNs of resource dependencies are replaced with references.
+func writeResource(b *bytes.Buffer, rs map[string]*tf.ResourceState, r *tf.ResourceState, name, alias string) error {
+	s := resourceSchema(r.Type)
+	if s == nil {
+		return fmt.Errorf("unsupported resource type %q", r.Type)
+	}
+	w := hclWriter{b, make(map[string]string)}
+	for _, dep := range r.Dependencies {
+		if d := rs[dep]; d != nil && d.Primary != nil && d != r {
+			w.refs[d.Primary.ID] = "${" + dep + ".id}"
+			if arn := d.Primary.Attributes["arn"]; arn != "" {
+				w.refs[arn] = "${" + dep + ".arn}"
+			}
+		}
+	}
+	fmt.Fprintf(b, "resource %s %s {\n", quote(r.Type), quote(name))
+	if alias != "" {
+		fmt.Fprintf(b, "  provider = %s\n\n", quote("aws."+alias))
+	}
+	attrs := r.Primary.Attributes
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	w.object(s.Schema, decodeObject(s.Schema, attrs, ""), 1)
+	b.WriteString("}\n")
+	return nil
+}
+
+// hclWriter encodes objects in HCL format.
+type hclWriter struct {
+	*bytes.Buffer
+	refs map[string]string // Literal string replacements
+}
+
+// object writes all configurable attributes of obj, followed by nested blocks.
+func (w hclWriter) object(s map[string]*schema.Schema, obj object, depth int) {
+	var attrs, blocks []string
+	width := 0
+	for name, v := range obj {
+		sch := s[name]
+		if (depth == 1 && name == "id") || !configurable(sch) || isEmpty(sch, v) {
+			continue
+		}
+		if isBlock(sch) {
+			blocks = append(blocks, name)
+			continue
+		}
+		if attrs = append(attrs, name); len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(attrs)
+	sort.Strings(blocks)
+	indent := strings.Repeat("  ", depth)
+	for _, name := range attrs {
+		fmt.Fprintf(w, "%s%-*s = ", indent, width, name)
+		w.value(obj[name], depth)
+		w.WriteByte('\n')
+	}
+	for _, name := range blocks {
+		elem := s[name].Elem.(*schema.Resource)
+		for _, v := range obj[name].([]interface{}) {
+			if obj, ok := v.(object); ok {
+				fmt.Fprintf(w, "\n%s%s {\n", indent, name)
+				w.object(elem.Schema, obj, depth+1)
+				fmt.Fprintf(w, "%s}\n", indent)
+			}
+		}
+	}
+}
+
+// value writes attribute value v.
+func (w hclWriter) value(v interface{}, depth int) {
+	switch v := v.(type) {
+	case string:
+		if ref, ok := w.refs[v]; ok {
+			w.WriteByte('"')
+			w.WriteString(ref)
+			w.WriteByte('"')
+		} else {
+			w.WriteString(quote(v))
+		}
+	case bool:
+		w.WriteString(strconv.FormatBool(v))
+	case int64:
+		w.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		w.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case []interface{}:
+		w.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.value(e, depth)
+		}
+		w.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		width := 0
+		for k := range v {
+			if keys = append(keys, k); len(quoteKey(k)) > width {
+				width = len(quoteKey(k))
+			}
+		}
+		sort.Strings(keys)
+		indent := strings.Repeat("  ", depth)
+		w.WriteString("{\n")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s  %-*s = ", indent, width, quoteKey(k))
+			w.value(v[k], depth+1)
+			w.WriteByte('\n')
+		}
+		w.WriteString(indent)
+		w.WriteByte('}')
+	default:
+		w.WriteString(quote(fmt.Sprint(v)))
+	}
+}
+
+// isBlock returns true if the attribute described by s is a nested block.
+func isBlock(s *schema.Schema) bool {
+	_, ok := s.Elem.(*schema.Resource)
+	return ok && (s.Type == schema.TypeList || s.Type == schema.TypeSet)
+}
+
+// configurable returns true if the attribute described by s can be set in
+// resource configuration.
+func configurable(s *schema.Schema) bool {
+	return s != nil && (s.Optional || s.Required) &&
+		s.Deprecated == "" && s.Removed == ""
+}
+
+// isEmpty returns true if v is an empty value that does not need to be written
+// for an attribute described by s.
+func isEmpty(s *schema.Schema, v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == "" && !s.Required
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// quote returns s as an HCL string literal with interpolation sequences
+// escaped.
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$':
+			if i+1 < len(s) && s[i+1] == '{' {
+				b.WriteByte('$')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteKey returns map key k, quoted if it is not a valid identifier.
+func quoteKey(k string) string {
+	if k != "" && scan.Ident(k) == k {
+		return k
+	}
+	return quote(k)
+}
@@ -0,0 +1,98 @@
+package tfgen
+
+import (
+	"testing"
+
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	vpc := &tf.ResourceState{
+		Type:     "aws_vpc",
+		Provider: "provider.aws.us-east-1",
+		Primary: &tf.InstanceState{
+			ID: "vpc-1",
+			Attributes: map[string]string{
+				"id":                 "vpc-1",
+				"arn":                "arn:aws:ec2:us-east-1:123456789012:vpc/vpc-1",
+				"cidr_block":         "10.0.0.0/16",
+				"enable_dns_support": "true",
+				"instance_tenancy":   "default",
+				"tags.%":             "1",
+				"tags.Name":          "main ${x}",
+			},
+		},
+	}
+	subnet := &tf.ResourceState{
+		Type:         "aws_subnet",
+		Provider:     "provider.aws.us-east-1",
+		Dependencies: []string{"aws_vpc.us-east-1_vpc-1"},
+		Primary: &tf.InstanceState{
+			ID: "subnet-1",
+			Attributes: map[string]string{
+				"id":                      "subnet-1",
+				"cidr_block":              "10.0.1.0/24",
+				"map_public_ip_on_launch": "false",
+				"tags.%":                  "0",
+				"vpc_id":                  "vpc-1",
+			},
+		},
+	}
+	maps := []*scan.Map{{
+		Ctx:     arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"},
+		Service: "ec2",
+		Resources: map[string]*tf.ResourceState{
+			"aws_vpc.us-east-1_vpc-1":       vpc,
+			"aws_subnet.us-east-1_subnet-1": subnet,
+		},
+	}}
+	s, err := scan.NewTFState(maps)
+	require.NoError(t, err)
+	files, err := Config(maps, s)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		ProvidersFile: `provider "aws" {
+  region = "us-east-1"
+}
+
+provider "aws" {
+  alias  = "us-east-1"
+  region = "us-east-1"
+}
+`,
+		"ec2-us-east-1.tf": `resource "aws_subnet" "us-east-1_subnet-1" {
+  provider = "aws.us-east-1"
+
+  cidr_block              = "10.0.1.0/24"
+  map_public_ip_on_launch = false
+  vpc_id                  = "${aws_vpc.us-east-1_vpc-1.id}"
+}
+
+resource "aws_vpc" "us-east-1_vpc-1" {
+  provider = "aws.us-east-1"
+
+  cidr_block         = "10.0.0.0/16"
+  enable_dns_support = true
+  instance_tenancy   = "default"
+  tags               = {
+    Name = "main $${x}"
+  }
+}
+`,
+	}
+	have := make(map[string]string, len(files))
+	for name, b := range files {
+		have[name] = string(b)
+	}
+	assert.Equal(t, want, have)
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c\n\t"`, quote("a\"b\\c\n\t"))
+	assert.Equal(t, `"$${x} $ {y} $"`, quote("${x} $ {y} $"))
+}
@@ -0,0 +1,63 @@
+package tfgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	tf "github.com/hashicorp/terraform/terraform"
+)
+
+// Supported import formats.
+const (
+	ImportScript = "sh" // Shell script of "terraform import" commands
+	ImportBlocks = "tf" // Terraform 1.5+ import blocks
+)
+
+// Imports generates commands or configuration blocks for importing all
+// resources in s into another Terraform state. Resource addresses are the
+// state keys, so scan.Naming should be applied first to ensure that all
+// addresses are valid.
+func Imports(s *tf.State, format string) ([]byte, error) {
+	var b bytes.Buffer
+	switch format {
+	case ImportScript:
+		b.WriteString("#!/bin/sh\nset -e\n")
+	case ImportBlocks:
+	default:
+		return nil, fmt.Errorf("invalid import format %q", format)
+	}
+	rs := s.RootModule().Resources
+	keys := make([]string, 0, len(rs))
+	for k, r := range rs {
+		if r.Primary != nil && r.Primary.ID != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		r := rs[k]
+		if format == ImportScript {
+			fmt.Fprintf(&b, "terraform import %s %s\n",
+				shellQuote(k), shellQuote(r.Primary.ID))
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("import {\n")
+		fmt.Fprintf(&b, "  to = %s\n", k)
+		fmt.Fprintf(&b, "  id = %s\n", quote(r.Primary.ID))
+		if name, alias := splitProvider(r.Provider); alias != "" {
+			fmt.Fprintf(&b, "\n  provider = %s.%s\n", name, alias)
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes(), nil
+}
+
+// shellQuote returns s as a single-quoted shell string.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,55 @@
+package tfgen
+
+import (
+	"testing"
+
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/go-terraform/tfx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImports(t *testing.T) {
+	s := tfx.NewState()
+	rs := s.RootModule().Resources
+	rs["aws_iam_user.aws-global_bob"] = &tf.ResourceState{
+		Type:     "aws_iam_user",
+		Provider: "provider.aws",
+		Primary:  &tf.InstanceState{ID: "bob's"},
+	}
+	rs["aws_vpc.us-east-1_vpc-1"] = &tf.ResourceState{
+		Type:     "aws_vpc",
+		Provider: "provider.aws.us-east-1",
+		Primary:  &tf.InstanceState{ID: "vpc-1"},
+	}
+	rs["aws_vpc.us-east-1_vpc-2"] = &tf.ResourceState{
+		Type:     "aws_vpc",
+		Provider: "provider.aws.us-east-1",
+	}
+
+	b, err := Imports(s, ImportScript)
+	require.NoError(t, err)
+	assert.Equal(t, `#!/bin/sh
+set -e
+terraform import 'aws_iam_user.aws-global_bob' 'bob'\''s'
+terraform import 'aws_vpc.us-east-1_vpc-1' 'vpc-1'
+`, string(b))
+
+	b, err = Imports(s, ImportBlocks)
+	require.NoError(t, err)
+	assert.Equal(t, `import {
+  to = aws_iam_user.aws-global_bob
+  id = "bob's"
+}
+
+import {
+  to = aws_vpc.us-east-1_vpc-1
+  id = "vpc-1"
+
+  provider = aws.us-east-1
+}
+`, string(b))
+
+	_, err = Imports(s, "json")
+	assert.Error(t, err)
+}
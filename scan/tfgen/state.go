@@ -0,0 +1,131 @@
+package tfgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	tf "github.com/hashicorp/terraform/terraform"
+)
+
+// StateV4Version is the Terraform version recorded in format version 4 state.
+const StateV4Version = "1.0.0"
+
+// stateV4 is Terraform state format version 4 used by Terraform 0.12+.
+type stateV4 struct {
+	Version          int                    `json:"version"`
+	TerraformVersion string                 `json:"terraform_version"`
+	Serial           int64                  `json:"serial"`
+	Lineage          string                 `json:"lineage"`
+	Outputs          map[string]interface{} `json:"outputs"`
+	Resources        []*resourceV4          `json:"resources"`
+}
+
+// resourceV4 is one resource in format version 4 state.
+type resourceV4 struct {
+	Mode      string        `json:"mode"`
+	Type      string        `json:"type"`
+	Name      string        `json:"name"`
+	Provider  string        `json:"provider"`
+	Instances []*instanceV4 `json:"instances"`
+}
+
+// instanceV4 is one resource instance in format version 4 state.
+type instanceV4 struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Attributes    map[string]interface{} `json:"attributes"`
+	Private       []byte                 `json:"private,omitempty"`
+	Dependencies  []string               `json:"dependencies,omitempty"`
+}
+
+// StateV4 converts s into Terraform state format version 4. Flatmap attributes
+// are decoded using provider resource schemas, with unset attributes encoded as
+// null. Resource names are the state keys, so scan.Naming should be applied
+// first to ensure that all names are valid.
+func StateV4(s *tf.State) ([]byte, error) {
+	v4 := &stateV4{
+		Version:          4,
+		TerraformVersion: StateV4Version,
+		Serial:           s.Serial,
+		Lineage:          s.Lineage,
+		Outputs:          map[string]interface{}{},
+		Resources:        []*resourceV4{},
+	}
+	rs := s.RootModule().Resources
+	keys := make([]string, 0, len(rs))
+	for k := range rs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r := rs[k]
+		if r.Primary == nil {
+			continue
+		}
+		sch := resourceSchema(r.Type)
+		if sch == nil {
+			return nil, fmt.Errorf("%s: unsupported resource type %q", k, r.Type)
+		}
+		attrs := r.Primary.Attributes
+		if attrs == nil {
+			attrs = map[string]string{}
+		}
+		obj := fillObject(sch.Schema, decodeObject(sch.Schema, attrs, ""))
+		obj["id"] = r.Primary.ID
+		inst := &instanceV4{
+			SchemaVersion: sch.SchemaVersion,
+			Attributes:    obj,
+			Dependencies:  r.Dependencies,
+		}
+		if len(r.Primary.Meta) > 0 {
+			b, err := json.Marshal(r.Primary.Meta)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			inst.Private = b
+		}
+		name, alias := splitProvider(r.Provider)
+		p := fmt.Sprintf("provider[%q]", "registry.terraform.io/hashicorp/"+name)
+		if alias != "" {
+			p += "." + alias
+		}
+		v4.Resources = append(v4.Resources, &resourceV4{
+			Mode:      "managed",
+			Type:      r.Type,
+			Name:      k[len(r.Type)+1:],
+			Provider:  p,
+			Instances: []*instanceV4{inst},
+		})
+	}
+	b, err := json.MarshalIndent(v4, "", "  ")
+	if err == nil {
+		b = append(b, '\n')
+	}
+	return b, err
+}
+
+// fillObject returns a copy of obj with null values for all unset attributes
+// in schema s, including the attributes of nested blocks.
+func fillObject(s map[string]*schema.Schema, obj object) map[string]interface{} {
+	out := make(map[string]interface{}, len(s))
+	for name, sch := range s {
+		if sch.Removed != "" {
+			continue
+		}
+		v := obj[name]
+		if elem, ok := sch.Elem.(*schema.Resource); ok && isBlock(sch) {
+			if vs, ok := v.([]interface{}); ok {
+				blocks := make([]interface{}, len(vs))
+				for i, b := range vs {
+					blocks[i] = fillObject(elem.Schema, b.(object))
+				}
+				v = blocks
+			} else {
+				v = []interface{}{}
+			}
+		}
+		out[name] = v
+	}
+	return out
+}
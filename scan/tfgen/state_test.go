@@ -0,0 +1,72 @@
+package tfgen
+
+import (
+	"encoding/json"
+	"testing"
+
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/go-terraform/tfx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateV4(t *testing.T) {
+	s := tfx.NewState()
+	s.Serial = 3
+	s.RootModule().Resources["aws_vpc.us-east-1_vpc-1"] = &tf.ResourceState{
+		Type:         "aws_vpc",
+		Provider:     "provider.aws.us-east-1",
+		Dependencies: []string{"aws_vpc_dhcp_options.us-east-1_dopt-1"},
+		Primary: &tf.InstanceState{
+			ID: "vpc-1",
+			Attributes: map[string]string{
+				"id":                 "vpc-1",
+				"cidr_block":         "10.0.0.0/16",
+				"enable_dns_support": "true",
+				"tags.%":             "1",
+				"tags.Name":          "main",
+			},
+			Meta: map[string]interface{}{"schema_version": "1"},
+		},
+	}
+	b, err := StateV4(s)
+	require.NoError(t, err)
+
+	var v4 struct {
+		Version          int
+		TerraformVersion string `json:"terraform_version"`
+		Serial           int64
+		Lineage          string
+		Resources        []struct {
+			Mode, Type, Name, Provider string
+			Instances                  []struct {
+				Attributes   map[string]interface{}
+				Private      []byte
+				Dependencies []string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(b, &v4))
+	assert.Equal(t, 4, v4.Version)
+	assert.Equal(t, StateV4Version, v4.TerraformVersion)
+	assert.Equal(t, int64(3), v4.Serial)
+	assert.Equal(t, s.Lineage, v4.Lineage)
+	require.Len(t, v4.Resources, 1)
+
+	r := v4.Resources[0]
+	assert.Equal(t, "managed", r.Mode)
+	assert.Equal(t, "aws_vpc", r.Type)
+	assert.Equal(t, "us-east-1_vpc-1", r.Name)
+	assert.Equal(t, `provider["registry.terraform.io/hashicorp/aws"].us-east-1`, r.Provider)
+	require.Len(t, r.Instances, 1)
+
+	inst := r.Instances[0]
+	assert.Equal(t, "vpc-1", inst.Attributes["id"])
+	assert.Equal(t, "10.0.0.0/16", inst.Attributes["cidr_block"])
+	assert.Equal(t, true, inst.Attributes["enable_dns_support"])
+	assert.Equal(t, map[string]interface{}{"Name": "main"}, inst.Attributes["tags"])
+	assert.Contains(t, inst.Attributes, "instance_tenancy")
+	assert.Nil(t, inst.Attributes["instance_tenancy"])
+	assert.JSONEq(t, `{"schema_version":"1"}`, string(inst.Private))
+	assert.Equal(t, []string{"aws_vpc_dhcp_options.us-east-1_dopt-1"}, inst.Dependencies)
+}
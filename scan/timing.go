@@ -0,0 +1,394 @@
+package scan
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// timingTop is the number of entries in top-N timing report lists.
+const timingTop = 10
+
+// timingSlots is the number of worker utilization timeline slots.
+const timingSlots = 20
+
+// TimingReport is an analysis of call timing in a scan made with KeepStats
+// mode. All times are in seconds relative to the start of the first call.
+type TimingReport struct {
+	Duration     float64           `json:"duration"`     // Scan wall time
+	Calls        int               `json:"calls"`        // Number of calls
+	Workers      int               `json:"workers"`      // Worker count used
+	PeakWorkers  int               `json:"peakWorkers"`  // Max concurrent calls
+	Utilization  float64           `json:"utilization"`  // Average busy fraction
+	ExecTime     float64           `json:"execTime"`     // Sum of call exec times
+	QueueTime    float64           `json:"queueTime"`    // Sum of call queue times
+	CriticalTime float64           `json:"criticalTime"` // Critical path length
+	CriticalPath []*CallTiming     `json:"criticalPath"`
+	Services     []*ServiceTiming  `json:"services"`
+	Timeline     []*TimelineSlot   `json:"timeline"`
+	Slowest      []*CallTiming     `json:"slowest"`
+	Paginated    []*APIPagination  `json:"paginated"`
+	Suggestion   *WorkerSuggestion `json:"suggestion"`
+}
+
+// CallTiming describes the timing of one call.
+type CallTiming struct {
+	Account string  `json:"account"`
+	Region  string  `json:"region"`
+	Service string  `json:"service"`
+	API     string  `json:"api"`
+	ID      string  `json:"id"`
+	Start   float64 `json:"start"` // Execution start time
+	Wait    float64 `json:"wait"`  // Time since dependencies were satisfied
+	Queue   float64 `json:"queue"` // Time spent waiting for a worker
+	Exec    float64 `json:"exec"`  // Execution time
+	Pages   int     `json:"pages"` // Number of outputs
+}
+
+// ServiceTiming describes the timing of all calls to one service.
+type ServiceTiming struct {
+	Service  string  `json:"service"`
+	Contexts int     `json:"contexts"` // Number of regions/accounts
+	Calls    int     `json:"calls"`
+	Wall     float64 `json:"wall"` // First call start to last call end
+	Exec     float64 `json:"exec"` // Sum of call exec times
+}
+
+// TimelineSlot is the average worker utilization during one time slot.
+type TimelineSlot struct {
+	Start       float64 `json:"start"`
+	Busy        float64 `json:"busy"`        // Average number of busy workers
+	Utilization float64 `json:"utilization"` // Busy fraction of all workers
+}
+
+// APIPagination describes the pagination of one service API.
+type APIPagination struct {
+	Service  string `json:"service"`
+	API      string `json:"api"`
+	Calls    int    `json:"calls"`
+	Pages    int    `json:"pages"`
+	MaxPages int    `json:"maxPages"`
+}
+
+// WorkerSuggestion is the suggested worker count for similar scans.
+type WorkerSuggestion struct {
+	Workers int    `json:"workers"`
+	Reason  string `json:"reason"`
+}
+
+// callTiming contains timing information for one call during analysis.
+type callTiming struct {
+	*CallTiming
+	m     *Map
+	call  *Call
+	end   float64
+	ready float64  // Time when dependencies were satisfied
+	deps  []string // Dependency APIs
+	pred  *callTiming
+	done  bool // Critical path predecessor found
+}
+
+// Timing analyzes call timing in maps, which must have been created with
+// KeepStats mode. Workers is the number of workers used for the scan. It
+// returns nil if there is no timing information.
+func Timing(maps []*Map, workers int) *TimingReport {
+	if workers < 1 {
+		workers = 64
+	}
+	// Collect calls and find the scan start time
+	var all []*callTiming
+	var t0 time.Time
+	byAPI := make(map[*Map]map[string][]*callTiming)
+	byID := make(map[string]*callTiming)
+	Walk(maps, func(m *Map, api string, c *Call) error {
+		if c.Stats == nil || c.Stats.start.IsZero() {
+			return nil
+		}
+		ct := &callTiming{
+			CallTiming: &CallTiming{
+				Account: m.Account,
+				Region:  m.Region,
+				Service: m.Service,
+				API:     api,
+				ID:      c.ID,
+				Queue:   c.Stats.QueueTime,
+				Exec:    c.Stats.ExecTime,
+				Pages:   len(c.Out),
+			},
+			m:    m,
+			call: c,
+		}
+		if t0.IsZero() || c.Stats.start.Before(t0) {
+			t0 = c.Stats.start
+		}
+		if byAPI[m] == nil {
+			byAPI[m] = make(map[string][]*callTiming)
+		}
+		byAPI[m][api] = append(byAPI[m][api], ct)
+		byID[c.ID] = ct
+		all = append(all, ct)
+		return nil
+	})
+	if len(all) == 0 {
+		return nil
+	}
+	r := &TimingReport{Calls: len(all), Workers: workers}
+	for _, ct := range all {
+		ct.Start = ct.call.Stats.start.Sub(t0).Seconds()
+		ct.end = ct.Start + ct.Exec
+		if ct.end > r.Duration {
+			r.Duration = ct.end
+		}
+		r.ExecTime += ct.Exec
+		r.QueueTime += ct.Queue
+		seen := make(map[string]bool)
+		for id := range ct.call.Src {
+			if src := byID[id]; src != nil && !seen[src.API] {
+				seen[src.API] = true
+				ct.deps = append(ct.deps, src.API)
+			}
+		}
+		sort.Strings(ct.deps)
+	}
+	r.CriticalPath, r.CriticalTime = criticalPath(all, byAPI)
+	r.Services = serviceTiming(all)
+	r.PeakWorkers, r.Timeline = timeline(all, r.Duration, workers)
+	if r.Duration > 0 {
+		r.Utilization = r.ExecTime / (r.Duration * float64(workers))
+	}
+	r.Slowest = slowest(all)
+	r.Paginated = paginated(all)
+	r.Suggestion = suggestWorkers(r)
+	roundTiming(r)
+	return r
+}
+
+// criticalPath returns the longest chain of dependent calls ending with the
+// last call to finish. A call becomes ready when all calls to its dependency
+// APIs in the same context have finished, so the predecessor of each call is
+// the last dependency call to finish.
+func criticalPath(all []*callTiming, byAPI map[*Map]map[string][]*callTiming) ([]*CallTiming, float64) {
+	var last *callTiming
+	for _, ct := range all {
+		if last == nil || ct.end > last.end {
+			last = ct
+		}
+	}
+	var path []*CallTiming
+	for ct := last; ct != nil; ct = ct.pred {
+		if !ct.done {
+			ct.done = true
+			for _, api := range ct.deps {
+				for _, dep := range byAPI[ct.m][api] {
+					if ct.pred == nil || dep.end > ct.pred.end {
+						ct.pred = dep
+					}
+				}
+			}
+			if ct.pred != nil {
+				ct.ready = ct.pred.end
+			} else {
+				ct.ready = ct.Start - ct.Queue
+			}
+			ct.Wait = math.Max(ct.Start-ct.ready, 0)
+		}
+		path = append(path, ct.CallTiming)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	first := path[0]
+	return path, last.end - (first.Start - first.Queue)
+}
+
+// serviceTiming returns per-service timing sorted by wall time.
+func serviceTiming(all []*callTiming) []*ServiceTiming {
+	type span struct{ start, end float64 }
+	svcs := make(map[string]*ServiceTiming)
+	spans := make(map[string]*span)
+	ctxs := make(map[*Map]bool)
+	for _, ct := range all {
+		st := svcs[ct.Service]
+		if st == nil {
+			st = &ServiceTiming{Service: ct.Service}
+			svcs[ct.Service] = st
+			spans[ct.Service] = &span{ct.Start, ct.end}
+		}
+		if !ctxs[ct.m] {
+			ctxs[ct.m] = true
+			st.Contexts++
+		}
+		st.Calls++
+		st.Exec += ct.Exec
+		sp := spans[ct.Service]
+		sp.start = math.Min(sp.start, ct.Start)
+		sp.end = math.Max(sp.end, ct.end)
+	}
+	out := make([]*ServiceTiming, 0, len(svcs))
+	for name, st := range svcs {
+		st.Wall = spans[name].end - spans[name].start
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Wall != out[j].Wall {
+			return out[i].Wall > out[j].Wall
+		}
+		return out[i].Service < out[j].Service
+	})
+	return out
+}
+
+// timeline returns the peak number of concurrent calls and average worker
+// utilization over time.
+func timeline(all []*callTiming, dur float64, workers int) (int, []*TimelineSlot) {
+	type event struct {
+		t     float64
+		delta int
+	}
+	events := make([]event, 0, 2*len(all))
+	for _, ct := range all {
+		events = append(events, event{ct.Start, 1}, event{ct.end, -1})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].t != events[j].t {
+			return events[i].t < events[j].t
+		}
+		return events[i].delta < events[j].delta
+	})
+	peak, n := 0, 0
+	for _, e := range events {
+		if n += e.delta; n > peak {
+			peak = n
+		}
+	}
+	if dur <= 0 {
+		return peak, nil
+	}
+	width := dur / timingSlots
+	slots := make([]*TimelineSlot, timingSlots)
+	for i := range slots {
+		slots[i] = &TimelineSlot{Start: float64(i) * width}
+	}
+	for _, ct := range all {
+		for i, s := range slots {
+			if overlap := math.Min(ct.end, s.Start+width) - math.Max(ct.Start, s.Start); overlap > 0 {
+				slots[i].Busy += overlap
+			}
+		}
+	}
+	for _, s := range slots {
+		s.Busy /= width
+		s.Utilization = s.Busy / float64(workers)
+	}
+	return peak, slots
+}
+
+// slowest returns the calls with the longest execution times.
+func slowest(all []*callTiming) []*CallTiming {
+	out := make([]*CallTiming, len(all))
+	for i, ct := range all {
+		out[i] = ct.CallTiming
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Exec > out[j].Exec })
+	if len(out) > timingTop {
+		out = out[:timingTop]
+	}
+	return out
+}
+
+// paginated returns the APIs with the most pages per call.
+func paginated(all []*callTiming) []*APIPagination {
+	apis := make(map[[2]string]*APIPagination)
+	for _, ct := range all {
+		k := [2]string{ct.Service, ct.API}
+		p := apis[k]
+		if p == nil {
+			p = &APIPagination{Service: ct.Service, API: ct.API}
+			apis[k] = p
+		}
+		p.Calls++
+		p.Pages += ct.Pages
+		if ct.Pages > p.MaxPages {
+			p.MaxPages = ct.Pages
+		}
+	}
+	out := make([]*APIPagination, 0, len(apis))
+	for _, p := range apis {
+		if p.MaxPages > 1 {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Pages != b.Pages {
+			return a.Pages > b.Pages
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.API < b.API
+	})
+	if len(out) > timingTop {
+		out = out[:timingTop]
+	}
+	return out
+}
+
+// suggestWorkers suggests a worker count based on the available parallelism,
+// which is the total execution time divided by the critical path length.
+// Adding workers beyond that point cannot make the scan faster.
+func suggestWorkers(r *TimingReport) *WorkerSuggestion {
+	s := &WorkerSuggestion{Workers: r.Workers}
+	if r.CriticalTime <= 0 {
+		s.Reason = "not enough timing information"
+		return s
+	}
+	par := int(math.Ceil(r.ExecTime / r.CriticalTime))
+	queued := r.QueueTime / float64(r.Calls)
+	switch {
+	case r.PeakWorkers >= r.Workers && par > r.Workers:
+		s.Workers = par
+		s.Reason = "all workers were busy and calls waited for workers; " +
+			"more workers can shorten the scan up to the critical path length"
+	case r.PeakWorkers < r.Workers:
+		s.Workers = r.PeakWorkers
+		s.Reason = "workers were never saturated; the scan is limited by " +
+			"API dependencies, so fewer workers give the same wall time"
+	case queued > 0 && par < r.Workers:
+		s.Workers = par
+		s.Reason = "available parallelism is lower than the worker count"
+	default:
+		s.Reason = "worker count matches available parallelism"
+	}
+	return s
+}
+
+// roundTiming rounds all times in r to the nearest millisecond.
+func roundTiming(r *TimingReport) {
+	round := func(t *float64) { *t = math.Round(*t*1e3) / 1e3 }
+	round(&r.Duration)
+	round(&r.ExecTime)
+	round(&r.QueueTime)
+	round(&r.CriticalTime)
+	r.Utilization = math.Round(r.Utilization*1e3) / 1e3
+	calls := append(append([]*CallTiming(nil), r.CriticalPath...), r.Slowest...)
+	seen := make(map[*CallTiming]bool)
+	for _, c := range calls {
+		if !seen[c] {
+			seen[c] = true
+			round(&c.Start)
+			round(&c.Wait)
+			round(&c.Queue)
+			round(&c.Exec)
+		}
+	}
+	for _, s := range r.Services {
+		round(&s.Wall)
+		round(&s.Exec)
+	}
+	for _, s := range r.Timeline {
+		round(&s.Start)
+		round(&s.Busy)
+		s.Utilization = math.Round(s.Utilization*1e3) / 1e3
+	}
+}
@@ -0,0 +1,80 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiming(t *testing.T) {
+	t0 := time.Now()
+	call := func(id string, src string, start, queue, exec float64, pages int) *Call {
+		c := &Call{
+			ID:  id,
+			Out: make([]interface{}, pages),
+			Stats: &Stats{
+				QueueTime: queue,
+				ExecTime:  exec,
+				start:     t0.Add(time.Duration(start * float64(time.Second))),
+			},
+		}
+		if src != "" {
+			c.Src = map[string]int{src: 0}
+		}
+		return c
+	}
+	ac := arn.Ctx{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+	maps := []*Map{{Ctx: ac, Service: "iam", Calls: map[string][]*Call{
+		"ListUsers": {call("lu", "", 0, 0, 1, 3)},
+		"ListUserPolicies": {
+			call("lup1", "lu", 1.2, 0.1, 0.5, 1),
+			call("lup2", "lu", 1.1, 0.05, 2, 1),
+		},
+		"GetUserPolicy": {call("gup", "lup1", 3.2, 0.1, 1, 1)},
+	}}, {Ctx: ac, Service: "s3", Calls: map[string][]*Call{
+		"ListBuckets":     {call("lb", "", 0, 0, 0.5, 1)},
+		"GetBucketPolicy": {{ID: "no-stats"}},
+	}}}
+
+	r := Timing(maps, 4)
+	require.NotNil(t, r)
+	assert.Equal(t, 4.2, r.Duration)
+	assert.Equal(t, 5, r.Calls)
+	assert.Equal(t, 4, r.Workers)
+	assert.Equal(t, 2, r.PeakWorkers)
+	assert.Equal(t, 5.0, r.ExecTime)
+	assert.Equal(t, 0.298, r.Utilization)
+	assert.Equal(t, 4.2, r.CriticalTime)
+
+	// GetUserPolicy waits for all ListUserPolicies calls, not just its source
+	var path []string
+	for _, c := range r.CriticalPath {
+		path = append(path, c.ID)
+	}
+	assert.Equal(t, []string{"lu", "lup2", "gup"}, path)
+	assert.Equal(t, 0.1, r.CriticalPath[2].Wait)
+	assert.Equal(t, 0.1, r.CriticalPath[1].Wait)
+
+	require.Len(t, r.Services, 2)
+	assert.Equal(t, &ServiceTiming{Service: "iam", Contexts: 1, Calls: 4, Wall: 4.2, Exec: 4.5}, r.Services[0])
+	assert.Equal(t, "s3", r.Services[1].Service)
+
+	require.Len(t, r.Timeline, timingSlots)
+	var busy float64
+	for _, s := range r.Timeline {
+		busy += s.Busy * 4.2 / timingSlots
+	}
+	assert.InDelta(t, 5.0, busy, 0.01)
+
+	assert.Equal(t, "lup2", r.Slowest[0].ID)
+	assert.Len(t, r.Slowest, 5)
+	assert.Equal(t, []*APIPagination{{
+		Service: "iam", API: "ListUsers", Calls: 1, Pages: 3, MaxPages: 3,
+	}}, r.Paginated)
+	assert.Equal(t, 2, r.Suggestion.Workers)
+
+	assert.Nil(t, Timing(nil, 0))
+}
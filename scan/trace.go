@@ -0,0 +1,186 @@
+package scan
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Span is one timed operation in a scan trace. Field names follow OpenTelemetry
+// conventions. Each scan is a separate trace with a root "scan" span, a child
+// span for each account/region/service context, and a span for each call.
+// Call spans are children of the span of the first source call in Call.Src,
+// with other sources added as links, or of the context span for root calls.
+// Each HTTP request attempt (page or retry) is a child of its call span.
+type Span struct {
+	TraceID  string                 `json:"traceId"`
+	SpanID   string                 `json:"spanId"`
+	ParentID string                 `json:"parentSpanId,omitempty"`
+	Name     string                 `json:"name"`
+	Start    int64                  `json:"startTimeUnixNano"`
+	End      int64                  `json:"endTimeUnixNano"`
+	Attrs    map[string]interface{} `json:"attributes,omitempty"`
+	Links    []string               `json:"links,omitempty"` // Related span IDs
+	Error    bool                   `json:"error,omitempty"`
+}
+
+// set sets span attribute k to v.
+func (sp *Span) set(k string, v interface{}) {
+	if sp != nil {
+		if sp.Attrs == nil {
+			sp.Attrs = make(map[string]interface{})
+		}
+		sp.Attrs[k] = v
+	}
+}
+
+// Tracer writes completed spans to an io.Writer as JSON lines. All methods are
+// safe for concurrent use and do nothing if the receiver is nil.
+type Tracer struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	err   error
+	next  uint64            // Span ID counter
+	calls map[string]string // Call ID to span ID map
+}
+
+// NewTracer returns a tracer that writes spans to w.
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{enc: json.NewEncoder(w), calls: make(map[string]string)}
+}
+
+// Err returns the first error encountered while writing spans.
+func (t *Tracer) Err() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// start starts a new span. A new trace is started if parent is nil.
+func (t *Tracer) start(parent *Span, name string) *Span {
+	if t == nil {
+		return nil
+	}
+	sp := &Span{Name: name, Start: time.Now().UnixNano()}
+	t.mu.Lock()
+	t.next++
+	sp.SpanID = strconv.FormatUint(t.next, 16)
+	t.mu.Unlock()
+	sp.SpanID = "0000000000000000"[len(sp.SpanID):] + sp.SpanID
+	if parent != nil {
+		sp.TraceID, sp.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		var id [16]byte
+		rand.Read(id[:])
+		sp.TraceID = hex.EncodeToString(id[:])
+	}
+	return sp
+}
+
+// end ends span sp and writes it out.
+func (t *Tracer) end(sp *Span) {
+	if t == nil || sp == nil {
+		return
+	}
+	sp.End = time.Now().UnixNano()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.enc.Encode(sp); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// startCall starts a span for call c, which must have an ID.
+func (t *Tracer) startCall(c *Call) {
+	if t == nil {
+		return
+	}
+	ctx := c.bat.ctx
+	parent := ctx.span
+	var links []string
+	if len(c.Src) > 0 {
+		ids := make([]string, 0, len(c.Src))
+		for id := range c.Src {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		t.mu.Lock()
+		for _, id := range ids {
+			if sid := t.calls[id]; sid != "" {
+				links = append(links, sid)
+			}
+		}
+		t.mu.Unlock()
+	}
+	sp := t.start(parent, ctx.Service+"."+c.bat.lnk.api)
+	if len(links) > 0 {
+		sp.ParentID, sp.Links = links[0], links[1:]
+		if len(sp.Links) == 0 {
+			sp.Links = nil
+		}
+	}
+	sp.set("aws.service", ctx.Service)
+	sp.set("aws.region", ctx.Region)
+	sp.set("aws.api", c.bat.lnk.api)
+	sp.set("call.id", c.ID)
+	t.mu.Lock()
+	t.calls[c.ID] = sp.SpanID
+	t.mu.Unlock()
+	c.span = sp
+}
+
+// endCall ends the span for call c.
+func (t *Tracer) endCall(c *Call) {
+	if t == nil || c.span == nil {
+		return
+	}
+	sp := c.span
+	c.span = nil
+	sp.set("call.pages", len(c.Out))
+	if c.Err != nil {
+		sp.set("error.code", c.Err.Code)
+		sp.set("error.ignored", c.Err.Ignore)
+		sp.Error = !c.Err.Ignore
+	}
+	t.end(sp)
+}
+
+// traceAttempts adds request handlers that create a span for each HTTP
+// request attempt made by call c.
+func (t *Tracer) traceAttempts(c *Call, req *aws.Request, page int) {
+	if t == nil || c.span == nil {
+		return
+	}
+	var sp *Span
+	end := func(r *aws.Request) {
+		if sp != nil {
+			sp.set("http.attempt", r.RetryCount)
+			if r.HTTPResponse != nil {
+				sp.set("http.status_code", r.HTTPResponse.StatusCode)
+			}
+			if err := decodeErr(r.Error); err != nil {
+				sp.set("error.code", err.Code)
+				sp.Error = true
+			}
+			t.end(sp)
+			sp = nil
+		}
+	}
+	req.Handlers.Sign.PushBack(func(r *aws.Request) {
+		end(r)
+		sp = t.start(c.span, "attempt")
+		sp.set("call.page", page)
+	})
+	req.Handlers.Retry.PushBack(end)
+	req.Handlers.Complete.PushBack(end)
+}
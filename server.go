@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	tf "github.com/hashicorp/terraform/terraform"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/awsscan/scan/check"
+	"github.com/mxk/awsscan/scan/redact"
+	"github.com/mxk/awsscan/scan/tfgen"
+	"github.com/pkg/errors"
+)
+
+// Scan job states.
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// scanRequest contains scan options accepted by the HTTP API.
+type scanRequest struct {
+	Regions    []string `json:"regions,omitempty"`
+	Services   []string `json:"services,omitempty"` // May use "no-" prefix
+	Workers    int      `json:"workers,omitempty"`
+	Roots      bool     `json:"roots,omitempty"`
+	CA         bool     `json:"ca,omitempty"`
+	CIS        bool     `json:"cis,omitempty"`
+	CredReport bool     `json:"credReport,omitempty"`
+	Stats      bool     `json:"stats,omitempty"`
+	Raw        bool     `json:"raw,omitempty"`
+}
+
+// jobStatus is the status of one scan started via the HTTP API.
+type jobStatus struct {
+	ID       string         `json:"id"`
+	State    string         `json:"state"`
+	Request  *scanRequest   `json:"request"`
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Progress *scan.Status   `json:"progress,omitempty"`
+	TimedOut map[string]int `json:"timedOut,omitempty"` // Timeouts by API
+}
+
+// job is one scan started via the HTTP API. Status is protected by server.mu.
+// Results are immutable once the job is done, except for call stats, which are
+// rounded by makeHier while holding render.
+type job struct {
+	jobStatus
+	render sync.Mutex
+	raw    []*scan.Map // Redacted results for state and check formats
+	maps   []*scan.Map
+	calls  map[string]*callRef // Calls by ID
+	dsts   map[string][]string // Call IDs by source call ID
+}
+
+// callRef is a call with its location in the default output hierarchy.
+type callRef struct {
+	Key  string     `json:"key"` // <account>/<region>/<service>.<api>
+	ID   string     `json:"id"`
+	Call *scan.Call `json:"call"`
+}
+
+// server is an HTTP API for starting scans and browsing their results.
+type server struct {
+	cmd     *scanCmd
+	cfg     *aws.Config
+	op      scan.Opts
+	red     *redact.Redactor
+	account func(*aws.Config, scan.Opts) ([]*scan.Map, error)
+	mu      sync.Mutex
+	next    int
+	running int
+	jobs    map[string]*job
+}
+
+// newServer returns a new HTTP API server.
+func newServer(cmd *scanCmd, cfg *aws.Config, op scan.Opts, red *redact.Redactor) *server {
+	return &server{
+		cmd:     cmd,
+		cfg:     cfg,
+		op:      op,
+		red:     red,
+		account: scan.Account,
+		jobs:    make(map[string]*job),
+	}
+}
+
+// handler returns the HTTP request handler for all API endpoints.
+func (srv *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scans", srv.scans)
+	mux.HandleFunc("/scans/", srv.scan)
+	if srv.op.Metrics != nil {
+		mux.Handle("/metrics", srv.op.Metrics)
+	}
+	return mux
+}
+
+// serve runs the HTTP API on cmd.Serve until the listener fails. Options in op
+// that are not specified by each scan request, such as metrics and logging, are
+// shared by all scans.
+func (cmd *scanCmd) serve(cfg *aws.Config, op scan.Opts, red *redact.Redactor) error {
+	ln, err := net.Listen("tcp", cmd.Serve)
+	if err != nil {
+		return errors.Wrap(err, "failed to start API listener")
+	}
+	defer ln.Close()
+	srv := newServer(cmd, cfg, op, red)
+	return errors.WithStack(http.Serve(ln, srv.handler()))
+}
+
+// scans handles "/scans" requests. GET lists all jobs and POST starts a new
+// scan unless cmd.ServeMax scans are already running.
+func (srv *server) scans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		srv.mu.Lock()
+		all := make([]jobStatus, 0, len(srv.jobs))
+		for _, j := range srv.jobs {
+			all = append(all, j.jobStatus)
+		}
+		srv.mu.Unlock()
+		sort.Slice(all, func(i, j int) bool { return all[i].Started.Before(all[j].Started) })
+		writeResponse(w, http.StatusOK, all)
+	case http.MethodPost:
+		req := new(scanRequest)
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scan request: "+err.Error())
+			return
+		}
+		if req.Workers < 0 {
+			writeError(w, http.StatusBadRequest, "invalid number of workers")
+			return
+		}
+		if req.CredReport && !req.CIS {
+			writeError(w, http.StatusBadRequest, "credReport requires cis")
+			return
+		}
+		j := srv.start(req)
+		if j == nil {
+			writeError(w, http.StatusTooManyRequests, "too many running scans")
+			return
+		}
+		w.Header().Set("Location", "/scans/"+j.ID)
+		srv.mu.Lock()
+		st := j.jobStatus
+		srv.mu.Unlock()
+		writeResponse(w, http.StatusAccepted, st)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// scan handles "/scans/<id>" requests for job status, "/scans/<id>/results"
+// for the output hierarchy, and "/scans/<id>/calls?id=<call-id>" for a single
+// call with its ancestors and descendants. The call ID is a query parameter
+// because base64 IDs may contain "/" or "//", which ServeMux would clean from
+// the path. DELETE removes a finished job.
+func (srv *server) scan(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/scans/"), "/", 2)
+	srv.mu.Lock()
+	j := srv.jobs[parts[0]]
+	var st jobStatus
+	if j != nil {
+		st = j.jobStatus
+	}
+	srv.mu.Unlock()
+	if j == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	if len(parts) == 1 && r.Method == http.MethodDelete {
+		if st.State == jobRunning {
+			writeError(w, http.StatusConflict, "scan is running")
+			return
+		}
+		srv.mu.Lock()
+		delete(srv.jobs, j.ID)
+		srv.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if len(parts) == 1 {
+		writeResponse(w, http.StatusOK, st)
+		return
+	}
+	if st.State != jobDone {
+		writeError(w, http.StatusConflict, "scan is "+st.State)
+		return
+	}
+	switch {
+	case len(parts) == 2 && parts[1] == "results":
+		srv.results(w, r, j)
+	case len(parts) == 2 && parts[1] == "calls":
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeError(w, http.StatusBadRequest, "missing call id")
+			return
+		}
+		srv.call(w, j, id)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// results writes the results of job j in the format specified by the "format"
+// query parameter. The default "json" format uses "hier", "stats", and "min"
+// parameters, which have the same meaning as the corresponding options.
+// "tfstate" and "tfstate4" write unrefreshed Terraform state, "tfimport" writes
+// import commands in the "import" format (sh or tf), and "check" evaluates the
+// "rules" sets and writes the report in the "report" format (json, sarif, or
+// junit).
+func (srv *server) results(w http.ResponseWriter, r *http.Request, j *job) {
+	q := r.URL.Query()
+	switch f := q.Get("format"); f {
+	case "", "json":
+	case "tfstate", "tfstate4", "tfimport":
+		srv.tfResults(w, j, f, q.Get("import"))
+		return
+	case "check":
+		srv.checkResults(w, j, q.Get("rules"), q.Get("report"))
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "invalid format "+strconv.Quote(f))
+		return
+	}
+	spec := q.Get("hier")
+	if spec == "" {
+		spec = srv.cmd.Hier
+	}
+	keyGen, err := parseHier(spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stats := q.Get("stats") != "" && j.Request.Stats
+	j.render.Lock()
+	defer j.render.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if enc.SetEscapeHTML(false); q.Get("min") == "" {
+		enc.SetIndent("", "\t")
+	}
+	enc.Encode(makeHier(j.maps, keyGen, stats))
+}
+
+// tfResults writes Terraform state or import commands for job j. State is not
+// refreshed, so it only contains attributes that were set from scan outputs.
+func (srv *server) tfResults(w http.ResponseWriter, j *job, format, imp string) {
+	if format == "tfimport" {
+		switch imp {
+		case tfgen.ImportScript, tfgen.ImportBlocks:
+		default:
+			writeError(w, http.StatusBadRequest, "invalid import format "+strconv.Quote(imp))
+			return
+		}
+	}
+	s, err := scan.NewTFState(j.raw)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	srv.cmd.naming(j.raw).Rename(s)
+	if srv.red != nil {
+		srv.red.State(s)
+	}
+	var b []byte
+	typ := "application/json"
+	switch format {
+	case "tfstate":
+		var buf bytes.Buffer
+		if err = tf.WriteState(s, &buf); err == nil {
+			b = buf.Bytes()
+		}
+	case "tfstate4":
+		b, err = tfgen.StateV4(s)
+	case "tfimport":
+		b, err = tfgen.Imports(s, imp)
+		typ = "text/plain; charset=utf-8"
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", typ)
+	w.Write(b)
+}
+
+// checkResults evaluates comma-separated rule sets against the results of job j
+// and writes the report in the specified format.
+func (srv *server) checkResults(w http.ResponseWriter, j *job, sets, format string) {
+	if sets == "" {
+		writeError(w, http.StatusBadRequest, "missing rule sets")
+		return
+	}
+	names := strings.Split(sets, ",")
+	switch format {
+	case "", "json":
+	case "sarif", "junit":
+		names = append(names, check.Errors)
+	default:
+		writeError(w, http.StatusBadRequest, "invalid report format "+strconv.Quote(format))
+		return
+	}
+	rules, err := check.Rules(names...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rep := check.Run(j.raw, rules)
+	var b []byte
+	switch format {
+	case "sarif":
+		b, err = rep.SARIF()
+	case "junit":
+		b, err = rep.JUnit()
+	default:
+		writeResponse(w, http.StatusOK, rep)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if format == "junit" {
+		w.Header().Set("Content-Type", "application/xml")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(b)
+}
+
+// call writes the call with the specified ID, all calls that provided its
+// inputs (directly or indirectly), and all calls whose inputs it provided.
+func (srv *server) call(w http.ResponseWriter, j *job, id string) {
+	c := j.calls[id]
+	if c == nil {
+		writeError(w, http.StatusNotFound, "call not found")
+		return
+	}
+	var anc, desc []*callRef
+	seen := map[string]bool{id: true}
+	for next := []string{id}; len(next) > 0; {
+		var src []string
+		for _, id := range next {
+			for s := range j.calls[id].Call.Src {
+				if !seen[s] && j.calls[s] != nil {
+					seen[s] = true
+					src = append(src, s)
+					anc = append(anc, j.calls[s])
+				}
+			}
+		}
+		next = src
+	}
+	for next := []string{id}; len(next) > 0; {
+		var dst []string
+		for _, id := range next {
+			for _, d := range j.dsts[id] {
+				if !seen[d] {
+					seen[d] = true
+					dst = append(dst, d)
+					desc = append(desc, j.calls[d])
+				}
+			}
+		}
+		next = dst
+	}
+	sortRefs(anc)
+	sortRefs(desc)
+	j.render.Lock()
+	defer j.render.Unlock()
+	writeResponse(w, http.StatusOK, struct {
+		*callRef
+		Ancestors   []*callRef `json:"ancestors"`
+		Descendants []*callRef `json:"descendants"`
+	}{c, anc, desc})
+}
+
+// start starts a new scan job in the background. It returns nil if
+// cmd.ServeMax scans are already running.
+func (srv *server) start(req *scanRequest) *job {
+	op := srv.op
+	op.Mode = 0
+	if req.Roots {
+		op.Mode |= scan.RootsOnly
+	}
+	if req.Stats {
+		op.Mode |= scan.KeepStats
+	}
+	if req.CA {
+		op.Mode |= scan.CloudAssert
+	}
+	if req.CIS {
+		op.Mode |= scan.CIS
+	}
+	if req.CredReport {
+		op.Mode |= scan.CredReport
+	}
+	op.Regions = req.Regions
+	if len(req.Services) > 0 {
+		op.Services = getServices(strings.Join(req.Services, ","))
+	} else {
+		op.Services = nil
+	}
+	if req.Workers > 0 {
+		op.Workers = req.Workers
+	}
+	srv.mu.Lock()
+	if srv.running >= srv.cmd.ServeMax {
+		srv.mu.Unlock()
+		return nil
+	}
+	srv.running++
+	srv.next++
+	j := &job{jobStatus: jobStatus{
+		ID:      strconv.Itoa(srv.next),
+		State:   jobRunning,
+		Request: req,
+		Started: time.Now().UTC(),
+	}}
+	srv.jobs[j.ID] = j
+	srv.mu.Unlock()
+	op.Progress = &scan.Progress{Report: func(st *scan.Status) {
+		srv.mu.Lock()
+		j.Progress = st
+		srv.mu.Unlock()
+	}}
+	go func() {
+		maps, err := srv.account(srv.cfg, op)
+		var timedOut map[string]int
+		if err == nil {
+			if srv.red != nil {
+				srv.red.Maps(maps)
+			}
+			j.raw, maps = maps, scan.Clone(maps)
+			if makeValues(maps); !req.Raw {
+				maps = scan.Compact(maps)
+			}
+			timedOut = scan.TimedOut(maps)
+			j.index(maps)
+		}
+		now := time.Now().UTC()
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		srv.running--
+		if j.Finished = &now; err != nil {
+			j.State, j.Error = jobFailed, err.Error()
+		} else {
+			j.State, j.TimedOut = jobDone, timedOut
+		}
+		// Metrics are cumulative over all jobs, so a failed write is only
+		// reported and the next job tries again.
+		if err := srv.cmd.writeMetrics(srv.op.Metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}()
+	return j
+}
+
+// index sets job results and indexes calls by ID and source ID.
+func (j *job) index(maps []*scan.Map) {
+	j.maps = maps
+	j.calls = make(map[string]*callRef)
+	j.dsts = make(map[string][]string)
+	scan.Walk(maps, func(m *scan.Map, api string, c *scan.Call) error {
+		key := m.Account + "/" + m.Region + "/" + m.Service + "." + api
+		j.calls[c.ID] = &callRef{Key: key, ID: c.ID, Call: c}
+		for src := range c.Src {
+			j.dsts[src] = append(j.dsts[src], c.ID)
+		}
+		return nil
+	})
+}
+
+// sortRefs sorts calls by key and ID.
+func sortRefs(v []*callRef) {
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Key != v[j].Key {
+			return v[i].Key < v[j].Key
+		}
+		return v[i].ID < v[j].ID
+	})
+}
+
+// writeResponse writes the JSON encoding of v as the response body.
+func writeResponse(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	enc.Encode(v)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeResponse(w, status, struct {
+		Error string `json:"error"`
+	}{msg})
+}
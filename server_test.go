@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/awsscan/scan"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	s := aws.String
+	newMaps := func() []*scan.Map {
+		return []*scan.Map{{
+			Ctx:     arn.Ctx{Partition: "aws", Region: "aws-global", Account: "123"},
+			Service: "iam",
+			Calls: map[string][]*scan.Call{
+				"ListUsers": {{
+					ID:  "a",
+					In:  &iam.ListUsersInput{},
+					Out: []interface{}{&iam.ListUsersOutput{Users: []iam.User{{UserName: s("bob")}}}},
+				}},
+				"ListUserPolicies": {{
+					ID:  "b/+x",
+					Src: map[string]int{"a": 0},
+					In:  &iam.ListUserPoliciesInput{UserName: s("bob")},
+					Out: []interface{}{&iam.ListUserPoliciesOutput{PolicyNames: []string{"p"}}},
+				}},
+				"GetUserPolicy": {{
+					ID:  "c//y=",
+					Src: map[string]int{"b/+x": 0},
+					In:  &iam.GetUserPolicyInput{UserName: s("bob"), PolicyName: s("p")},
+					Out: []interface{}{&iam.GetUserPolicyOutput{PolicyName: s("p")}},
+				}},
+			},
+		}}
+	}
+	release := make(chan struct{})
+	dir, err := ioutil.TempDir("", "awsscan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cmd := &scanCmd{
+		Hier:     "{account}/{region}/{service}.{api},{id}",
+		Metrics:  filepath.Join(dir, "metrics.txt"),
+		ServeMax: 1,
+	}
+	srv := newServer(cmd, nil, scan.Opts{Metrics: scan.NewMetrics()}, nil)
+	srv.account = func(_ *aws.Config, op scan.Opts) ([]*scan.Map, error) {
+		<-release
+		if len(op.Regions) > 0 && op.Regions[0] == "fail" {
+			return nil, errors.New("scan failed")
+		}
+		return newMaps(), nil
+	}
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	do := func(method, path, body string, v interface{}) int {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+		b, err := ioutil.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		if v != nil {
+			require.NoError(t, json.Unmarshal(b, v), "%s", b)
+		}
+		return rsp.StatusCode
+	}
+	wait := func(id, state string) (st jobStatus) {
+		for end := time.Now().Add(5 * time.Second); time.Now().Before(end); {
+			if do("GET", "/scans/"+id, "", &st); st.State != jobRunning {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, state, st.State)
+		return
+	}
+
+	// Invalid requests
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/scans", `{"x": 1}`, nil))
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/scans", `{"credReport": true}`, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, do("PUT", "/scans", "", nil))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/scans/1", "", nil))
+
+	// Running scan (raw, since compaction requires types of real requests)
+	var st jobStatus
+	require.Equal(t, http.StatusAccepted, do("POST", "/scans", `{"raw": true, "stats": true}`, &st))
+	assert.Equal(t, "1", st.ID)
+	assert.Equal(t, jobRunning, st.State)
+	assert.True(t, st.Request.Stats)
+	assert.Equal(t, http.StatusTooManyRequests, do("POST", "/scans", `{}`, nil))
+	assert.Equal(t, http.StatusConflict, do("GET", "/scans/1/results", "", nil))
+	assert.Equal(t, http.StatusConflict, do("DELETE", "/scans/1", "", nil))
+
+	// Finished scan
+	close(release)
+	st = wait("1", jobDone)
+	assert.NotNil(t, st.Finished)
+	_, err = os.Stat(cmd.Metrics)
+	assert.NoError(t, err, "metrics not written")
+	var all []jobStatus
+	require.Equal(t, http.StatusOK, do("GET", "/scans", "", &all))
+	require.Len(t, all, 1)
+	assert.Equal(t, "1", all[0].ID)
+
+	var h map[string]map[string]json.RawMessage
+	require.Equal(t, http.StatusOK, do("GET", "/scans/1/results", "", &h))
+	assert.Contains(t, h["123/aws-global/iam.ListUserPolicies"], "b/+x")
+	var flat map[string]json.RawMessage
+	require.Equal(t, http.StatusOK, do("GET", "/scans/1/results?hier=0&min=1", "", &flat))
+	assert.Contains(t, flat, "123/aws-global/iam/ListUserPolicies/b/+x")
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/scans/1/results?format=x", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/scans/1/results?format=tfimport&import=x", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/scans/1/results?format=check", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/scans/1/results?format=check&rules=x", "", nil))
+	assert.Equal(t, http.StatusOK, do("GET", "/scans/1/results?format=check&rules=errors", "", nil))
+	assert.Equal(t, http.StatusOK, do("GET", "/scans/1/results?format=check&rules=errors&report=sarif", "", nil))
+
+	// Call ancestors and descendants (IDs are base64 and may contain "/")
+	type ref struct{ Key, ID string }
+	var call struct {
+		ref
+		Ancestors   []ref
+		Descendants []ref
+	}
+	calls := "/scans/1/calls?id="
+	require.Equal(t, http.StatusOK, do("GET", calls+url.QueryEscape("b/+x"), "", &call))
+	assert.Equal(t, ref{"123/aws-global/iam.ListUserPolicies", "b/+x"}, call.ref)
+	assert.Equal(t, []ref{{"123/aws-global/iam.ListUsers", "a"}}, call.Ancestors)
+	assert.Equal(t, []ref{{"123/aws-global/iam.GetUserPolicy", "c//y="}}, call.Descendants)
+	require.Equal(t, http.StatusOK, do("GET", calls+url.QueryEscape("c//y="), "", &call))
+	assert.Equal(t, ref{"123/aws-global/iam.GetUserPolicy", "c//y="}, call.ref)
+	assert.Equal(t, []ref{
+		{"123/aws-global/iam.ListUserPolicies", "b/+x"},
+		{"123/aws-global/iam.ListUsers", "a"},
+	}, call.Ancestors)
+	assert.Empty(t, call.Descendants)
+	assert.Equal(t, http.StatusNotFound, do("GET", calls+"x", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do("GET", calls, "", nil))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/scans/1/calls/a", "", nil))
+
+	// Failed scan
+	require.Equal(t, http.StatusAccepted, do("POST", "/scans", `{"regions": ["fail"]}`, &st))
+	st = wait(st.ID, jobFailed)
+	assert.Equal(t, "scan failed", st.Error)
+	assert.Equal(t, http.StatusConflict, do("GET", "/scans/"+st.ID+"/results", "", nil))
+
+	// Delete
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/scans/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/scans/1", "", nil))
+	require.Equal(t, http.StatusOK, do("GET", "/scans", "", &all))
+	assert.Len(t, all, 1)
+}
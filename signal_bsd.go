@@ -0,0 +1,10 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package main
+
+import "syscall"
+
+func init() {
+	detailSignals = append(detailSignals, syscall.SIGINFO)
+}
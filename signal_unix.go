@@ -0,0 +1,10 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import "syscall"
+
+func init() {
+	detailSignals = append(detailSignals, syscall.SIGUSR1)
+}